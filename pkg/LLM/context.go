@@ -0,0 +1,360 @@
+package LLM
+
+// Fitting a conversation into the model's context window. Ollama doesn't
+// complain when a request is longer than num_ctx; it quietly cuts it from
+// the front, which takes the system prompt with it. So the history is cut
+// down here instead, a whole turn (a prompt and its answer) at a time, in
+// whichever way the config asks for.
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/duluk/ask-ollama/pkg/ollama"
+)
+
+// Strategy is how a conversation that's too long is made to fit
+type Strategy string
+
+const (
+	// Leave out the oldest turns
+	DropOldest Strategy = "drop_oldest"
+	// Keep the first few turns (which often set up what it's about) and the
+	// last few, leaving out the ones in between
+	KeepEnds Strategy = "keep_ends"
+	// Replace the turns that would be left out with a summary of them
+	Summarize Strategy = "summarize"
+)
+
+var Strategies = []Strategy{DropOldest, KeepEnds, Summarize}
+
+func ParseStrategy(s string) (Strategy, error) {
+	if s == "" {
+		return DropOldest, nil
+	}
+	for _, strategy := range Strategies {
+		if string(strategy) == s {
+			return strategy, nil
+		}
+	}
+	return "", fmt.Errorf("unknown context strategy %q (expected drop_oldest, keep_ends or summarize)", s)
+}
+
+// RoleSummary marks a summary of earlier turns in a conversation's context
+const RoleSummary = "summary"
+
+// Roughly what each message costs on top of its content, for the role and
+// the template around it
+const messageOverhead = 4
+
+// Budget is how much of a conversation can be sent to a model
+type Budget struct {
+	// The model's context window (num_ctx), and how much of it to leave for
+	// the answer
+	ContextLength int
+	Reserve       int
+	Strategy      Strategy
+	// Turns to keep from the start and end, for KeepEnds
+	KeepFirst int
+	KeepLast  int
+	// Count counts the tokens in some text; EstimateTokens if nil
+	Count func(string) int
+	// Summarize sums up turns for the Summarize strategy; without it they're
+	// just left out
+	Summarize func([]LLMConversations) (string, error)
+	// The context window of the model doing the summarizing, if it isn't
+	// the same one
+	SummaryLength int
+	// The summary made the last time the conversation was fitted, which is
+	// carried on from rather than starting over
+	Summary Summary
+}
+
+// Summary is a rolling summary of the start of a conversation
+type Summary struct {
+	Text string
+	// How many turns, from the first, it covers
+	Turns int
+	Model string
+}
+
+// Fitted is the history that fits, and what was done to make it fit
+type Fitted struct {
+	Context []LLMConversations
+	// The tokens being sent (system prompt, history and prompt) and the
+	// most there's room for
+	Tokens int
+	Limit  int
+	// Turns that were left out, or summarized, and their tokens
+	Dropped       int
+	DroppedTokens int
+	// The summary standing in for the turns that were left out, and
+	// whether it's new (so worth keeping for next time)
+	Summarized bool
+	Summary    Summary
+	NewSummary bool
+	// The prompt doesn't fit even without any history
+	Overflow bool
+}
+
+// Trimmed reports whether any of the history had to go
+func (f Fitted) Trimmed() bool {
+	return f.Dropped > 0
+}
+
+func (f Fitted) String() string {
+	if f.Overflow {
+		return fmt.Sprintf("the prompt is about %d tokens, more than the %d the context has room for", f.Tokens, f.Limit)
+	}
+	if !f.Trimmed() {
+		return fmt.Sprintf("%d of %d tokens", f.Tokens, f.Limit)
+	}
+	what := "left out"
+	if f.Summarized {
+		what = "summarized"
+	}
+	return fmt.Sprintf("%s %d earlier %s (about %d tokens) to fit in %d tokens",
+		what, f.Dropped, plural(f.Dropped, "turn", "turns"), f.DroppedTokens, f.Limit)
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+func (b *Budget) count(text string) int {
+	if b.Count != nil {
+		return b.Count(text)
+	}
+	return int(EstimateTokens(text))
+}
+
+func (b *Budget) messageTokens(msg LLMConversations) int {
+	return b.count(msg.Content) + messageOverhead
+}
+
+func (b *Budget) turnTokens(turn []LLMConversations) int {
+	n := 0
+	for _, msg := range turn {
+		n += b.messageTokens(msg)
+	}
+	return n
+}
+
+// Fit cuts history down, if it needs to be, so that it fits in the budget
+// along with the system prompt and the new prompt. A budget without a
+// context length doesn't limit anything.
+func (b *Budget) Fit(system, prompt string, history []LLMConversations) (Fitted, error) {
+	fixed := b.count(system) + b.count(prompt) + 2*messageOverhead
+	turns := splitTurns(history)
+	sizes := make([]int, len(turns))
+	total := fixed
+	for i, turn := range turns {
+		sizes[i] = b.turnTokens(turn)
+		total += sizes[i]
+	}
+
+	f := Fitted{Context: history, Tokens: total, Limit: b.ContextLength - b.Reserve}
+	if b.ContextLength <= 0 || total <= f.Limit {
+		return f, nil
+	}
+	if fixed > f.Limit {
+		f.Context, f.Tokens, f.Overflow = nil, fixed, true
+		f.Dropped, f.DroppedTokens = len(turns), total-fixed
+		return f, nil
+	}
+
+	// Which turns to keep, oldest first
+	keep := make([]bool, len(turns))
+	for i := range keep {
+		keep[i] = true
+	}
+	drop := func(i int) {
+		keep[i] = false
+		total -= sizes[i]
+		f.Dropped++
+		f.DroppedTokens += sizes[i]
+	}
+
+	limit := f.Limit
+	var summarySpace int
+	if b.Strategy == Summarize && b.Summarize != nil {
+		// Leave room for the summary, which shouldn't be more than a
+		// fraction of what it replaces
+		summarySpace = min(limit/4, 1024)
+		limit -= summarySpace
+	}
+
+	if b.Strategy == KeepEnds {
+		// The turns in between go, oldest first, until it fits
+		for i := b.KeepFirst; i < len(turns)-b.KeepLast && total > limit; i++ {
+			drop(i)
+		}
+	}
+	// Whatever the strategy, if it still doesn't fit, the oldest go
+	dropped := 0
+	for i := 0; i < len(turns) && total > limit; i++ {
+		if keep[i] {
+			drop(i)
+		}
+		dropped = i + 1
+	}
+
+	if summarySpace > 0 && dropped > 0 {
+		summary, err := b.rollSummary(turns, dropped, summarySpace)
+		if err != nil {
+			return f, err
+		}
+		f.NewSummary = summary.Turns != b.Summary.Turns
+		// The summary may cover more than had to go, and then those turns
+		// go too, since they'd be there twice otherwise
+		for i := dropped; i < summary.Turns; i++ {
+			drop(i)
+		}
+
+		// The summary should fit in the room left for it, but the model
+		// may not have kept it short, in which case it's cut to fit (or, if
+		// there's no room at all, left out)
+		room := f.Limit - total - messageOverhead
+		if b.count(summary.Text) > room {
+			summary.Text = b.truncate(summary.Text, room)
+		}
+		f.Summary = summary
+		if summary.Text != "" {
+			f.Summarized = true
+			total += b.messageTokens(summary.message())
+		}
+	}
+
+	var kept []LLMConversations
+	if f.Summarized {
+		kept = append(kept, f.Summary.message())
+	}
+	for i, turn := range turns {
+		if keep[i] {
+			kept = append(kept, turn...)
+		}
+	}
+
+	f.Context = kept
+	f.Tokens = total
+	return f, nil
+}
+
+// truncate cuts text down until it's no more than max tokens
+func (b *Budget) truncate(text string, max int) string {
+	for text != "" && b.count(text) > max {
+		if max <= 0 {
+			return ""
+		}
+		// In proportion, which is about right, and then again if not
+		n := min(len(text)*max/b.count(text), len(text)-1)
+		for n > 0 && !utf8.RuneStart(text[n]) {
+			n--
+		}
+		text = strings.TrimSpace(text[:n])
+	}
+	return text
+}
+
+func (s Summary) message() LLMConversations {
+	return LLMConversations{Role: RoleSummary, Content: s.Text}
+}
+
+// rollSummary brings the summary up to (at least) the first n turns,
+// summing up the turns since the last one together with it, a few at a
+// time if they won't all fit in the summarizer's context at once
+func (b *Budget) rollSummary(turns [][]LLMConversations, n, space int) (Summary, error) {
+	summary := b.Summary
+	if summary.Turns > len(turns) || (summary.Turns > 0 && summary.Text == "") {
+		// It's not a summary of this conversation, or not one that's any use
+		summary = Summary{}
+	}
+
+	context := b.SummaryLength
+	if context <= 0 {
+		context = b.ContextLength
+	}
+	for summary.Turns < n {
+		room := context - space - b.count(summaryPrompt) - messageOverhead
+		var history []LLMConversations
+		if summary.Text != "" {
+			history = append(history, summary.message())
+			room -= b.messageTokens(summary.message())
+		}
+
+		// At least one turn, however long, or it'd never get anywhere
+		end := summary.Turns
+		for end < n && (end == summary.Turns || b.turnTokens(turns[end]) <= room) {
+			room -= b.turnTokens(turns[end])
+			history = append(history, turns[end]...)
+			end++
+		}
+
+		text, err := b.Summarize(history)
+		if err != nil {
+			return summary, fmt.Errorf("error summarizing the conversation: %v", err)
+		}
+		summary = Summary{Text: strings.TrimSpace(text), Turns: end}
+	}
+	return summary, nil
+}
+
+// splitTurns groups history into turns, each starting with a user's prompt
+func splitTurns(history []LLMConversations) [][]LLMConversations {
+	var turns [][]LLMConversations
+	for _, msg := range history {
+		if len(turns) == 0 || strings.EqualFold(msg.Role, "user") {
+			turns = append(turns, nil)
+		}
+		turns[len(turns)-1] = append(turns[len(turns)-1], msg)
+	}
+	return turns
+}
+
+// transcript is history as text, for the model summarizing it
+func transcript(history []LLMConversations) string {
+	var b strings.Builder
+	for _, msg := range history {
+		switch strings.ToLower(msg.Role) {
+		case "user":
+			b.WriteString("User: ")
+		case "assistant":
+			b.WriteString("Assistant: ")
+		case RoleSummary:
+			b.WriteString("Summary of what came before: ")
+		}
+		b.WriteString(msg.Content)
+		b.WriteString("\n\n")
+	}
+	return b.String()
+}
+
+const summaryPrompt = `You summarize conversations between a user and an AI assistant so they can be continued without the full history. If it starts with a summary of what came before, fold that into yours. Keep the facts, decisions, names, code and open questions that later turns might refer to. Leave out pleasantries. Write it as a few short paragraphs or a list, in the third person, and don't add anything that wasn't said.`
+
+// Summarizer returns a Summarize for a Budget that has model sum up turns
+func (cs *Ollama) Summarizer(model string, contextLength int) func([]LLMConversations) (string, error) {
+	return func(history []LLMConversations) (string, error) {
+		req := ollama.ChatRequest{
+			Model: model,
+			Messages: []ollama.Message{
+				{Role: "system", Content: summaryPrompt},
+				{Role: "user", Content: transcript(history)},
+			},
+			Options: map[string]any{"temperature": 0.2},
+		}
+		if contextLength > 0 {
+			req.Options["num_ctx"] = contextLength
+		}
+
+		resp, err := cs.Client.Chat(req, nil)
+		if err != nil {
+			return "", err
+		}
+		_, answer := SplitReasoning(resp.Message.Content)
+		return answer, nil
+	}
+}
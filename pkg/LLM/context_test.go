@@ -0,0 +1,257 @@
+package LLM
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countWords makes the sums easy: each message is its words plus the
+// overhead, so every turn below is 20 tokens
+func countWords(text string) int {
+	return len(strings.Fields(text))
+}
+
+func testHistory() []LLMConversations {
+	var history []LLMConversations
+	for _, n := range []string{"one", "two", "three", "four"} {
+		history = append(history,
+			LLMConversations{Role: "user", Content: "question " + n + " x x x x"},
+			LLMConversations{Role: "assistant", Content: "answer " + n + " x x x x"},
+		)
+	}
+	return history
+}
+
+// turnNames is which turns are in a context, by their number
+func turnNames(context []LLMConversations) []string {
+	var names []string
+	for _, msg := range context {
+		if msg.Role == "user" {
+			names = append(names, strings.Fields(msg.Content)[1])
+		}
+	}
+	return names
+}
+
+func TestParseStrategy(t *testing.T) {
+	s, err := ParseStrategy("")
+	assert.Nil(t, err)
+	assert.Equal(t, DropOldest, s)
+
+	s, err = ParseStrategy("keep_ends")
+	assert.Nil(t, err)
+	assert.Equal(t, KeepEnds, s)
+
+	_, err = ParseStrategy("oldest")
+	assert.NotNil(t, err)
+}
+
+func TestFit(t *testing.T) {
+	// The system prompt and prompt are 10 tokens, so it's 90 in all
+	tests := []struct {
+		name      string
+		budget    Budget
+		turns     []string
+		tokens    int
+		dropped   int
+		overflow  bool
+		described string
+	}{
+		{
+			name:   "no limit",
+			budget: Budget{},
+			turns:  []string{"one", "two", "three", "four"},
+			tokens: 90,
+		},
+		{
+			name:      "fits",
+			budget:    Budget{ContextLength: 100, Reserve: 10},
+			turns:     []string{"one", "two", "three", "four"},
+			tokens:    90,
+			described: "90 of 90 tokens",
+		},
+		{
+			name:      "drop oldest",
+			budget:    Budget{ContextLength: 80, Reserve: 20},
+			turns:     []string{"three", "four"},
+			tokens:    50,
+			dropped:   2,
+			described: "left out 2 earlier turns (about 40 tokens) to fit in 60 tokens",
+		},
+		{
+			name:    "keep ends",
+			budget:  Budget{ContextLength: 60, Strategy: KeepEnds, KeepFirst: 1, KeepLast: 1},
+			turns:   []string{"one", "four"},
+			tokens:  50,
+			dropped: 2,
+		},
+		{
+			name:    "keep ends, leaving out only what has to go",
+			budget:  Budget{ContextLength: 70, Strategy: KeepEnds, KeepFirst: 1, KeepLast: 1},
+			turns:   []string{"one", "three", "four"},
+			tokens:  70,
+			dropped: 1,
+		},
+		{
+			name:    "keep ends, and still too long",
+			budget:  Budget{ContextLength: 40, Strategy: KeepEnds, KeepFirst: 1, KeepLast: 1},
+			turns:   []string{"four"},
+			tokens:  30,
+			dropped: 3,
+		},
+		{
+			name:    "keep ends with nothing to keep but the ends",
+			budget:  Budget{ContextLength: 90, Strategy: KeepEnds, KeepFirst: 2, KeepLast: 2},
+			turns:   []string{"one", "two", "three", "four"},
+			tokens:  90,
+			dropped: 0,
+		},
+		{
+			name:      "overflow",
+			budget:    Budget{ContextLength: 5},
+			tokens:    10,
+			dropped:   4,
+			overflow:  true,
+			described: "the prompt is about 10 tokens, more than the 5 the context has room for",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.budget.Count = countWords
+			f, err := tt.budget.Fit("system", "prompt", testHistory())
+			assert.Nil(t, err)
+			assert.Equal(t, tt.turns, turnNames(f.Context))
+			assert.Equal(t, tt.tokens, f.Tokens)
+			assert.Equal(t, tt.dropped, f.Dropped)
+			assert.Equal(t, tt.overflow, f.Overflow)
+			assert.False(t, f.Summarized)
+			if tt.described != "" {
+				assert.Equal(t, tt.described, f.String())
+			}
+		})
+	}
+}
+
+func TestFitSummarize(t *testing.T) {
+	var calls [][]string
+	budget := Budget{
+		ContextLength: 80,
+		Strategy:      Summarize,
+		Count:         countWords,
+		Summarize: func(history []LLMConversations) (string, error) {
+			var call []string
+			if history[0].Role == RoleSummary {
+				call = append(call, history[0].Content)
+			}
+			call = append(call, turnNames(history)...)
+			calls = append(calls, call)
+			return " About " + strings.Join(call, " and ") + ". \n", nil
+		},
+	}
+
+	// A quarter of the 80 is kept for the summary, so turns one and two go.
+	// With the summary prompt, there's only room to summarize one turn at a
+	// time, so the summary of one is rolled into the summary of two.
+	f, err := budget.Fit("system", "prompt", testHistory())
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"one"}, {"About one.", "two"}}, calls)
+	assert.Equal(t, LLMConversations{Role: RoleSummary, Content: "About About one. and two."}, f.Context[0])
+	assert.Equal(t, []string{"three", "four"}, turnNames(f.Context))
+	assert.Equal(t, 2, f.Dropped)
+	assert.Equal(t, 50+countWords("About About one. and two.")+messageOverhead, f.Tokens)
+	assert.True(t, f.Summarized)
+	assert.True(t, f.NewSummary)
+	assert.Equal(t, Summary{Text: "About About one. and two.", Turns: 2}, f.Summary)
+	assert.Equal(t, "summarized 2 earlier turns (about 40 tokens) to fit in 80 tokens", f.String())
+
+	// The summary from last time is used as it is if it covers enough
+	calls = nil
+	budget.Summary = Summary{Text: "Earlier.", Turns: 2}
+	f, err = budget.Fit("system", "prompt", testHistory())
+	assert.Nil(t, err)
+	assert.Empty(t, calls)
+	assert.Equal(t, []string{"three", "four"}, turnNames(f.Context))
+	assert.Equal(t, "Earlier.", f.Context[0].Content)
+	assert.False(t, f.NewSummary)
+
+	// Or carried on from if it doesn't
+	budget.Summary = Summary{Text: "Earlier.", Turns: 1}
+	f, err = budget.Fit("system", "prompt", testHistory())
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"Earlier.", "two"}}, calls)
+	assert.Equal(t, Summary{Text: "About Earlier. and two.", Turns: 2}, f.Summary)
+	assert.True(t, f.NewSummary)
+
+	// One that covers more than had to go takes those turns with it
+	calls = nil
+	budget.Summary = Summary{Text: "Earlier.", Turns: 3}
+	f, err = budget.Fit("system", "prompt", testHistory())
+	assert.Nil(t, err)
+	assert.Empty(t, calls)
+	assert.Equal(t, []string{"four"}, turnNames(f.Context))
+	assert.Equal(t, 3, f.Dropped)
+
+	// One that covers more than there is isn't of this conversation
+	budget.Summary = Summary{Text: "Something else.", Turns: 9}
+	f, err = budget.Fit("system", "prompt", testHistory())
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"one"}, {"About one.", "two"}}, calls)
+	assert.Equal(t, 2, f.Summary.Turns)
+
+	// A summary that can't be had is an error, so the caller can decide
+	budget.Summary = Summary{}
+	budget.Summarize = func([]LLMConversations) (string, error) {
+		return "", errors.New("connection refused")
+	}
+	_, err = budget.Fit("system", "prompt", testHistory())
+	assert.EqualError(t, err, "error summarizing the conversation: connection refused")
+
+	// Without a summarizer, turns are just left out, and there's no need
+	// to leave room for a summary
+	budget.Summarize = nil
+	f, err = budget.Fit("system", "prompt", testHistory())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"two", "three", "four"}, turnNames(f.Context))
+	assert.False(t, f.Summarized)
+}
+
+func TestFitSummarizeTooLong(t *testing.T) {
+	// The model goes on for 100 words when there's room for 20
+	budget := Budget{
+		ContextLength: 80,
+		Strategy:      Summarize,
+		Count:         countWords,
+		Summarize: func([]LLMConversations) (string, error) {
+			return strings.Repeat("blah ", 100), nil
+		},
+	}
+	f, err := budget.Fit("system", "prompt", testHistory())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"three", "four"}, turnNames(f.Context))
+	assert.True(t, f.Summarized)
+	assert.Equal(t, 80, f.Tokens)
+	assert.Equal(t, 80-50-messageOverhead, countWords(f.Context[0].Content))
+	assert.Equal(t, f.Summary.Text, f.Context[0].Content)
+
+	// With no room left at all, it's left out
+	budget.ContextLength = 14
+	f, err = budget.Fit("system", "prompt", testHistory())
+	assert.Nil(t, err)
+	assert.Empty(t, f.Context)
+	assert.False(t, f.Summarized)
+	assert.Equal(t, 10, f.Tokens)
+	assert.Equal(t, 4, f.Dropped)
+}
+
+func TestTranscript(t *testing.T) {
+	history := []LLMConversations{
+		{Role: RoleSummary, Content: "Earlier."},
+		{Role: "user", Content: "Hi"},
+		{Role: "assistant", Content: "Hello"},
+	}
+	assert.Equal(t, "Summary of what came before: Earlier.\n\nUser: Hi\n\nAssistant: Hello\n\n", transcript(history))
+}
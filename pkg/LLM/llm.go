@@ -21,6 +21,8 @@ func LogChat(
 	input_tokens,
 	output_tokens int32,
 	convID int,
+	images []Image,
+	toolCalls ...ToolCall,
 ) error {
 	// TODO: is it necessary to load the file every time? I suppose it's not
 	// the worst since this is a run-once program. But if the log is very
@@ -48,6 +50,8 @@ func LogChat(
 		InputTokens:     input_tokens,
 		OutputTokens:    output_tokens,
 		ConvID:          convID,
+		ToolCalls:       toolCalls,
+		Images:          images,
 	})
 
 	data, err := yaml.Marshal(chat)
@@ -18,7 +18,7 @@ func TestLogChat(t *testing.T) {
 	defer os.Remove(tempFile.Name())
 	defer tempFile.Close()
 
-	err = LogChat(tempFile, "user", "Hello", "gpt-3.5-turbo", contChat, 112, 420, 3)
+	err = LogChat(tempFile, "user", "Hello", "gpt-3.5-turbo", contChat, 112, 420, 3, nil)
 	if err != nil {
 		t.Errorf("LogChat failed: %v", err)
 	}
@@ -1,8 +1,10 @@
 package LLM
 
 import (
+	"encoding/base64"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/duluk/ask-ollama/pkg/linewrap"
 	"github.com/duluk/ask-ollama/pkg/ollama"
@@ -18,62 +20,174 @@ func NewOllama(baseURL string) *Ollama {
 func (cs *Ollama) Chat(args ClientArgs, termWidth int, tabWidth int) (ClientResponse, error) {
 	client := cs.Client
 
-	var msgCtx string
-
+	// The context goes as the messages it was, each turn's images with the
+	// prompt they were sent with (and a note where one has gone since)
+	messages := []ollama.Message{{Role: "system", Content: *args.SystemPrompt}}
 	for _, msg := range args.Context {
-		msg.Role = strings.ToLower(msg.Role)
-		switch msg.Role {
+		switch strings.ToLower(msg.Role) {
 		case "user":
-			msgCtx += "User: " + msg.Content + "\n"
+			content := msg.Content
+			var images []string
+			for _, img := range msg.Images {
+				if img.Data == nil {
+					content += "\n(Image " + img.Path + " was sent here, but isn't available any more)"
+					continue
+				}
+				content += "\n(Image " + img.Path + " was sent here)"
+				images = append(images, encodeImage(img))
+			}
+			messages = append(messages, ollama.Message{Role: "user", Content: content, Images: images})
 		case "assistant":
-			msgCtx += "Assistant: " + msg.Content + "\n"
+			messages = append(messages, ollama.Message{Role: "assistant", Content: msg.Content})
+		case RoleSummary:
+			messages = append(messages, ollama.Message{Role: "system", Content: "Summary of the conversation before this: " + msg.Content})
 		}
 	}
+	messages = append(messages, ollama.Message{Role: "user", Content: *args.Prompt, Images: encodeImages(args.Images)})
 
-	const minTokens = 32768
-	const OllamaModelDeepseekR1_8b = "deepseek-r1:8b"
-	const OllamaModelDeepseekR1_14b = "deepseek-r1:14b"
-
-	myInputEstimate := EstimateTokens(msgCtx + *args.Prompt + *args.SystemPrompt)
-	adjustedMaxTokens := int(myInputEstimate + int32(*args.MaxTokens))
-	req := ollama.ChatCompletionRequest{
-		Model: OllamaModelDeepseekR1_14b,
-		Messages: []ollama.Message{
-			{
-				Role:    "system",
-				Content: *args.SystemPrompt,
-			},
-			{
-				Role:    "assistant",
-				Content: msgCtx,
-			},
-			{
-				Role:    "user",
-				Content: *args.Prompt,
-			},
-		},
-		// Since this is a local model, let's give it some room to cook
-		MaxTokens:   max(adjustedMaxTokens, minTokens),
-		Temperature: float64(*args.Temperature),
+	options := map[string]any{
+		"temperature": float64(*args.Temperature),
+	}
+	if args.MaxTokens != nil && *args.MaxTokens > 0 {
+		options["num_predict"] = *args.MaxTokens
+	}
+	// Without this the server uses its own default, whatever the context
+	// was budgeted for
+	if args.ContextLength > 0 {
+		options["num_ctx"] = args.ContextLength
 	}
 
-	resp, err := client.ChatCompletion(req)
-	if err != nil {
-		return ClientResponse{}, err
+	req := ollama.ChatRequest{
+		Model:    *args.Model,
+		Messages: messages,
+		Stream:   args.Stream,
+		Options:  options,
+		Format:   args.Format,
 	}
 
-	usage := resp.Usage
+	output := args.Output
+	if output == nil {
+		// The wrapper holds on to the last word until it's flushed
+		wrapper := linewrap.NewLineWrapper(termWidth, tabWidth, os.Stdout)
+		defer wrapper.Flush()
+		output = wrapper
+	}
 
-	respText := resp.Choices[0].Message.Content
-	wrapper := linewrap.NewLineWrapper(termWidth, tabWidth, os.Stdout)
+	var splitter reasoningSplitter
+	onChunk := func(chunk ollama.ChatResponse) error {
+		if chunk.Message.Content != "" {
+			if _, err := output.Write([]byte(chunk.Message.Content)); err != nil {
+				return err
+			}
+		}
+		if args.OnChunk == nil {
+			return nil
+		}
 
-	if _, err := wrapper.Write([]byte(respText)); err != nil {
-		return ClientResponse{}, err
+		pieces := []Chunk{}
+		if chunk.Message.Thinking != "" {
+			pieces = append(pieces, Chunk{Text: chunk.Message.Thinking, Reasoning: true})
+		}
+		pieces = append(pieces, splitter.split(chunk.Message.Content)...)
+		if chunk.Done {
+			pieces = append(pieces, splitter.flush()...)
+		}
+		for _, piece := range pieces {
+			if err := args.OnChunk(piece); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// With tools, it may take a few rounds: the model calls some, gets the
+	// results, and carries on, until it answers without calling any
+	var resp *ollama.ChatResponse
+	var respText, thinking string
+	var calls []ToolCall
+	var timings Timings
+	var inputTokens, outputTokens int32
+	start := time.Now()
+	for round := 0; ; round++ {
+		req.Tools = nil
+		if args.Tools != nil && round < args.maxToolRounds() {
+			req.Tools = args.Tools.Definitions()
+		}
+
+		var err error
+		resp, err = client.Chat(req, onChunk)
+		if err != nil {
+			return ClientResponse{}, err
+		}
+
+		if !args.Stream {
+			if _, err := output.Write([]byte(resp.Message.Content)); err != nil {
+				return ClientResponse{}, err
+			}
+		}
+		respText += resp.Message.Content
+		thinking += resp.Message.Thinking
+		timings.add(resp)
+		// Each round's prompt has everything before it, so this counts the
+		// conversation again each time, but that's what was evaluated
+		inputTokens += resp.PromptEvalCount
+		outputTokens += resp.EvalCount
+
+		if len(resp.Message.ToolCalls) == 0 || req.Tools == nil {
+			break
+		}
+		req.Messages = append(req.Messages, resp.Message)
+		for _, tc := range resp.Message.ToolCalls {
+			call := runTool(args.Tools, tc)
+			calls = append(calls, call)
+			if args.OnToolCall != nil {
+				args.OnToolCall(call)
+			}
+			req.Messages = append(req.Messages, call.message())
+		}
+	}
+	if timings.Total == 0 {
+		timings.Total = time.Since(start)
+	}
+
+	reasoning, answer := SplitReasoning(respText)
+	if thinking != "" {
+		reasoning = thinking
+	}
+
+	model := resp.Model
+	if model == "" {
+		model = *args.Model
 	}
 
 	return ClientResponse{
 		Text:         respText,
-		InputTokens:  usage.PromptTokens,
-		OutputTokens: usage.CompletionTokens,
+		Reasoning:    reasoning,
+		Answer:       answer,
+		Model:        model,
+		FinishReason: resp.DoneReason,
+		Timings:      timings,
+		InputTokens:  inputTokens,
+		OutputTokens: outputTokens,
+		ToolCalls:    calls,
 	}, nil
 }
+
+func (t *Timings) add(resp *ollama.ChatResponse) {
+	t.Total += time.Duration(resp.TotalDuration)
+	t.Load += time.Duration(resp.LoadDuration)
+	t.PromptEval += time.Duration(resp.PromptEvalDuration)
+	t.Eval += time.Duration(resp.EvalDuration)
+}
+
+func encodeImage(img Image) string {
+	return base64.StdEncoding.EncodeToString(img.Data)
+}
+
+func encodeImages(images []Image) []string {
+	var encoded []string
+	for _, img := range images {
+		encoded = append(encoded, encodeImage(img))
+	}
+	return encoded
+}
@@ -0,0 +1,126 @@
+package LLM
+
+import (
+	"strings"
+)
+
+// Reasoning models like deepseek-r1 start their answer with their "thinking"
+// wrapped in <think></think>. Newer Ollama versions can return it separately
+// (message.thinking), but older ones leave it in the content.
+const (
+	thinkOpen  = "<think>"
+	thinkClose = "</think>"
+)
+
+// SplitReasoning separates the <think> block at the start of a response from
+// the answer itself.
+func SplitReasoning(text string) (reasoning, answer string) {
+	trimmed := strings.TrimLeft(text, " \t\r\n")
+	if !strings.HasPrefix(trimmed, thinkOpen) {
+		return "", text
+	}
+
+	rest := trimmed[len(thinkOpen):]
+	end := strings.Index(rest, thinkClose)
+	if end < 0 {
+		// Never closed; it's all reasoning (probably ran out of tokens)
+		return strings.TrimSpace(rest), ""
+	}
+
+	return strings.TrimSpace(rest[:end]), strings.TrimLeft(rest[end+len(thinkClose):], " \t\r\n")
+}
+
+// reasoningSplitter does the same as SplitReasoning for a response that
+// arrives in pieces, where a tag may well be split between two of them.
+type reasoningSplitter struct {
+	// Text that might be the start of a tag, held until we know
+	held    string
+	started bool
+	inThink bool
+	done    bool
+	// Whitespace between </think> and the answer is dropped, even if it
+	// arrives in later pieces
+	trimming bool
+}
+
+// split returns the chunks in piece, in order, each marked as reasoning or not
+func (rs *reasoningSplitter) split(piece string) []Chunk {
+	var chunks []Chunk
+	text := rs.held + piece
+	rs.held = ""
+
+	for text != "" {
+		if rs.done {
+			if rs.trimming {
+				text = strings.TrimLeft(text, " \t\r\n")
+				if text == "" {
+					break
+				}
+				rs.trimming = false
+			}
+			chunks = append(chunks, Chunk{Text: text})
+			break
+		}
+
+		if !rs.started {
+			// Only a <think> at the very start counts
+			trimmed := strings.TrimLeft(text, " \t\r\n")
+			if trimmed == "" || (len(trimmed) < len(thinkOpen) && strings.HasPrefix(thinkOpen, trimmed)) {
+				rs.held = text
+				break
+			}
+			rs.started = true
+			if strings.HasPrefix(trimmed, thinkOpen) {
+				rs.inThink = true
+				text = trimmed[len(thinkOpen):]
+				continue
+			}
+			rs.done = true
+			continue
+		}
+
+		// In the <think> block: look for the end of it
+		end := strings.Index(text, thinkClose)
+		if end >= 0 {
+			if end > 0 {
+				chunks = append(chunks, Chunk{Text: text[:end], Reasoning: true})
+			}
+			rs.inThink = false
+			rs.done = true
+			rs.trimming = true
+			text = text[end+len(thinkClose):]
+			continue
+		}
+
+		// Hold back anything that could be the start of </think>
+		keep := partialSuffix(text, thinkClose)
+		if len(text)-keep > 0 {
+			chunks = append(chunks, Chunk{Text: text[:len(text)-keep], Reasoning: true})
+		}
+		rs.held = text[len(text)-keep:]
+		break
+	}
+
+	return chunks
+}
+
+// flush returns whatever was being held back when the response ends
+func (rs *reasoningSplitter) flush() []Chunk {
+	if rs.held == "" {
+		return nil
+	}
+	held := rs.held
+	rs.held = ""
+	return []Chunk{{Text: held, Reasoning: rs.inThink}}
+}
+
+// partialSuffix returns the length of the longest suffix of s that is a
+// prefix of tag
+func partialSuffix(s, tag string) int {
+	for n := min(len(s), len(tag)-1); n > 0; n-- {
+		if strings.HasSuffix(s, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
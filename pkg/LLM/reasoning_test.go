@@ -0,0 +1,66 @@
+package LLM
+
+import (
+	"testing"
+)
+
+func TestSplitReasoning(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		reasoning string
+		answer    string
+	}{
+		{"no reasoning", "Just an answer", "", "Just an answer"},
+		{"think block", "<think>\nHmm, let me see.\n</think>\n\nThe answer is 3.", "Hmm, let me see.", "The answer is 3."},
+		{"leading whitespace", "\n  <think>x</think>y", "x", "y"},
+		{"never closed", "<think>still thinking", "still thinking", ""},
+		{"think later on is part of the answer", "Use <think> tags", "", "Use <think> tags"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reasoning, answer := SplitReasoning(tt.text)
+			if reasoning != tt.reasoning || answer != tt.answer {
+				t.Errorf("got (%q, %q), want (%q, %q)", reasoning, answer, tt.reasoning, tt.answer)
+			}
+		})
+	}
+}
+
+func TestReasoningSplitter(t *testing.T) {
+	text := "<think>\nHmm, 1 < 2.\n</think>\n\nThe answer is <b>3</b>."
+
+	// However the text is chunked, the reasoning and answer should come out
+	// the same as splitting it all at once
+	for _, size := range []int{1, 2, 3, 5, 8, len(text)} {
+		var rs reasoningSplitter
+		var reasoning, answer string
+		collect := func(chunks []Chunk) {
+			for _, c := range chunks {
+				if c.Reasoning {
+					reasoning += c.Text
+				} else {
+					answer += c.Text
+				}
+			}
+		}
+		for i := 0; i < len(text); i += size {
+			collect(rs.split(text[i:min(i+size, len(text))]))
+		}
+		collect(rs.flush())
+
+		if reasoning != "\nHmm, 1 < 2.\n" || answer != "The answer is <b>3</b>." {
+			t.Errorf("chunk size %d: got reasoning %q, answer %q", size, reasoning, answer)
+		}
+	}
+
+	var rs reasoningSplitter
+	chunks := append(rs.split("No "), rs.split("thinking")...)
+	chunks = append(chunks, rs.flush()...)
+	for _, c := range chunks {
+		if c.Reasoning {
+			t.Errorf("unexpected reasoning chunk: %q", c.Text)
+		}
+	}
+}
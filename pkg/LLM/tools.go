@@ -0,0 +1,75 @@
+package LLM
+
+// Tool calling. A model that's given tools can answer with calls to them
+// instead of (or before) an actual answer. They're run here, the results go
+// back to it as "tool" messages, and it carries on from there.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/duluk/ask-ollama/pkg/ollama"
+)
+
+// DefaultToolRounds is how many rounds of tool calls a model gets, unless
+// it's told otherwise, before it has to answer with what it has
+const DefaultToolRounds = 8
+
+// Toolbox is the tools a model can call
+type Toolbox interface {
+	Definitions() []ollama.Tool
+	Call(name string, args map[string]any) (string, error)
+}
+
+// ToolCall is a call the model made and what came of it
+type ToolCall struct {
+	Name      string         `yaml:"name" json:"name"`
+	Arguments map[string]any `yaml:"arguments,omitempty" json:"arguments,omitempty"`
+	Result    string         `yaml:"result,omitempty" json:"result,omitempty"`
+	// Why it failed, if it did. The model is told, so it can try again.
+	Error string `yaml:"error,omitempty" json:"error,omitempty"`
+}
+
+// String shows the call the way a person would write it, for showing what
+// the model is doing
+func (c ToolCall) String() string {
+	keys := make([]string, 0, len(c.Arguments))
+	for k := range c.Arguments {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var args []string
+	for _, k := range keys {
+		args = append(args, fmt.Sprintf("%s=%q", k, fmt.Sprint(c.Arguments[k])))
+	}
+	return c.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+func runTool(tools Toolbox, tc ollama.ToolCall) ToolCall {
+	call := ToolCall{Name: tc.Function.Name, Arguments: tc.Function.Arguments}
+	result, err := tools.Call(call.Name, call.Arguments)
+	if err != nil {
+		call.Error = err.Error()
+	} else {
+		call.Result = result
+	}
+	return call
+}
+
+// message is the result of the call, to go back to the model
+func (c ToolCall) message() ollama.Message {
+	content := c.Result
+	if c.Error != "" {
+		content = "Error: " + c.Error
+	}
+	return ollama.Message{Role: "tool", Content: content, ToolName: c.Name}
+}
+
+func (args *ClientArgs) maxToolRounds() int {
+	if args.MaxToolRounds > 0 {
+		return args.MaxToolRounds
+	}
+	return DefaultToolRounds
+}
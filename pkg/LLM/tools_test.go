@@ -0,0 +1,115 @@
+package LLM
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/duluk/ask-ollama/pkg/ollama"
+)
+
+// A toolbox with one tool, add, which fails for negative numbers
+type adder struct{}
+
+func (adder) Definitions() []ollama.Tool {
+	return []ollama.Tool{{Type: "function", Function: ollama.ToolFunction{Name: "add"}}}
+}
+
+func (adder) Call(name string, args map[string]any) (string, error) {
+	a, _ := args["a"].(float64)
+	b, _ := args["b"].(float64)
+	if a < 0 || b < 0 {
+		return "", fmt.Errorf("only positive numbers")
+	}
+	return fmt.Sprint(a + b), nil
+}
+
+// toolServer answers with the calls in calls, one round at a time, then
+// with "Done" once they've run out (or it isn't sent any tools). Each
+// request's messages are kept.
+func toolServer(t *testing.T, calls []string, requests *[]ollama.ChatRequest) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollama.ChatRequest
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+		*requests = append(*requests, req)
+
+		round := len(*requests) - 1
+		if req.Tools == nil || round >= len(calls) {
+			fmt.Fprint(w, `{"message":{"role":"assistant","content":"Done"},"done":true,"prompt_eval_count":10,"eval_count":1}`)
+			return
+		}
+		fmt.Fprintf(w, `{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"add","arguments":%s}}]},"done":true,"prompt_eval_count":10,"eval_count":5}`, calls[round])
+	}))
+}
+
+func toolArgs(baseURL string, rounds int) ClientArgs {
+	model, prompt, system := "llama3.1", "What's 1 + 2?", "You add."
+	temperature := float32(0)
+	return ClientArgs{
+		BaseURL:       &baseURL,
+		Model:         &model,
+		Prompt:        &prompt,
+		SystemPrompt:  &system,
+		Temperature:   &temperature,
+		Output:        &bytes.Buffer{},
+		Tools:         adder{},
+		MaxToolRounds: rounds,
+	}
+}
+
+func TestChatWithTools(t *testing.T) {
+	var requests []ollama.ChatRequest
+	server := toolServer(t, []string{`{"a":1,"b":2}`, `{"a":-1,"b":2}`}, &requests)
+	defer server.Close()
+
+	var seen []ToolCall
+	args := toolArgs(server.URL, 0)
+	args.OnToolCall = func(call ToolCall) { seen = append(seen, call) }
+
+	resp, err := NewOllama(server.URL).Chat(args, 80, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, "Done", resp.Answer)
+	assert.Equal(t, int32(30), resp.InputTokens)
+	assert.Equal(t, int32(11), resp.OutputTokens)
+
+	expected := []ToolCall{
+		{Name: "add", Arguments: map[string]any{"a": 1.0, "b": 2.0}, Result: "3"},
+		{Name: "add", Arguments: map[string]any{"a": -1.0, "b": 2.0}, Error: "only positive numbers"},
+	}
+	assert.Equal(t, expected, resp.ToolCalls)
+	assert.Equal(t, expected, seen)
+
+	// Each round is sent what came before it, results and all
+	assert.Len(t, requests, 3)
+	last := requests[2].Messages
+	assert.Len(t, last, 6)
+	assert.Equal(t, "add", last[2].ToolCalls[0].Function.Name)
+	assert.Equal(t, ollama.Message{Role: "tool", Content: "3", ToolName: "add"}, last[3])
+	assert.Equal(t, ollama.Message{Role: "tool", Content: "Error: only positive numbers", ToolName: "add"}, last[5])
+}
+
+func TestChatToolRounds(t *testing.T) {
+	// A model that would call tools forever is made to answer
+	var requests []ollama.ChatRequest
+	server := toolServer(t, []string{`{"a":1}`, `{"a":2}`, `{"a":3}`, `{"a":4}`}, &requests)
+	defer server.Close()
+
+	resp, err := NewOllama(server.URL).Chat(toolArgs(server.URL, 2), 80, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, "Done", resp.Answer)
+	assert.Len(t, resp.ToolCalls, 2)
+	assert.Len(t, requests, 3)
+	assert.NotNil(t, requests[1].Tools)
+	assert.Nil(t, requests[2].Tools)
+}
+
+func TestToolCallString(t *testing.T) {
+	call := ToolCall{Name: "read_file", Arguments: map[string]any{"path": "main.go", "limit": 3.0}}
+	assert.Equal(t, `read_file(limit="3", path="main.go")`, call.String())
+	assert.Equal(t, "list_directory()", ToolCall{Name: "list_directory"}.String())
+}
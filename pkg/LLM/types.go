@@ -1,27 +1,69 @@
 package LLM
 
 import (
+	"encoding/json"
+	"io"
 	"os"
+	"time"
 
 	"github.com/duluk/ask-ollama/pkg/ollama"
 )
 
 type LLMConversations struct {
-	Role            string `yaml:"role"`
-	Content         string `yaml:"content"`
-	Model           string `yaml:"model"`
-	Timestamp       string `yaml:"timestamp"`
-	NewConversation bool   `yaml:"new_conversation"`
-	InputTokens     int32  `yaml:"input_tokens"`
-	OutputTokens    int32  `yaml:"output_tokens"`
-	ConvID          int    `yaml:"conv_id"`
+	Role            string `yaml:"role" json:"role"`
+	Content         string `yaml:"content" json:"content"`
+	Model           string `yaml:"model" json:"model"`
+	Timestamp       string `yaml:"timestamp" json:"timestamp"`
+	NewConversation bool   `yaml:"new_conversation" json:"new_conversation"`
+	InputTokens     int32  `yaml:"input_tokens" json:"input_tokens"`
+	OutputTokens    int32  `yaml:"output_tokens" json:"output_tokens"`
+	ConvID          int    `yaml:"conv_id" json:"conv_id"`
+	// Files that were included with a user prompt
+	Attachments []string `yaml:"attachments,omitempty" json:"attachments,omitempty"`
+	// Tools the model called on the way to an answer
+	ToolCalls []ToolCall `yaml:"tool_calls,omitempty" json:"tool_calls,omitempty"`
+	// Images that were sent with a user prompt
+	Images []Image `yaml:"images,omitempty" json:"images,omitempty"`
+}
+
+// Image is a picture sent with a prompt, for models that can see. Only its
+// path and hash are kept; when a conversation is continued, it's read again
+// (if it's still there and hasn't changed) to be sent again.
+type Image struct {
+	Path string `yaml:"path" json:"path"`
+	// sha256 of the file, in hex
+	Hash string `yaml:"hash" json:"hash"`
+	// The image itself, if it's to be sent
+	Data []byte `yaml:"-" json:"-"`
 }
 
 type ClientResponse struct {
-	Text         string
+	// Everything the model said, including any reasoning
+	Text string
+	// Text split into the model's reasoning and its actual answer
+	Reasoning    string
+	Answer       string
+	Model        string
+	FinishReason string
+	Timings      Timings
 	InputTokens  int32
 	OutputTokens int32
 	MyEstInput   int32 // May be used at some point
+	// The tools the model called on the way to its answer
+	ToolCalls []ToolCall
+}
+
+type Timings struct {
+	Total      time.Duration
+	Load       time.Duration
+	PromptEval time.Duration
+	Eval       time.Duration
+}
+
+// A piece of a streamed answer
+type Chunk struct {
+	Text      string
+	Reasoning bool
 }
 
 type Client interface {
@@ -42,6 +84,25 @@ type ClientArgs struct {
 	Context      []LLMConversations
 	MaxTokens    *int
 	Temperature  *float32
-	Log          *os.File
-	ConvID       *int
+	// The model's context window (num_ctx); the server's default if 0
+	ContextLength int
+	Log           *os.File
+	ConvID        *int
+	Attachments   []string
+	// Images to send with the prompt
+	Images []Image
+	// Where the answer is written as it comes in; stdout (wrapped) if nil
+	Output io.Writer
+	// Stream the answer as it's generated rather than waiting for all of it.
+	// OnChunk, if set, is also called with each piece.
+	Stream  bool
+	OnChunk func(Chunk) error
+	// Tools the model may call, and the most rounds of calls it gets before
+	// it has to answer (DefaultToolRounds if 0). OnToolCall, if set, is
+	// called after each one.
+	Tools         Toolbox
+	MaxToolRounds int
+	OnToolCall    func(ToolCall)
+	// Ollama's format: "json" (quoted, as it's JSON) or a JSON schema
+	Format json.RawMessage
 }
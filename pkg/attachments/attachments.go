@@ -0,0 +1,184 @@
+package attachments
+
+// Files (and piped stdin) that get included with a prompt. Each attachment is
+// wrapped in a header/footer so the model can tell where one file ends and the
+// next begins, e.g.:
+//
+//	--- BEGIN FILE: main.go ---
+//	package main
+//	...
+//	--- END FILE: main.go ---
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Name used for content read from stdin
+const StdinName = "<stdin>"
+
+// 1MB per file is already a lot of tokens for a local model
+const DefaultMaxSize = 1024 * 1024
+
+// How much of a file to look at when deciding if it's binary
+const sniffLen = 8000
+
+type Attachment struct {
+	Path    string
+	Content string
+	Size    int64
+}
+
+// Files that matched a pattern but weren't attached, and why
+type Skipped struct {
+	Path   string
+	Reason string
+}
+
+// Load expands each pattern (a plain path or a glob) and reads the matching
+// files. Binary files, directories and files larger than maxSize are skipped
+// rather than failing the whole request, since a glob like `src/*` may well
+// pick some of those up. A pattern that matches nothing is an error, though,
+// as that's almost always a typo.
+func Load(patterns []string, maxSize int64) ([]Attachment, []Skipped, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+
+	var atts []Attachment
+	var skipped []Skipped
+	seen := make(map[string]bool)
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid file pattern %q: %v", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, nil, fmt.Errorf("no files match %q", pattern)
+		}
+
+		for _, path := range matches {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+
+			att, reason, err := loadFile(path, maxSize)
+			if err != nil {
+				return nil, nil, err
+			}
+			if reason != "" {
+				skipped = append(skipped, Skipped{Path: path, Reason: reason})
+				continue
+			}
+			atts = append(atts, att)
+		}
+	}
+
+	return atts, skipped, nil
+}
+
+func loadFile(path string, maxSize int64) (Attachment, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Attachment{}, "", fmt.Errorf("error reading %s: %v", path, err)
+	}
+	if info.IsDir() {
+		return Attachment{}, "is a directory", nil
+	}
+	if info.Size() > maxSize {
+		return Attachment{}, fmt.Sprintf("too large (%d bytes, limit is %d)", info.Size(), maxSize), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Attachment{}, "", fmt.Errorf("error reading %s: %v", path, err)
+	}
+	if IsBinary(data) {
+		return Attachment{}, "looks like a binary file", nil
+	}
+
+	return Attachment{Path: path, Content: string(data), Size: info.Size()}, "", nil
+}
+
+// ReadStdin reads everything piped in, up to maxSize bytes. If more than that
+// is available, it's an error rather than silently truncating the input.
+func ReadStdin(r io.Reader, maxSize int64) (Attachment, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return Attachment{}, fmt.Errorf("error reading stdin: %v", err)
+	}
+	if int64(len(data)) > maxSize {
+		return Attachment{}, fmt.Errorf("stdin is larger than the limit of %d bytes", maxSize)
+	}
+	if IsBinary(data) {
+		return Attachment{}, fmt.Errorf("stdin looks like binary data")
+	}
+
+	return Attachment{Path: StdinName, Content: string(data), Size: int64(len(data))}, nil
+}
+
+// IsBinary uses the same trick as git and grep: a NUL byte near the start
+// means binary. Invalid UTF-8 or a non-text content type counts as well.
+func IsBinary(data []byte) bool {
+	sniff := data
+	if len(sniff) > sniffLen {
+		sniff = sniff[:sniffLen]
+	}
+
+	if bytes.IndexByte(sniff, 0) != -1 {
+		return true
+	}
+
+	// The sniffed slice may end in the middle of a rune, so only hold the
+	// whole thing to UTF-8 if it was read in full
+	if len(data) <= sniffLen && !utf8.Valid(data) {
+		return true
+	}
+
+	contentType := http.DetectContentType(sniff)
+	return !strings.HasPrefix(contentType, "text/") &&
+		!strings.Contains(contentType, "json") &&
+		!strings.Contains(contentType, "xml")
+}
+
+// BuildPrompt appends each attachment to the prompt with a header and footer.
+// With no prompt (eg, `cat file | ask-ollama`), the attachments are the prompt.
+func BuildPrompt(prompt string, atts []Attachment) string {
+	var sb strings.Builder
+
+	sb.WriteString(prompt)
+	for _, att := range atts {
+		if sb.Len() > 0 {
+			sb.WriteString("\n\n")
+		}
+		fmt.Fprintf(&sb, "--- BEGIN FILE: %s ---\n", att.Path)
+		sb.WriteString(att.Content)
+		if !strings.HasSuffix(att.Content, "\n") {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "--- END FILE: %s ---", att.Path)
+	}
+
+	return sb.String()
+}
+
+// Paths returns the names of the attachments, for recording in the log/DB
+func Paths(atts []Attachment) []string {
+	paths := make([]string, 0, len(atts))
+	for _, att := range atts {
+		paths = append(paths, att.Path)
+	}
+	return paths
+}
@@ -0,0 +1,91 @@
+package attachments
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	mainGo := writeFile(t, dir, "main.go", []byte("package main\n"))
+	goMod := writeFile(t, dir, "go.mod", []byte("module example\n"))
+	writeFile(t, dir, "util.go", []byte("package main\n\nfunc util() {}\n"))
+	writeFile(t, dir, "image.bin", []byte{0x89, 'P', 'N', 'G', 0x00, 0x01})
+	writeFile(t, dir, "big.go", []byte(strings.Repeat("x", 200)))
+
+	t.Run("plain paths", func(t *testing.T) {
+		atts, skipped, err := Load([]string{mainGo, goMod}, 100)
+		assert.Nil(t, err)
+		assert.Empty(t, skipped)
+		assert.Equal(t, []string{mainGo, goMod}, Paths(atts))
+		assert.Equal(t, "package main\n", atts[0].Content)
+	})
+
+	t.Run("glob skips big files and duplicates", func(t *testing.T) {
+		atts, skipped, err := Load([]string{filepath.Join(dir, "*.go"), mainGo}, 100)
+		assert.Nil(t, err)
+		assert.Len(t, atts, 2)
+		assert.Len(t, skipped, 1)
+		assert.Equal(t, filepath.Join(dir, "big.go"), skipped[0].Path)
+		assert.Contains(t, skipped[0].Reason, "too large")
+	})
+
+	t.Run("binary files are skipped", func(t *testing.T) {
+		atts, skipped, err := Load([]string{filepath.Join(dir, "image.bin")}, 100)
+		assert.Nil(t, err)
+		assert.Empty(t, atts)
+		assert.Len(t, skipped, 1)
+	})
+
+	t.Run("no match is an error", func(t *testing.T) {
+		_, _, err := Load([]string{filepath.Join(dir, "*.rb")}, 100)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestReadStdin(t *testing.T) {
+	att, err := ReadStdin(strings.NewReader("diff --git a/x b/x\n"), 100)
+	assert.Nil(t, err)
+	assert.Equal(t, StdinName, att.Path)
+	assert.Equal(t, "diff --git a/x b/x\n", att.Content)
+
+	_, err = ReadStdin(strings.NewReader(strings.Repeat("x", 101)), 100)
+	assert.NotNil(t, err)
+}
+
+func TestIsBinary(t *testing.T) {
+	assert.False(t, IsBinary([]byte("hello, world\n")))
+	assert.False(t, IsBinary([]byte("héllo wörld ✓\n")))
+	assert.False(t, IsBinary([]byte(`{"key": "value"}`)))
+	assert.False(t, IsBinary([]byte{}))
+	assert.True(t, IsBinary([]byte("abc\x00def")))
+	assert.True(t, IsBinary([]byte{0xff, 0xfe, 0xfd}))
+}
+
+func TestBuildPrompt(t *testing.T) {
+	atts := []Attachment{
+		{Path: "main.go", Content: "package main\n"},
+		{Path: "go.mod", Content: "module example"},
+	}
+
+	expected := "explain\n\n" +
+		"--- BEGIN FILE: main.go ---\npackage main\n--- END FILE: main.go ---\n\n" +
+		"--- BEGIN FILE: go.mod ---\nmodule example\n--- END FILE: go.mod ---"
+	assert.Equal(t, expected, BuildPrompt("explain", atts))
+
+	assert.Equal(t, "explain", BuildPrompt("explain", nil))
+	assert.True(t, strings.HasPrefix(BuildPrompt("", atts), "--- BEGIN FILE: main.go ---"))
+}
@@ -0,0 +1,95 @@
+package attachments
+
+// Images sent with a prompt, for models that can see (llava,
+// llama3.2-vision...). Unlike files, they aren't put in the prompt; they go
+// to Ollama alongside it.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Screenshots and photos are a lot bigger than text, but anything past this
+// is more than a local model will make use of
+const DefaultMaxImageSize = 10 * 1024 * 1024
+
+// The types Ollama can decode, as http.DetectContentType names them
+var imageTypes = []string{"image/png", "image/jpeg", "image/webp"}
+
+type Image struct {
+	Path string
+	// What it was detected as, from imageTypes
+	Type string
+	// The sha256 of its contents, in hex, to tell if it's changed since
+	Hash string
+	Data []byte
+}
+
+// LoadImages reads the images at paths. Unlike files, anything that can't
+// be sent (isn't an image, or is too big) is an error, since each one was
+// named on purpose.
+func LoadImages(paths []string, maxSize int64) ([]Image, error) {
+	var images []Image
+	for _, path := range paths {
+		img, err := LoadImage(path, maxSize)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+func LoadImage(path string, maxSize int64) (Image, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxImageSize
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return Image{}, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	if info.IsDir() {
+		return Image{}, fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > maxSize {
+		return Image{}, fmt.Errorf("%s is too large (%d bytes, limit is %d)", path, info.Size(), maxSize)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Image{}, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	contentType := http.DetectContentType(data)
+	if !isImageType(contentType) {
+		return Image{}, fmt.Errorf("%s isn't a PNG, JPEG or WebP image (it looks like %s)", path, contentType)
+	}
+
+	// Kept as an absolute path, so it can be found again when the
+	// conversation is continued from somewhere else
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return Image{}, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	return Image{Path: abs, Type: contentType, Hash: Hash(data), Data: data}, nil
+}
+
+func isImageType(contentType string) bool {
+	for _, t := range imageTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Hash is how an image is recognized later
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
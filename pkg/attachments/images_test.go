@@ -0,0 +1,42 @@
+package attachments
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Enough of a PNG for its type to be detected
+var png = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestLoadImages(t *testing.T) {
+	dir := t.TempDir()
+	pic := writeFile(t, dir, "pic.png", png)
+	text := writeFile(t, dir, "notes.txt", []byte("Buy milk\n"))
+	big := writeFile(t, dir, "big.png", append(png, make([]byte, 100)...))
+
+	images, err := LoadImages([]string{pic}, 100)
+	assert.Nil(t, err)
+	assert.Len(t, images, 1)
+	assert.Equal(t, pic, images[0].Path)
+	assert.Equal(t, "image/png", images[0].Type)
+	assert.Equal(t, png, images[0].Data)
+	assert.Equal(t, Hash(png), images[0].Hash)
+	assert.Len(t, images[0].Hash, 64)
+
+	for _, test := range []struct {
+		path string
+		err  string
+	}{
+		{text, text + " isn't a PNG, JPEG or WebP image (it looks like text/plain; charset=utf-8)"},
+		{big, fmt.Sprintf("%s is too large (%d bytes, limit is 100)", big, len(png)+100)},
+		{dir, dir + " is a directory"},
+	} {
+		_, err := LoadImages([]string{pic, test.path}, 100)
+		assert.EqualError(t, err, test.err)
+	}
+
+	_, err = LoadImage(dir+"/missing.png", 100)
+	assert.ErrorContains(t, err, "error reading")
+}
@@ -0,0 +1,921 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/duluk/ask-ollama/pkg/LLM"
+	"github.com/duluk/ask-ollama/pkg/attachments"
+	"github.com/duluk/ask-ollama/pkg/config"
+	"github.com/duluk/ask-ollama/pkg/database"
+	"github.com/duluk/ask-ollama/pkg/linewrap"
+	"github.com/duluk/ask-ollama/pkg/ollama"
+	"github.com/duluk/ask-ollama/pkg/output"
+	"github.com/duluk/ask-ollama/pkg/rag"
+	"github.com/duluk/ask-ollama/pkg/render"
+	"github.com/duluk/ask-ollama/pkg/tokenizer"
+	"github.com/duluk/ask-ollama/pkg/tools"
+)
+
+var askCommand = &Command{
+	Name:    "ask",
+	Args:    "[prompt]",
+	Summary: "Ask a model a question",
+	Description: `
+Anything piped in is attached to the prompt, or is the prompt if none is
+given. With no prompt at all, this starts a chat. The command name can be
+left off, as in: ask-ollama "Why is the sky blue?"`,
+	Flags: func(fs *pflag.FlagSet) {
+		promptFlags(fs)
+		// From before there were subcommands
+		fs.IntP("show", "s", 0, "Show conversation")
+		fs.MarkDeprecated("show", "use `ask-ollama show <id>`")
+		fs.BoolP("dump-config", "d", false, "Dump configuration")
+		fs.MarkDeprecated("dump-config", "use `ask-ollama config dump`")
+	},
+	Run: runAsk,
+}
+
+var chatCommand = &Command{
+	Name:    "chat",
+	Summary: "Chat with a model, one prompt after another",
+	Description: `
+Type /help at the prompt for the special commands.`,
+	Flags: promptFlags,
+	Run:   runChat,
+}
+
+func runAsk(ctx *Context) error {
+	if id := ctx.flagInt("show"); id != 0 {
+		return showConversation(ctx, id)
+	}
+	if ctx.flagBool("dump-config") {
+		ctx.Config.DumpConfig(ctx.Stdout)
+		return nil
+	}
+	if len(ctx.Args) > 1 {
+		return usageErrorf("the prompt should be a single argument (put it in quotes)")
+	}
+
+	s, err := newSession(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	// When something is piped in (`git diff | ask-ollama "review this"`), it
+	// is attached to the prompt; with no prompt argument, it is the prompt.
+	// Either way there's no point starting the REPL.
+	var stdinPrompt string
+	stdinPiped := ctx.stdinPiped()
+	if stdinPiped {
+		// So there's no one to ask about tool calls
+		if s.tools != nil {
+			s.tools.Confirm = nil
+		}
+		stdin, err := attachments.ReadStdin(ctx.Stdin, ctx.Config.General.MaxAttachmentSize)
+		if err != nil {
+			return err
+		}
+		if len(ctx.Args) > 0 {
+			// Nothing piped in (`< /dev/null`, or cron) isn't worth attaching
+			if strings.TrimSpace(stdin.Content) != "" {
+				s.atts = append(s.atts, stdin)
+			}
+		} else {
+			stdinPrompt = strings.TrimSpace(stdin.Content)
+		}
+	}
+
+	if len(ctx.Args) == 0 && !stdinPiped {
+		return s.repl()
+	}
+
+	prompt := stdinPrompt
+	if len(ctx.Args) > 0 {
+		prompt = ctx.Args[0]
+	}
+	if prompt == "" && len(s.atts) == 0 {
+		return fmt.Errorf("no prompt provided")
+	}
+
+	return s.ask(prompt)
+}
+
+func runChat(ctx *Context) error {
+	if len(ctx.Args) > 0 {
+		return usageErrorf("chat doesn't take a prompt; use ask")
+	}
+
+	s, err := newSession(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	return s.repl()
+}
+
+// stdinPiped reports whether there's something to read on stdin: a pipe or
+// a file, rather than a terminal, or whatever else was left open (which
+// could block forever)
+func (ctx *Context) stdinPiped() bool {
+	if f, ok := ctx.Stdin.(*os.File); ok {
+		info, err := f.Stat()
+		if err != nil {
+			return false
+		}
+		return info.Mode()&os.ModeNamedPipe != 0 || info.Mode().IsRegular()
+	}
+	return ctx.Stdin != nil
+}
+
+// A session is everything needed to send prompts for one conversation: the
+// log and database it's recorded in, the context loaded for it, and any files
+// to attach to the next prompt
+type session struct {
+	ctx  *Context
+	conf *config.Config
+
+	logFd *os.File
+	db    *database.ChatDB
+
+	model      string
+	clientArgs LLM.ClientArgs
+	// The role's system prompt, before anything recalled is added to it
+	systemPrompt  string
+	promptContext []LLM.LLMConversations
+	atts          []attachments.Attachment
+	// Images to send with the next prompt
+	images []attachments.Image
+	// Images from earlier in the conversation that can't be sent again,
+	// so they're only mentioned once
+	lostImages map[string]bool
+	// How the context was fitted for the last prompt, for /context
+	fitted    *LLM.Fitted
+	tokenizer tokenizer.Tokenizer
+	// With --tools, the tools the model can call
+	tools *tools.Registry
+	// With --format or --schema, what the answer has to be
+	format *answerFormat
+	// With --rag, the index excerpts are found in
+	index *rag.Index
+	// Prompts, and answers to questions about tool calls, are read from here
+	reader *bufio.Reader
+
+	stopWatching func()
+}
+
+func newSession(ctx *Context) (*session, error) {
+	var err error
+	conf := ctx.Config
+	s := &session{ctx: ctx, conf: conf, reader: bufio.NewReader(ctx.Stdin)}
+
+	err = os.MkdirAll(filepath.Dir(conf.Logging.LogFile), 0755)
+	if err != nil {
+		return nil, fmt.Errorf("error creating log directory: %v", err)
+	}
+
+	s.logFd, err = os.OpenFile(conf.Logging.LogFile, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		fmt.Fprintln(ctx.Stderr, "Error with chat log file: ", err)
+	}
+
+	s.db, err = openDB(ctx)
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+
+	s.stopWatching = watchScreenSize(&conf.Opts)
+
+	s.model = conf.Opts.Model
+
+	/* CONTEXT? LOAD IT */
+	if conf.Opts.ConversationID != 0 {
+		// The user may provide `--continue` along with `--id`, but that's fine
+		// (and sensible). The intent is to load the one with the provided id.
+		s.promptContext, err = s.db.LoadConversationFromDB(conf.Opts.ConversationID)
+		if err != nil {
+			fmt.Fprintln(ctx.Stderr, "Error loading conversation from database: ", err)
+		}
+		if !ctx.flagChanged("model") && len(s.promptContext) > 0 {
+			s.model = s.promptContext[len(s.promptContext)-1].Model
+		}
+	} else if conf.Opts.ContinueChat {
+		s.promptContext, err = LLM.ContinueConversation(s.logFd)
+		if err != nil {
+			fmt.Fprintln(ctx.Stderr, "Error reading log for continuing chat: ", err)
+		}
+		if !ctx.flagChanged("model") && len(s.promptContext) > 0 {
+			s.model = s.promptContext[len(s.promptContext)-1].Model
+		}
+	}
+	s.reloadImages(s.promptContext)
+
+	if len(conf.Opts.Images) > 0 {
+		s.images, err = attachments.LoadImages(conf.Opts.Images, conf.General.MaxImageSize)
+		if err != nil {
+			s.close()
+			return nil, fmt.Errorf("error attaching images: %v", err)
+		}
+	}
+
+	if len(conf.Opts.RAG) > 0 {
+		if err := s.openRAG(); err != nil {
+			s.close()
+			return nil, err
+		}
+	}
+
+	systemPrompt, err := rolePrompt(conf)
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+
+	s.systemPrompt = systemPrompt
+	s.clientArgs = LLM.ClientArgs{
+		BaseURL:      &conf.General.BaseURL,
+		SystemPrompt: &systemPrompt,
+		Context:      s.promptContext,
+		Log:          s.logFd,
+	}
+	if conf.Opts.Tools {
+		s.tools, err = tools.Builtin(conf.Tools.Enabled, tools.Options{
+			MaxFileSize: conf.General.MaxAttachmentSize,
+			Paths:       conf.Tools.Paths,
+			Commands:    conf.Tools.Commands,
+			DB:          s.db,
+			Policies:    conf.Tools.Policies(),
+			Timeout:     time.Duration(conf.Tools.Timeout) * time.Second,
+			MaxOutput:   conf.Tools.MaxOutput,
+		})
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		s.tools.Confirm = s.confirmToolCall
+		s.tools.Audit = s.auditToolCall
+		s.clientArgs.Tools = s.tools
+		s.clientArgs.MaxToolRounds = conf.Tools.MaxRounds
+		s.clientArgs.OnToolCall = s.showToolCall
+	}
+	s.format, err = newAnswerFormat(conf.Opts.Format, conf.Opts.Schema)
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+	if s.format != nil {
+		s.clientArgs.Format = s.format.ollama
+	}
+	// A conversation being continued has the model's tag, which finds its
+	// entry in the config (if there is one) the same as --model would
+	if err := s.useModel(s.model); err != nil {
+		s.close()
+		return nil, err
+	}
+
+	// Make sure we are setting the correct conversation id when not provided
+	if conf.Opts.ConversationID == 0 {
+		s.clientArgs.ConvID = LLM.FindLastConversationID(s.logFd)
+		if s.clientArgs.ConvID == nil {
+			// Most likely this is the first conversation
+			s.clientArgs.ConvID = new(int)
+			*s.clientArgs.ConvID = 0
+		}
+		if !conf.Opts.ContinueChat {
+			(*s.clientArgs.ConvID)++
+		}
+	} else {
+		s.clientArgs.ConvID = &conf.Opts.ConversationID
+	}
+
+	/* ATTACHMENTS? LOAD THEM */
+	if len(conf.Opts.Files) > 0 {
+		var skipped []attachments.Skipped
+		s.atts, skipped, err = attachments.Load(conf.Opts.Files, conf.General.MaxAttachmentSize)
+		if err != nil {
+			s.close()
+			return nil, fmt.Errorf("error attaching files: %v", err)
+		}
+		for _, skip := range skipped {
+			fmt.Fprintf(ctx.Stderr, "Skipping %s: %s\n", skip.Path, skip.Reason)
+		}
+	}
+
+	return s, nil
+}
+
+// useModel switches the session to the model called name
+func (s *session) useModel(name string) error {
+	model, err := resolveModel(s.conf, name)
+	if err != nil {
+		return err
+	}
+
+	// What Ollama knows about the model, if it's running and has it
+	info, _ := ollama.NewClient(s.conf.General.BaseURL, "").ShowModel(model.Name)
+
+	// Without this, Ollama says the model "does not support tools", which
+	// isn't much help when the user didn't pick the model
+	if s.clientArgs.Tools != nil && info != nil && !info.Can("tools") {
+		return fmt.Errorf("%s can't call tools, so it can't be used with --tools", model.Name)
+	}
+	if len(s.images) > 0 && info != nil && !info.Can("vision") {
+		return fmt.Errorf("%s can't see images, so it can't be used with --image", model.Name)
+	}
+
+	s.model = name
+	temperature := float32(model.Temperature)
+	s.clientArgs.Model = &model.Name
+	s.clientArgs.MaxTokens = &model.MaxTokens
+	s.clientArgs.Temperature = &temperature
+	s.clientArgs.ContextLength = contextLength(s.conf, model, info)
+	s.tokenizer, err = tokenizerFor(model, info)
+	if err != nil {
+		fmt.Fprintf(s.ctx.Stderr, "%v; estimating tokens instead\n", err)
+	}
+	return nil
+}
+
+// reloadImages reads the images sent earlier in a conversation, so they can
+// be sent again. One that's gone, or changed since, is left out; the model
+// is told it was there, but not what it was.
+func (s *session) reloadImages(context []LLM.LLMConversations) {
+	for i := range context {
+		for j := range context[i].Images {
+			img := &context[i].Images[j]
+			loaded, err := attachments.LoadImage(img.Path, s.conf.General.MaxImageSize)
+			if err == nil && loaded.Hash != img.Hash {
+				err = fmt.Errorf("%s has changed since it was sent", img.Path)
+			}
+			if err != nil {
+				if !s.lostImages[img.Hash] {
+					fmt.Fprintf(s.ctx.Stderr, "Leaving out an image from earlier: %v\n", err)
+					if s.lostImages == nil {
+						s.lostImages = make(map[string]bool)
+					}
+					s.lostImages[img.Hash] = true
+				}
+				continue
+			}
+			img.Data = loaded.Data
+		}
+	}
+}
+
+// sendImages is the images to go with the next prompt, as they're sent
+func sendImages(images []attachments.Image) []LLM.Image {
+	var send []LLM.Image
+	for _, img := range images {
+		send = append(send, LLM.Image{Path: img.Path, Hash: img.Hash, Data: img.Data})
+	}
+	return send
+}
+
+// showToolCall says which tool the model called, as it happens, since a
+// few of them can take a while before there's any answer to show
+func (s *session) showToolCall(call LLM.ToolCall) {
+	fmt.Fprintf(s.ctx.Stderr, "Tool: %s\n", call)
+	if call.Error != "" {
+		fmt.Fprintf(s.ctx.Stderr, "Tool %s failed: %s\n", call.Name, call.Error)
+	}
+}
+
+// confirmToolCall asks the user whether the model can make a call, showing
+// exactly what it'll be called with
+func (s *session) confirmToolCall(call LLM.ToolCall) (tools.Answer, error) {
+	fmt.Fprintf(s.ctx.Stderr, "Allow %s? [y]es, [n]o or [a]lways: ", call)
+	line, err := s.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return tools.No, err
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return tools.Yes, nil
+	case "a", "always":
+		return tools.Always, nil
+	}
+	return tools.No, nil
+}
+
+// auditToolCall records a tool call in the database, whatever came of it
+func (s *session) auditToolCall(record tools.Record) {
+	dir, _ := os.Getwd()
+	err := s.db.AuditToolCall(database.AuditEntry{
+		ConvID:    *s.clientArgs.ConvID,
+		Name:      record.Name,
+		Arguments: record.Arguments,
+		Decision:  string(record.Decision),
+		Result:    record.Result,
+		Error:     record.Error,
+		Duration:  record.Duration,
+		Directory: dir,
+	})
+	if err != nil {
+		fmt.Fprintln(s.ctx.Stderr, "error auditing tool call: ", err)
+	}
+}
+
+// contextLength is the context window to use for model: its context_length
+// from the config, or what Ollama says it can take, up to the default
+func contextLength(conf *config.Config, model config.Model, info *ollama.ShowResponse) int {
+	if model.ContextLength > 0 {
+		return model.ContextLength
+	}
+	n := conf.Context.DefaultLength
+	if info != nil {
+		if length := info.ContextLength(); length > 0 {
+			n = min(n, length)
+		}
+	}
+	return n
+}
+
+// tokenizerFor is what counts model's tokens: the tokenizer in its config,
+// or the one for its family in the tokenizers directory if there is one.
+// Otherwise (or if it can't be loaded) they're estimated.
+func tokenizerFor(model config.Model, info *ollama.ShowResponse) (tokenizer.Tokenizer, error) {
+	path := model.Tokenizer
+	if path == "" && info != nil && info.Details.Family != "" {
+		path = filepath.Join(config.TokenizerDir(), info.Details.Family+".json")
+		if _, err := os.Stat(path); err != nil {
+			path = ""
+		}
+	}
+	if path == "" {
+		return tokenizer.Heuristic{}, nil
+	}
+
+	tok, err := tokenizer.Load(path)
+	if err != nil {
+		return tokenizer.Heuristic{}, err
+	}
+	return tok, nil
+}
+
+// fitContext cuts the conversation being sent down to what fits in the
+// model's context, saying what it had to leave out
+func (s *session) fitContext(args *LLM.ClientArgs) error {
+	conf := s.conf
+	strategy, _ := LLM.ParseStrategy(conf.Context.Strategy)
+	budget := LLM.Budget{
+		ContextLength: args.ContextLength,
+		Reserve:       answerReserve(*args.MaxTokens, args.ContextLength),
+		Strategy:      strategy,
+		KeepFirst:     conf.Context.KeepFirst,
+		KeepLast:      conf.Context.KeepLast,
+		Count:         s.tokenizer.Count,
+	}
+	var summaryModel string
+	if strategy == LLM.Summarize {
+		var err error
+		summaryModel, budget.SummaryLength, err = s.summaryModel()
+		if err != nil {
+			fmt.Fprintf(s.ctx.Stderr, "Context: %v; leaving out what doesn't fit instead\n", err)
+		} else {
+			budget.Summarize = LLM.NewOllama(*args.BaseURL).Summarizer(summaryModel, budget.SummaryLength)
+		}
+		// Carry on from the summary made last time rather than starting over
+		budget.Summary, err = s.db.LoadSummary(*args.ConvID)
+		if err != nil {
+			fmt.Fprintln(s.ctx.Stderr, "Error: ", err)
+		}
+	}
+
+	fitted, err := budget.Fit(*args.SystemPrompt, *args.Prompt, args.Context)
+	if err != nil && budget.Summarize != nil {
+		// Better to lose the turns than the answer
+		fmt.Fprintf(s.ctx.Stderr, "Context: %v; leaving them out instead\n", err)
+		budget.Summarize = nil
+		fitted, err = budget.Fit(*args.SystemPrompt, *args.Prompt, args.Context)
+	}
+	if err != nil {
+		return err
+	}
+
+	if fitted.NewSummary {
+		fitted.Summary.Model = summaryModel
+		if err := s.db.SaveSummary(*args.ConvID, fitted.Summary); err != nil {
+			fmt.Fprintln(s.ctx.Stderr, "Error: ", err)
+		}
+	}
+	if fitted.Overflow {
+		fmt.Fprintf(s.ctx.Stderr, "Warning: %s, so Ollama will cut it short\n", fitted)
+	} else if fitted.Trimmed() {
+		fmt.Fprintf(s.ctx.Stderr, "Context: %s\n", fitted)
+	}
+	s.fitted = &fitted
+	args.Context = fitted.Context
+	return nil
+}
+
+// summaryModel is the model that writes summaries for the summarize
+// strategy, and its context length: context.summary_model, or the model
+// being talked to
+func (s *session) summaryModel() (string, int, error) {
+	if s.conf.Context.SummaryModel == "" {
+		return *s.clientArgs.Model, s.clientArgs.ContextLength, nil
+	}
+	model, err := resolveModel(s.conf, s.conf.Context.SummaryModel)
+	if err != nil {
+		return "", 0, fmt.Errorf("summary model: %v", err)
+	}
+	info, _ := ollama.NewClient(s.conf.General.BaseURL, "").ShowModel(model.Name)
+	return model.Name, contextLength(s.conf, model, info), nil
+}
+
+// showContext is /context: how long the conversation is, the summary of
+// the start of it (if there is one), and what was sent last time
+func (s *session) showContext(w io.Writer) {
+	turns := 0
+	for _, msg := range s.promptContext {
+		if strings.EqualFold(msg.Role, "user") {
+			turns++
+		}
+	}
+	fmt.Fprintf(w, "Conversation %d: %d %s, in a context of %d tokens (%s)\n",
+		*s.clientArgs.ConvID, turns, plural(turns, "turn", "turns"), s.clientArgs.ContextLength, s.conf.Context.Strategy)
+
+	fmt.Fprintf(w, "Tokenizer: %s\n", s.tokenizer.Name())
+
+	summary, err := s.db.LoadSummary(*s.clientArgs.ConvID)
+	if err != nil {
+		fmt.Fprintln(s.ctx.Stderr, "Error: ", err)
+	} else if summary.Text != "" {
+		fmt.Fprintf(w, "Summary of the first %d %s (by %s):\n%s\n",
+			summary.Turns, plural(summary.Turns, "turn", "turns"), summary.Model, summary.Text)
+	}
+
+	if s.fitted != nil {
+		fmt.Fprintf(w, "Last prompt: %s\n", s.fitted)
+	}
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// answerReserve is how much of the context to leave for the answer:
+// max_tokens, unless that's more than half of it, in which case a quarter
+func answerReserve(maxTokens, contextLength int) int {
+	if maxTokens > 0 && maxTokens <= contextLength/2 {
+		return maxTokens
+	}
+	return contextLength / 4
+}
+
+// resolveModel finds the model called name in the config, by key, alias or
+// tag. One that isn't there is fine if Ollama has it (`-m qwen2.5:7b`); it
+// just gets the defaults.
+func resolveModel(conf *config.Config, name string) (config.Model, error) {
+	if name == "" {
+		return config.Model{}, fmt.Errorf("no model given: use --model, or set model in the config")
+	}
+	if _, model, ok := conf.FindModel(name); ok && model.Name != "" {
+		return model, nil
+	}
+
+	options := conf.ModelNames()
+	installed, _ := installedModels(conf)
+	for _, m := range installed {
+		// `ollama run llama3.1` means llama3.1:latest
+		if m.Name == name || m.Name == name+":latest" {
+			return config.Model{Name: name, Temperature: ollamaDefaultTemperature}, nil
+		}
+		options = append(options, m.Name)
+	}
+
+	if suggestion := config.Suggest(name, options); suggestion != "" {
+		return config.Model{}, fmt.Errorf("unknown model: %s (did you mean %s?)", name, suggestion)
+	}
+	return config.Model{}, fmt.Errorf("unknown model: %s", name)
+}
+
+// rolePrompt is the system prompt for --role, or the default role if there
+// is one
+func rolePrompt(conf *config.Config) (string, error) {
+	name := conf.Opts.Role
+	if name == "" {
+		name = "default"
+	}
+
+	role, ok := conf.Roles[name]
+	if !ok && conf.Opts.Role != "" {
+		return "", fmt.Errorf("unknown role: %s", name)
+	}
+	if role.Prompt == "" {
+		return "You are a helpful assistant", nil
+	}
+	return role.Prompt, nil
+}
+
+func (s *session) close() {
+	if s.stopWatching != nil {
+		s.stopWatching()
+	}
+	if s.db != nil {
+		s.db.Close()
+	}
+	if s.index != nil {
+		s.index.Close()
+	}
+	if s.logFd != nil {
+		s.logFd.Close()
+	}
+}
+
+// ask sends one prompt, with any files still waiting to be attached and,
+// with --rag and --recall, the excerpts and past exchanges closest to it
+func (s *session) ask(prompt string) error {
+	var err error
+	if s.conf.Opts.Recall > 0 {
+		systemPrompt, err := s.recallPrompt(prompt)
+		if err != nil {
+			return err
+		}
+		s.clientArgs.SystemPrompt = &systemPrompt
+	}
+	if s.index != nil {
+		if prompt, err = s.retrieve(prompt); err != nil {
+			return err
+		}
+	}
+	if len(s.atts) > 0 {
+		prompt = attachments.BuildPrompt(prompt, s.atts)
+		s.clientArgs.Attachments = attachments.Paths(s.atts)
+		s.atts = nil
+	} else {
+		s.clientArgs.Attachments = nil
+	}
+	s.clientArgs.Images = sendImages(s.images)
+	s.images = nil
+	s.clientArgs.Prompt = &prompt
+
+	return s.chatWithLLM(s.clientArgs)
+}
+
+func (s *session) repl() error {
+	ctx := s.ctx
+	clientArgs := &s.clientArgs
+	out := s.chatter()
+
+	// Gracefully handle CTRL-C interrupt signal
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		fmt.Fprintln(out, "\nGoodbye!")
+		os.Exit(0)
+	}()
+	defer signal.Stop(sig)
+
+	for {
+		prompt, err := s.getPromptFromUser(s.reader)
+		if err == io.EOF {
+			fmt.Fprintln(out, "\nGoodbye!")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading prompt: %v", err)
+		}
+		if prompt == "" {
+			continue
+		}
+		if prompt[0] == '/' {
+			cmd := strings.Split(prompt, " ")[0]
+			switch cmd {
+			case "/help", "/?":
+				fmt.Fprintln(out, "Special commands:")
+				fmt.Fprintln(out, "  /exit: Exit the program")
+				fmt.Fprintln(out, "  /context: Show how long the conversation is, and any summary of it")
+				fmt.Fprintln(out, "  /model [model]: Show the current model, or switch to another")
+				fmt.Fprintln(out, "  /id: Show the current conversation ID")
+				continue
+			case "/exit", "/quit":
+				fmt.Fprintln(out, "Goodbye!")
+				return nil
+			case "/context":
+				s.showContext(out)
+				continue
+			case "/model":
+				if name := strings.TrimSpace(strings.TrimPrefix(prompt, cmd)); name != "" {
+					if err := s.useModel(name); err != nil {
+						fmt.Fprintln(ctx.Stderr, "Error: ", err)
+					}
+				}
+				fmt.Fprintf(out, "Model: %s (%s)\n", s.model, *clientArgs.Model)
+				continue
+			case "/id":
+				fmt.Fprintln(out, "Conversation ID: ", *clientArgs.ConvID)
+				continue
+			}
+		}
+
+		// Any files given on the command line go with the first prompt
+		if err := s.ask(prompt); err != nil {
+			return err
+		}
+
+		s.conf.Opts.ContinueChat = true
+		s.promptContext, err = LLM.ContinueConversation(s.logFd)
+		if err != nil {
+			fmt.Fprintln(ctx.Stderr, "Error reading log for continuing chat: ", err)
+		}
+		s.reloadImages(s.promptContext)
+		// TODO: promptContext will be nil if err != nil above. That's
+		// probably what we want. Would write a test but not sure how to
+		// test the LLM functions without using tokens.
+		clientArgs.Context = s.promptContext
+	}
+}
+
+func (s *session) chatWithLLM(args LLM.ClientArgs) error {
+	var client LLM.Client
+	opts := &s.conf.Opts
+	log := args.Log
+	model := *args.Model
+	continueChat := opts.ContinueChat
+
+	client = LLM.NewOllama(*args.BaseURL)
+
+	args.Stream = opts.Stream
+	var resp LLM.ClientResponse
+	err := s.fitContext(&args)
+	if err == nil {
+		if s.format != nil {
+			resp, err = s.answerWithFormat(client, args)
+		} else if opts.Output.Machine() {
+			resp, err = s.answerAsJSON(client, args)
+		} else {
+			resp, err = s.answerAsText(client, args)
+		}
+	}
+
+	// The prompt is logged whether or not there's an answer, with the
+	// tokens Ollama says it took (context and all), or if it didn't get
+	// that far, what it would have been by itself
+	inputTokens := resp.InputTokens
+	if inputTokens == 0 {
+		inputTokens = int32(s.tokenizer.Count(*args.Prompt))
+	}
+	LLM.LogChat(
+		log,
+		"User",
+		*args.Prompt,
+		"",
+		continueChat,
+		inputTokens,
+		0,
+		*args.ConvID,
+		args.Images,
+	)
+	if err != nil {
+		return err
+	}
+
+	// If we want the timestamp in the log and in the database to match
+	// exactly, we can set it here and pass it in to LogChat and
+	// InsertConversation. As it stands, each function uses the current
+	// timestamp when the function is executed.
+
+	LLM.LogChat(
+		log,
+		"Assistant",
+		resp.Text,
+		model,
+		continueChat,
+		resp.InputTokens,
+		resp.OutputTokens,
+		*args.ConvID,
+		nil,
+		resp.ToolCalls...,
+	)
+
+	err = s.db.InsertConversation(
+		*args.Prompt,
+		resp.Text,
+		model,
+		*args.Temperature,
+		resp.InputTokens,
+		resp.OutputTokens,
+		*args.ConvID,
+		args.Attachments...,
+	)
+	if err != nil {
+		fmt.Fprintln(s.ctx.Stderr, "error inserting conversation into database: ", err)
+	} else {
+		if err := s.db.SaveToolCalls(*args.ConvID, resp.ToolCalls); err != nil {
+			fmt.Fprintln(s.ctx.Stderr, "error saving tool calls into database: ", err)
+		}
+		if err := s.db.SaveImages(*args.ConvID, args.Images); err != nil {
+			fmt.Fprintln(s.ctx.Stderr, "error saving images into database: ", err)
+		}
+	}
+
+	if model := s.conf.Embeddings.Model; model != "" {
+		client := ollama.NewClient(*args.BaseURL, "")
+		if _, err := embedTurns(s.db, client, model, embedCatchUp); err != nil {
+			fmt.Fprintln(s.ctx.Stderr, "Error: ", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *session) answerAsText(client LLM.Client, args LLM.ClientArgs) (LLM.ClientResponse, error) {
+	ctx := s.ctx
+	opts := &s.conf.Opts
+	updateScreenSize(opts, nil)
+
+	// Unless it's being streamed, the whole answer is collected before it's
+	// shown, so it can go through the pager if it's too long for the screen
+	out := ctx.pager(!opts.Stream)
+	defer out.Close()
+
+	var writer interface {
+		io.Writer
+		resizable
+		Flush() error
+	}
+	if opts.Raw {
+		writer = linewrap.NewLineWrapper(opts.WrapWidth(), opts.TabWidth, out)
+	} else {
+		renderer := render.NewRenderer(out, opts.WrapWidth(), opts.TabWidth, ctx.colorEnabled())
+		theme, err := render.LoadTheme(s.conf.Display.Theme, s.conf.Display.ThemeColors)
+		if err != nil {
+			fmt.Fprintln(ctx.Stderr, "Error loading theme: ", err)
+		} else {
+			renderer.SetTheme(theme)
+		}
+		writer = renderer
+	}
+	args.Output = writer
+
+	// The terminal may be resized while the answer is coming in
+	updateScreenSize(opts, writer)
+	defer updateScreenSize(opts, nil)
+
+	fmt.Fprintln(out, "Assistant: ")
+	resp, err := client.Chat(args, opts.WrapWidth(), opts.TabWidth)
+	if err != nil {
+		return resp, err
+	}
+	if err := writer.Flush(); err != nil {
+		return resp, err
+	}
+	fmt.Fprintf(out, "\n\n-%s (convID: %d)\n", *args.Model, *args.ConvID)
+
+	return resp, nil
+}
+
+// With JSON output, stdout only gets the JSON: no "Assistant:" header, no
+// footer, no rendering.
+func (s *session) answerAsJSON(client LLM.Client, args LLM.ClientArgs) (LLM.ClientResponse, error) {
+	opts := &s.conf.Opts
+	stdout := s.ctx.Stdout
+
+	args.Output = io.Discard
+	if args.Stream {
+		args.OnChunk = output.ChunkWriter(stdout, opts.Output)
+	}
+
+	resp, err := client.Chat(args, opts.WrapWidth(), opts.TabWidth)
+	if err != nil {
+		return resp, err
+	}
+
+	return resp, output.WriteAnswer(stdout, opts.Output, output.NewAnswer(resp, *args.ConvID))
+}
+
+// chatter is where the chat's own messages (the prompt, help, goodbyes)
+// go: stdout, or stderr when stdout is for JSON
+func (s *session) chatter() io.Writer {
+	if s.conf.Opts.Output.Machine() {
+		return s.ctx.Stderr
+	}
+	return s.ctx.Stdout
+}
+
+func (s *session) getPromptFromUser(reader *bufio.Reader) (string, error) {
+	fmt.Fprintf(s.chatter(), "%s> ", s.model)
+	prompt, err := reader.ReadString('\n')
+	if err != nil && (err != io.EOF || prompt == "") {
+		return "", err
+	}
+
+	// Now clean up spaces and remove the newline we just captured
+	return strings.TrimSpace(prompt), nil
+}
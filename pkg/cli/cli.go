@@ -0,0 +1,337 @@
+package cli
+
+// The command line is a set of subcommands (`ask-ollama show 42`), each with
+// its own flags and help. A prompt on its own (`ask-ollama "why?"`) is short
+// for `ask`, and nothing at all starts a chat, so the old way of running it
+// still works.
+//
+// Commands don't exit or print errors themselves; they return them to Run,
+// which is the only place that decides on an exit code. That, and having the
+// output go to the writers in App, is what lets them be tested.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"github.com/duluk/ask-ollama/pkg/config"
+)
+
+const progName = "ask-ollama"
+
+type Command struct {
+	Name    string
+	Aliases []string
+	// Arguments, for the usage line (eg, "<id>")
+	Args    string
+	Summary string
+	// More detail for `help <command>`
+	Description string
+	// Hidden commands work but aren't listed in help
+	Hidden bool
+	// Commands that don't need the config loaded (version, help)
+	NoConfig bool
+	// Flags aren't parsed; all the arguments are left in Args
+	RawArgs bool
+
+	// Flags adds the command's own flags; --config and --help are added to
+	// every command
+	Flags func(fs *pflag.FlagSet)
+	Run   func(ctx *Context) error
+
+	// A command can be a group of subcommands (`config dump`) instead of, or
+	// as well as, being runnable itself
+	Commands []*Command
+	parent   *Command
+}
+
+// App is where commands read and write
+type App struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Context is what a command gets when it runs
+type Context struct {
+	*App
+	Command *Command
+	Flags   *pflag.FlagSet
+	// Positional arguments, after the flags are parsed
+	Args []string
+	// Loaded from --config (or the default files) unless the command has
+	// NoConfig set
+	Config *config.Config
+}
+
+// usageError is for commands run with the wrong arguments. Run adds a
+// pointer to the command's help.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usageErrorf(format string, args ...any) error {
+	return &usageError{fmt.Sprintf(format, args...)}
+}
+
+var commands []*Command
+
+func init() {
+	commands = []*Command{
+		askCommand,
+		chatCommand,
+		showCommand,
+		searchCommand,
+		exportCommand,
+		indexCommand,
+		modelsCommand,
+		configCommand,
+		statsCommand,
+		dbCommand,
+		completionCommand,
+		versionCommand,
+		helpCommand,
+		completeCommand,
+	}
+	for _, cmd := range commands {
+		setParents(cmd)
+	}
+}
+
+func setParents(cmd *Command) {
+	for _, sub := range cmd.Commands {
+		sub.parent = cmd
+		setParents(sub)
+	}
+}
+
+// Main runs the program with the real stdin, stdout and stderr
+func Main() int {
+	return Run(os.Args[1:], &App{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr})
+}
+
+// Run runs the command named by args and returns the exit code
+func Run(args []string, app *App) int {
+	cmd, args := resolve(args)
+
+	err := run(cmd, args, app)
+	if err == nil {
+		return 0
+	}
+	if errors.Is(err, pflag.ErrHelp) {
+		return 0
+	}
+
+	fmt.Fprintln(app.Stderr, "Error: ", err)
+	var usageErr *usageError
+	if errors.As(err, &usageErr) {
+		fmt.Fprintf(app.Stderr, "Run '%s help %s' for usage.\n", progName, cmd.path())
+	}
+	return 1
+}
+
+// resolve picks the command to run from the start of args, returning it and
+// the rest of the arguments. Anything that isn't a command is a prompt (or
+// flags) for `ask`.
+func resolve(args []string) (*Command, []string) {
+	if len(args) == 0 {
+		return chatCommand, args
+	}
+
+	// The version flags came before subcommands, so they still work
+	switch args[0] {
+	case "-v", "--version":
+		return versionCommand, args[1:]
+	case "-V", "--full-version":
+		return versionCommand, append([]string{"--full"}, args[1:]...)
+	case "-h", "--help":
+		return helpCommand, args[1:]
+	}
+
+	cmd := findCommand(commands, args[0])
+	if cmd == nil {
+		return askCommand, args
+	}
+	args = args[1:]
+
+	for len(cmd.Commands) > 0 && len(args) > 0 {
+		sub := findCommand(cmd.Commands, args[0])
+		if sub == nil {
+			break
+		}
+		cmd, args = sub, args[1:]
+	}
+
+	return cmd, args
+}
+
+func findCommand(cmds []*Command, name string) *Command {
+	for _, cmd := range cmds {
+		if cmd.Name == name {
+			return cmd
+		}
+		for _, alias := range cmd.Aliases {
+			if alias == name {
+				return cmd
+			}
+		}
+	}
+	return nil
+}
+
+func run(cmd *Command, args []string, app *App) error {
+	fs := cmd.flagSet(app)
+	if cmd.RawArgs {
+		return cmd.Run(&Context{App: app, Command: cmd, Flags: fs, Args: args})
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, pflag.ErrHelp) {
+			return err
+		}
+		return &usageError{err.Error()}
+	}
+
+	if cmd.Run == nil {
+		// A group of subcommands, without one of them given
+		if fs.NArg() > 0 {
+			return usageErrorf("unknown command: %s %s", cmd.path(), fs.Arg(0))
+		}
+		cmd.usage(app.Stdout, fs)
+		return nil
+	}
+
+	ctx := &Context{
+		App:     app,
+		Command: cmd,
+		Flags:   fs,
+		Args:    fs.Args(),
+	}
+
+	if !cmd.NoConfig {
+		path := ctx.flagString("config")
+		conf, err := config.Load(path)
+		if err != nil {
+			return loadError(app.Stderr, path, err)
+		}
+		if len(conf.Files) == 0 {
+			fmt.Fprintf(app.Stderr, "Config file not found in %s\n", config.Dir())
+		}
+		ctx.Config = conf
+		if err := ctx.applyFlags(); err != nil {
+			return err
+		}
+		if err := checkConfig(app.Stderr, conf); err != nil {
+			return err
+		}
+	}
+
+	return cmd.Run(ctx)
+}
+
+func (cmd *Command) flagSet(app *App) *pflag.FlagSet {
+	fs := pflag.NewFlagSet(cmd.path(), pflag.ContinueOnError)
+	fs.SetOutput(app.Stderr)
+	fs.Usage = func() {
+		cmd.usage(app.Stdout, fs)
+	}
+	// Flags after the arguments are fine (`show 3 --no-pager`), but a
+	// subcommand group shouldn't swallow an unknown subcommand's flags
+	fs.SetInterspersed(len(cmd.Commands) == 0)
+
+	if cmd.Flags != nil {
+		cmd.Flags(fs)
+	}
+	if !cmd.NoConfig {
+		fs.StringP("config", "C", "", "Configuration file")
+	}
+
+	return fs
+}
+
+// path is the command's full name, eg "config dump"
+func (cmd *Command) path() string {
+	if cmd.parent == nil {
+		return cmd.Name
+	}
+	return cmd.parent.path() + " " + cmd.Name
+}
+
+func (cmd *Command) usage(w io.Writer, fs *pflag.FlagSet) {
+	usage := progName + " " + cmd.path()
+	if len(cmd.Commands) > 0 {
+		usage += " <command>"
+	}
+	if cmd.Args != "" {
+		usage += " " + cmd.Args
+	}
+	fmt.Fprintf(w, "Usage: %s\n\n%s\n", usage, cmd.Summary)
+	if cmd.Description != "" {
+		fmt.Fprintf(w, "\n%s\n", strings.TrimSpace(cmd.Description))
+	}
+	if len(cmd.Commands) > 0 {
+		fmt.Fprintf(w, "\nCommands:\n")
+		listCommands(w, cmd.Commands)
+	}
+	if fs.HasAvailableFlags() {
+		fmt.Fprintf(w, "\nFlags:\n%s", fs.FlagUsages())
+	}
+}
+
+func listCommands(w io.Writer, cmds []*Command) {
+	width := 0
+	for _, cmd := range cmds {
+		if !cmd.Hidden {
+			width = max(width, len(cmd.Name))
+		}
+	}
+	for _, cmd := range cmds {
+		if cmd.Hidden {
+			continue
+		}
+		fmt.Fprintf(w, "  %-*s  %s\n", width, cmd.Name, cmd.Summary)
+	}
+}
+
+// The flag helpers return the zero value for flags the command doesn't have,
+// so shared code (like applyFlags) doesn't have to know which command it's
+// running for
+
+func (ctx *Context) hasFlag(name string) bool {
+	return ctx.Flags.Lookup(name) != nil
+}
+
+func (ctx *Context) flagString(name string) string {
+	if !ctx.hasFlag(name) {
+		return ""
+	}
+	s, _ := ctx.Flags.GetString(name)
+	return s
+}
+
+func (ctx *Context) flagBool(name string) bool {
+	if !ctx.hasFlag(name) {
+		return false
+	}
+	b, _ := ctx.Flags.GetBool(name)
+	return b
+}
+
+func (ctx *Context) flagInt(name string) int {
+	if !ctx.hasFlag(name) {
+		return 0
+	}
+	i, _ := ctx.Flags.GetInt(name)
+	return i
+}
+
+func (ctx *Context) flagChanged(name string) bool {
+	return ctx.hasFlag(name) && ctx.Flags.Changed(name)
+}
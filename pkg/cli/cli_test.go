@@ -0,0 +1,1093 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/duluk/ask-ollama/pkg/config"
+	"github.com/duluk/ask-ollama/pkg/database"
+	"github.com/duluk/ask-ollama/pkg/ollama"
+)
+
+// testConfig writes a config file that keeps the database and log in a
+// temporary directory, and returns its path
+func testConfig(t *testing.T) string {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yml")
+	conf := `
+model: llama
+models:
+  llama:
+    name: "llama3.1"
+    aliases: ["ll"]
+    max_tokens: 1024
+    temperature: 0.7
+  qwen:
+    name: "qwen2.5:7b"
+    max_tokens: 2048
+    temperature: 0.2
+roles:
+  default:
+    description: "A helpful AI assistant"
+    prompt: "You are a helpful AI assistant."
+  coder:
+    description: "Writes code"
+    prompt: "You write code."
+logging:
+  log_file: "` + filepath.Join(dir, "chat.yml") + `"
+database:
+  path: "` + filepath.Join(dir, "test.db") + `"
+  table_name: "conversations"
+`
+	if err := os.WriteFile(path, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func runCLI(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := Run(args, &App{Stdin: strings.NewReader(""), Stdout: &stdout, Stderr: &stderr})
+	return code, stdout.String(), stderr.String()
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		args     []string
+		command  string
+		expected []string
+	}{
+		{nil, "chat", nil},
+		{[]string{"Why is the sky blue?"}, "ask", []string{"Why is the sky blue?"}},
+		{[]string{"-m", "llama", "hi"}, "ask", []string{"-m", "llama", "hi"}},
+		{[]string{"show", "3"}, "show", []string{"3"}},
+		{[]string{"config", "dump", "-C", "x.yml"}, "config dump", []string{"-C", "x.yml"}},
+		{[]string{"config", "nope"}, "config", []string{"nope"}},
+		{[]string{"--version"}, "version", []string{}},
+		{[]string{"-V"}, "version", []string{"--full"}},
+	}
+
+	for _, tt := range tests {
+		cmd, args := resolve(tt.args)
+		assert.Equal(t, tt.command, cmd.path(), "args: %q", tt.args)
+		if len(tt.expected) == 0 {
+			assert.Empty(t, args, "args: %q", tt.args)
+		} else {
+			assert.Equal(t, tt.expected, args, "args: %q", tt.args)
+		}
+	}
+}
+
+func TestHelp(t *testing.T) {
+	code, stdout, _ := runCLI("help")
+	assert.Equal(t, 0, code)
+	for _, cmd := range []string{"ask", "chat", "show", "search", "export", "index", "models", "config", "stats", "db"} {
+		assert.Contains(t, stdout, "\n  "+cmd+" ")
+	}
+
+	code, stdout, _ = runCLI("help", "db", "backup")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "Usage: ask-ollama db backup <file>")
+
+	code, stdout, _ = runCLI("export", "--help")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "--format")
+
+	code, _, stderr := runCLI("help", "nope")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "unknown command: nope")
+}
+
+func TestVersion(t *testing.T) {
+	code, stdout, _ := runCLI("-v")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "ask-ollama version: 0.0.1\n", stdout)
+
+	code, stdout, _ = runCLI("version", "--full")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "Commit:")
+}
+
+func TestUsageErrors(t *testing.T) {
+	conf := testConfig(t)
+
+	code, _, stderr := runCLI("show", "-C", conf)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "expected a conversation ID")
+	assert.Contains(t, stderr, "ask-ollama help show")
+
+	code, _, stderr = runCLI("show", "--bogus", "-C", conf)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "unknown flag: --bogus")
+
+	code, _, stderr = runCLI("config", "nope", "-C", conf)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "unknown command: config nope")
+
+	code, _, stderr = runCLI("ask", "-o", "xml", "-C", conf, "hi")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "xml")
+
+	code, _, stderr = runCLI("-m", "gpt-9", "-C", conf, "hi")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "unknown model: gpt-9\n")
+
+	code, _, stderr = runCLI("-m", "lama", "-C", conf, "hi")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "unknown model: lama (did you mean llama?)")
+}
+
+func TestHistoryCommands(t *testing.T) {
+	conf := testConfig(t)
+
+	db, err := database.InitializeDB(filepath.Join(filepath.Dir(conf), "test.db"), "conversations")
+	assert.Nil(t, err)
+	assert.Nil(t, db.InsertConversation("What's 2+2?", "It's 4.", "llama3.1", 0.7, 10, 20, 1, "notes.txt"))
+	assert.Nil(t, db.InsertConversation("And 3+3?", "That's 6.", "llama3.1", 0.7, 30, 5, 1))
+	assert.Nil(t, db.InsertConversation("Capital of France?", "Paris.", "qwen2.5:7b", 0.2, 8, 2, 2))
+	db.Close()
+
+	code, stdout, _ := runCLI("show", "2", "-C", conf)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "Response: Paris.\n")
+
+	code, _, stderr := runCLI("show", "9", "-C", conf)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "no conversation with ID 9")
+
+	// The old flag still works
+	code, stdout, _ = runCLI("--show", "2", "-C", conf)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "Response: Paris.\n")
+
+	code, stdout, _ = runCLI("search", "-C", conf, "It's")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "Found 1 conversations: 1\n", stdout)
+
+	code, stdout, _ = runCLI("export", "1", "-C", conf)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, `# Conversation 1
+
+## User
+
+_Attached: notes.txt_
+
+What's 2+2?
+
+## Assistant (llama3.1)
+
+It's 4.
+
+## User
+
+And 3+3?
+
+## Assistant (llama3.1)
+
+That's 6.
+`, stdout)
+
+	out := filepath.Join(t.TempDir(), "conv.json")
+	code, _, _ = runCLI("export", "2", "--format", "json", "--out", out, "-C", conf)
+	assert.Equal(t, 0, code)
+	data, err := os.ReadFile(out)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"content": "Paris."`)
+
+	code, stdout, _ = runCLI("stats", "-C", conf)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "Conversations: 2\n")
+	assert.Contains(t, stdout, "Input tokens:  48\n")
+	assert.Contains(t, stdout, "qwen2.5:7b")
+
+	backup := filepath.Join(t.TempDir(), "backup.db")
+	code, _, _ = runCLI("db", "backup", backup, "-C", conf)
+	assert.Equal(t, 0, code)
+	assert.FileExists(t, backup)
+
+	code, stdout, _ = runCLI("db", "info", "-C", conf)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "Turns:          3\n")
+}
+
+func TestConfigAndModels(t *testing.T) {
+	conf := testConfig(t)
+
+	code, stdout, _ := runCLI("config", "path", "-C", conf)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, conf+"\n", stdout)
+
+	code, stdout, _ = runCLI("config", "dump", "-C", conf)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "Config file: "+conf)
+	assert.Contains(t, stdout, "qwen2.5:7b")
+
+	code, stdout, _ = runCLI("models", "-C", conf)
+	assert.Equal(t, 0, code)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	assert.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[1], "* llama "), "default model should be marked: %q", lines[1])
+	assert.Contains(t, lines[1], " ll ")
+	assert.True(t, strings.HasPrefix(lines[2], "  qwen "), "got: %q", lines[2])
+}
+
+func TestConfigCheck(t *testing.T) {
+	conf := testConfig(t)
+
+	code, stdout, _ := runCLI("config", "check", "-C", conf)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "No problems found in 1 config file(s)\n", stdout)
+
+	bad := filepath.Join(t.TempDir(), "bad.yml")
+	if err := os.WriteFile(bad, []byte("model: llama\nmodels:\n  llama:\n    name: llama3.1\n    temperature: 3\ndisplay:\n  maxwidth: 80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, stderr := runCLI("config", "check", "-C", bad)
+	assert.Equal(t, 1, code)
+	assert.Equal(t, bad+":5: models.llama.temperature: 3 is out of range (0 to 2)\n"+
+		bad+`:7: warning: display.maxwidth: unknown key (did you mean "max_width"?)`+"\n", stdout)
+	assert.Contains(t, stderr, "the config has errors")
+
+	// Other commands won't run with it either, and say why
+	code, _, stderr = runCLI("stats", "-C", bad)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, bad+":5: models.llama.temperature")
+	assert.NotContains(t, stderr, "warning")
+
+	// Warnings alone are only for config check
+	warned := filepath.Join(t.TempDir(), "warned.yml")
+	if err := os.WriteFile(warned, []byte("display:\n  maxwidth: 100\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	code, _, stderr = runCLI("stats", "-C", warned)
+	assert.Equal(t, 0, code)
+	assert.Empty(t, stderr)
+	code, stdout, _ = runCLI("config", "check", "-C", warned)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "warning: display.maxwidth")
+
+	if err := os.WriteFile(bad, []byte("models:\n  llama: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	code, stdout, _ = runCLI("config", "check", "-C", bad)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, bad+":")
+}
+
+func TestConfigInit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			w.Write([]byte(`{"models":[{"name":"qwen2.5-coder:14b","details":{"parameter_size":"14.8B"}},{"name":"llama3.1:latest"}]}`))
+		case "/api/show":
+			var req struct {
+				Model string `json:"model"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			if req.Model != "qwen2.5-coder:14b" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`{"model_info":{"general.architecture":"qwen2","qwen2.context_length":20000}}`))
+		}
+	}))
+	defer server.Close()
+
+	out := filepath.Join(t.TempDir(), "config.yml")
+	code, stdout, stderr := runCLI("config", "init", "--url", server.URL, "--out", out, "--default", "llama3.1")
+	assert.Equal(t, 0, code, stderr)
+	assert.Equal(t, "Wrote "+out+" with 2 models (default: llama3-1)\n", stdout)
+
+	conf, err := config.Load(out)
+	assert.Nil(t, err)
+	assert.Empty(t, conf.Validate())
+	assert.Equal(t, "llama3-1", conf.Opts.Model)
+	assert.Equal(t, server.URL, conf.General.BaseURL)
+	assert.Equal(t, config.Model{Name: "qwen2.5-coder:14b", MaxTokens: 10000, Temperature: 0.7}, conf.Models["qwen2-5-coder-14b"])
+	assert.Equal(t, "llama3.1:latest", conf.Models["llama3-1"].Name)
+	assert.Equal(t, 4096, conf.Models["llama3-1"].MaxTokens)
+	assert.Contains(t, conf.Roles, "developer")
+
+	code, _, stderr = runCLI("config", "init", "--url", server.URL, "--out", out)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "already exists (use --force")
+
+	code, _, _ = runCLI("config", "init", "--url", server.URL, "--out", out, "--force")
+	assert.Equal(t, 0, code)
+	conf, err = config.Load(out)
+	assert.Nil(t, err)
+	assert.Equal(t, "qwen2-5-coder-14b", conf.Opts.Model)
+
+	code, stdout, _ = runCLI("config", "init", "--url", server.URL, "--out", "-")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "qwen2-5-coder-14b:  # 14.8B, 20000 token context\n")
+
+	code, _, stderr = runCLI("config", "init", "--url", server.URL, "--out", "-", "--default", "mistral")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "mistral isn't one of the installed models")
+}
+
+func TestEnvOverrides(t *testing.T) {
+	conf := testConfig(t)
+	t.Setenv("ASKOLLAMA_MODEL", "qwen")
+
+	// The environment beats the config file...
+	code, stdout, _ := runCLI("models", "-C", conf)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "\n* qwen ")
+
+	code, stdout, _ = runCLI("config", "dump", "-C", conf)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "Environment: ASKOLLAMA_MODEL (model)\n")
+
+	// ...and flags beat the environment
+	t.Setenv("ASKOLLAMA_MODEL", "gpt-9")
+	code, _, stderr := runCLI("-m", "nope", "-C", conf, "hi")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "unknown model: nope")
+}
+
+func TestResolveModel(t *testing.T) {
+	conf, err := config.Load(testConfig(t))
+	assert.Nil(t, err)
+	// Nothing's listening, so nothing is installed
+	conf.General.BaseURL = "127.0.0.1:1"
+
+	for _, name := range []string{"llama", "ll", "llama3.1", "llama3.1:latest"} {
+		m, err := resolveModel(conf, name)
+		assert.Nil(t, err, name)
+		assert.Equal(t, "llama3.1", m.Name, name)
+		assert.Equal(t, 1024, m.MaxTokens, name)
+	}
+
+	_, err = resolveModel(conf, "qwen2.5")
+	assert.EqualError(t, err, "unknown model: qwen2.5 (did you mean qwen2.5:7b?)")
+
+	_, err = resolveModel(conf, "")
+	assert.ErrorContains(t, err, "no model given")
+}
+
+func TestSummarizeContext(t *testing.T) {
+	// The summarizing model is asked with its own system prompt; everything
+	// else gets the same answer
+	var summaries, chats []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			http.NotFound(w, r)
+			return
+		}
+		var req struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if strings.HasPrefix(req.Messages[0].Content, "You summarize") {
+			summaries = append(summaries, req.Model+": "+req.Messages[1].Content)
+			w.Write([]byte(`{"message":{"role":"assistant","content":"They did sums."},"done":true}`))
+			return
+		}
+		var sent []string
+		for _, msg := range req.Messages[1:] {
+			sent = append(sent, msg.Content)
+		}
+		chats = append(chats, strings.Join(sent, "\n"))
+		w.Write([]byte(`{"message":{"role":"assistant","content":"Sure."},"done":true}`))
+	}))
+	defer server.Close()
+
+	conf := testConfig(t)
+	t.Setenv("ASKOLLAMA_GENERAL_BASE_URL", server.URL)
+	t.Setenv("ASKOLLAMA_CONTEXT_STRATEGY", "summarize")
+	t.Setenv("ASKOLLAMA_CONTEXT_DEFAULT_LENGTH", "200")
+	t.Setenv("ASKOLLAMA_CONTEXT_SUMMARY_MODEL", "qwen")
+
+	dbPath := filepath.Join(filepath.Dir(conf), "test.db")
+	db, err := database.InitializeDB(dbPath, "conversations")
+	assert.Nil(t, err)
+	for _, n := range []string{"one", "two", "three", "four", "five", "six"} {
+		assert.Nil(t, db.InsertConversation("What is question "+n+" about, if you had to say it in a few words?",
+			"Question "+n+" is about something or other, as far as I can tell from it.", "llama3.1", 0.7, 10, 20, 1))
+	}
+	db.Close()
+
+	code, _, stderr := runCLI("--id", "1", "-C", conf, "--output", "json", "And then?")
+	assert.Equal(t, 0, code, stderr)
+	assert.Contains(t, stderr, "Context: summarized ")
+	assert.NotEmpty(t, summaries)
+	assert.True(t, strings.HasPrefix(summaries[0], "qwen2.5:7b: User: What is question one"), summaries[0])
+	assert.Len(t, chats, 1)
+	assert.Contains(t, chats[0], "Summary of the conversation before this: They did sums.")
+	assert.NotContains(t, chats[0], "question one")
+
+	db, err = database.InitializeDB(dbPath, "conversations")
+	assert.Nil(t, err)
+	summary, err := db.LoadSummary(1)
+	assert.Nil(t, err)
+	db.Close()
+	assert.Equal(t, "They did sums.", summary.Text)
+	assert.Equal(t, "qwen2.5:7b", summary.Model)
+	assert.Greater(t, summary.Turns, 0)
+
+	// Next time, the summary is carried on from rather than made again
+	summaries = nil
+	code, _, stderr = runCLI("--id", "1", "-C", conf, "--output", "json", "And after that?")
+	assert.Equal(t, 0, code, stderr)
+	for _, s := range summaries {
+		assert.Contains(t, s, "Summary of what came before: They did sums.")
+		assert.NotContains(t, s, "question one")
+	}
+
+	// /context shows it
+	var stdout bytes.Buffer
+	app := &App{Stdin: strings.NewReader("/context\n"), Stdout: &stdout, Stderr: &bytes.Buffer{}}
+	code = Run([]string{"chat", "--id", "1", "-C", conf}, app)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout.String(), "Conversation 1: 8 turns, in a context of 200 tokens (summarize)\nTokenizer: estimate\n")
+	assert.Contains(t, stdout.String(), "(by qwen2.5:7b):\nThey did sums.\n")
+}
+
+func TestChatOutputJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"message":{"role":"assistant","content":"4"},"done":true}`))
+	}))
+	defer server.Close()
+
+	conf := testConfig(t)
+	t.Setenv("ASKOLLAMA_GENERAL_BASE_URL", server.URL)
+
+	// Only answers go to stdout; the chat's own messages go to stderr
+	var stdout, stderr bytes.Buffer
+	app := &App{Stdin: strings.NewReader("/help\nWhat is 2+2?\n/id\n"), Stdout: &stdout, Stderr: &stderr}
+	code := Run([]string{"chat", "--output", "json", "-C", conf}, app)
+	assert.Equal(t, 0, code, stderr.String())
+	var answer map[string]any
+	dec := json.NewDecoder(&stdout)
+	assert.Nil(t, dec.Decode(&answer))
+	assert.Equal(t, "4", answer["text"])
+	assert.False(t, dec.More(), "only the answer should be on stdout")
+	assert.Contains(t, stderr.String(), "Special commands:")
+	assert.Contains(t, stderr.String(), "Conversation ID:")
+	assert.Contains(t, stderr.String(), "Goodbye!")
+
+	code, _, errOut := runCLI("-C", conf, "--output", "json", "--stream", "What is 2+2?")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut, "--stream can't be used with --output json (use --output jsonl")
+
+	code, out, errOut := runCLI("-C", conf, "--output", "jsonl", "--stream", "What is 2+2?")
+	assert.Equal(t, 0, code, errOut)
+	assert.Contains(t, out, `{"type":"answer","text":"4"`)
+}
+
+func TestPipedStdin(t *testing.T) {
+	var prompts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollama.ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		prompts = append(prompts, req.Messages[len(req.Messages)-1].Content)
+		w.Write([]byte(`{"message":{"role":"assistant","content":"4"},"done":true}`))
+	}))
+	defer server.Close()
+
+	conf := testConfig(t)
+	t.Setenv("ASKOLLAMA_GENERAL_BASE_URL", server.URL)
+	ask := func(stdin io.Reader) {
+		var stderr bytes.Buffer
+		code := Run([]string{"-C", conf, "--raw", "What is 2+2?"}, &App{Stdin: stdin, Stdout: &bytes.Buffer{}, Stderr: &stderr})
+		assert.Equal(t, 0, code, stderr.String())
+	}
+
+	// Nothing piped in, as from cron or `< /dev/null`, isn't attached
+	ask(strings.NewReader(" \n"))
+	devNull, err := os.Open(os.DevNull)
+	assert.Nil(t, err)
+	defer devNull.Close()
+	ask(devNull)
+
+	// But what is, is, from a pipe or a file
+	ask(strings.NewReader("2+2=5"))
+	file := filepath.Join(t.TempDir(), "sums.txt")
+	assert.Nil(t, os.WriteFile(file, []byte("1+1=3"), 0644))
+	f, err := os.Open(file)
+	assert.Nil(t, err)
+	defer f.Close()
+	ask(f)
+
+	assert.Len(t, prompts, 4)
+	assert.Equal(t, "What is 2+2?", prompts[0])
+	assert.Equal(t, "What is 2+2?", prompts[1])
+	assert.Equal(t, "What is 2+2?\n\n--- BEGIN FILE: <stdin> ---\n2+2=5\n--- END FILE: <stdin> ---", prompts[2])
+	assert.Contains(t, prompts[3], "1+1=3")
+}
+
+func TestTokenizerFor(t *testing.T) {
+	fixture := filepath.Join("..", "tokenizer", "testdata", "bytelevel.json")
+
+	// Nothing to go on
+	tok, err := tokenizerFor(config.Model{Name: "llama3.1"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "estimate", tok.Name())
+
+	tok, err = tokenizerFor(config.Model{Name: "llama3.1", Tokenizer: fixture}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "bytelevel", tok.Name())
+	assert.Equal(t, 2, tok.Count("hello world"))
+
+	// One for the model's family
+	data := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", data)
+	info := &ollama.ShowResponse{}
+	info.Details.Family = "llama"
+	tok, err = tokenizerFor(config.Model{Name: "llama3.1"}, info)
+	assert.Nil(t, err)
+	assert.Equal(t, "estimate", tok.Name())
+
+	contents, err := os.ReadFile(fixture)
+	assert.Nil(t, err)
+	dir := filepath.Join(data, "ask-ollama", "tokenizers")
+	assert.Nil(t, os.MkdirAll(dir, 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "llama.json"), contents, 0644))
+	tok, err = tokenizerFor(config.Model{Name: "llama3.1"}, info)
+	assert.Nil(t, err)
+	assert.Equal(t, "llama", tok.Name())
+
+	// One that can't be read is estimated, with the reason why
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "llama.json"), []byte("{"), 0644))
+	tok, err = tokenizerFor(config.Model{Name: "llama3.1"}, info)
+	assert.NotNil(t, err)
+	assert.Equal(t, "estimate", tok.Name())
+}
+
+func TestTools(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("Buy milk"), 0644))
+
+	// The model lists dir, then answers with what it was told
+	capabilities := `["completion","tools"]`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/show":
+			w.Write([]byte(`{"capabilities":` + capabilities + `}`))
+		case "/api/chat":
+			var req ollama.ChatRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			last := req.Messages[len(req.Messages)-1]
+			if last.Role == "tool" {
+				w.Write([]byte(`{"message":{"role":"assistant","content":"There's ` + last.Content + `."},"done":true}`))
+				return
+			}
+			call, _ := json.Marshal(map[string]any{"path": dir})
+			w.Write([]byte(`{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"list_directory","arguments":` + string(call) + `}}]},"done":true}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	conf := testConfig(t)
+	t.Setenv("ASKOLLAMA_GENERAL_BASE_URL", server.URL)
+
+	// Only the working directory can be looked at unless it's set
+	code, stdout, stderr := runCLI("-C", conf, "--tools", "--output", "json", "What's in there?")
+	assert.Equal(t, 0, code, stderr)
+	assert.Contains(t, stderr, "is outside the directories that can be looked at")
+
+	t.Setenv("ASKOLLAMA_TOOLS_PATHS", dir)
+	code, stdout, stderr = runCLI("-C", conf, "--tools", "--output", "json", "What's in there?")
+	assert.Equal(t, 0, code, stderr)
+	assert.Contains(t, stderr, `Tool: list_directory(path="`+dir+`")`)
+	var answer struct {
+		Text      string `json:"text"`
+		ToolCalls []struct {
+			Name   string `json:"name"`
+			Result string `json:"result"`
+		} `json:"tool_calls"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(stdout), &answer))
+	assert.Equal(t, "There's notes.txt.", answer.Text)
+	assert.Len(t, answer.ToolCalls, 1)
+	assert.Equal(t, "notes.txt", answer.ToolCalls[0].Result)
+
+	db, err := database.InitializeDB(filepath.Join(filepath.Dir(conf), "test.db"), "conversations")
+	assert.Nil(t, err)
+	conv, err := db.LoadConversationFromDB(2)
+	db.Close()
+	assert.Nil(t, err)
+	assert.Len(t, conv, 2)
+	assert.Len(t, conv[1].ToolCalls, 1)
+	assert.Equal(t, "list_directory", conv[1].ToolCalls[0].Name)
+
+	// Without --tools, there aren't any
+	code, stdout, stderr = runCLI("-C", conf, "--output", "json", "What's in there?")
+	assert.Equal(t, 0, code, stderr)
+	assert.NotContains(t, stdout, "tool_calls")
+
+	capabilities = `["completion"]`
+	code, _, stderr = runCLI("-C", conf, "--tools", "What's in there?")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "llama3.1 can't call tools")
+}
+
+func TestToolConfirmation(t *testing.T) {
+	// The model wants to run echo every time it's asked something
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			http.NotFound(w, r)
+			return
+		}
+		var req ollama.ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		last := req.Messages[len(req.Messages)-1]
+		if last.Role == "tool" {
+			w.Write([]byte(`{"message":{"role":"assistant","content":"Got: ` + strings.TrimSpace(last.Content) + `"},"done":true}`))
+			return
+		}
+		w.Write([]byte(`{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"run_command","arguments":{"command":"echo hi"}}}]},"done":true}`))
+	}))
+	defer server.Close()
+
+	conf := testConfig(t)
+	t.Setenv("ASKOLLAMA_GENERAL_BASE_URL", server.URL)
+	t.Setenv("ASKOLLAMA_TOOLS_COMMANDS", "echo")
+
+	// No, yes and always, then it doesn't ask again
+	var stdout, stderr bytes.Buffer
+	app := &App{Stdin: strings.NewReader("Say hi\nn\nSay hi\ny\nSay hi\na\nSay hi\n"), Stdout: &stdout, Stderr: &stderr}
+	code := Run([]string{"chat", "--tools", "--raw", "-C", conf}, app)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, 3, strings.Count(stderr.String(), `Allow run_command(command="echo hi")? [y]es, [n]o or [a]lways: `))
+	assert.Contains(t, stdout.String(), "Got: Error: the user said no to run_command")
+	assert.Equal(t, 3, strings.Count(stdout.String(), "Got: hi"))
+
+	// With stdin piped, there's no one to ask
+	code, _, errOut := runCLI("-C", conf, "--tools", "--raw", "Say hi")
+	assert.Equal(t, 0, code, errOut)
+	assert.Contains(t, errOut, "run_command needs the user's say-so, and there's no one to ask")
+
+	// Unless it's allowed anyway
+	f, err := os.OpenFile(conf, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	f.WriteString("tools:\n  policy:\n    run_command: allow\n")
+	f.Close()
+	code, out, errOut := runCLI("-C", conf, "--tools", "--raw", "Say hi")
+	assert.Equal(t, 0, code, errOut)
+	assert.Contains(t, out, "Got: hi")
+
+	code, out, errOut = runCLI("db", "audit", "-C", conf)
+	assert.Equal(t, 0, code, errOut)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Len(t, lines, 7)
+	assert.Regexp(t, `^TIME +CONV +DECISION +TOOK +CALL$`, lines[0])
+	var decisions []string
+	for _, line := range lines[1:] {
+		decisions = append(decisions, strings.Fields(line)[2])
+	}
+	assert.Equal(t, []string{"allowed", "unconfirmed", "approved", "approved", "approved", "declined"}, decisions)
+	assert.Contains(t, lines[6], `run_command(command="echo hi"): the user said no to run_command`)
+
+	code, out, _ = runCLI("db", "audit", "-n", "1", "-C", conf)
+	assert.Equal(t, 0, code)
+	assert.Len(t, strings.Split(strings.TrimSpace(out), "\n"), 2)
+}
+
+func TestStructuredOutput(t *testing.T) {
+	// The model gets the age wrong the first time it's asked
+	var formats []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			http.NotFound(w, r)
+			return
+		}
+		var req ollama.ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		formats = append(formats, string(req.Format))
+		answer := `{\"name\": \"Ann\", \"age\": \"thirty\"}`
+		if strings.Contains(req.Messages[len(req.Messages)-1].Content, "$.age: expected integer, got string") {
+			answer = "```json\n{\"name\": \"Ann\", \"age\": 30}\n```"
+			answer = strings.ReplaceAll(strings.ReplaceAll(answer, `"`, `\"`), "\n", `\n`)
+		}
+		w.Write([]byte(`{"message":{"role":"assistant","content":"` + answer + `"},"done":true,"prompt_eval_count":10,"eval_count":5}`))
+	}))
+	defer server.Close()
+
+	conf := testConfig(t)
+	t.Setenv("ASKOLLAMA_GENERAL_BASE_URL", server.URL)
+	schemaPath := filepath.Join(filepath.Dir(conf), "person.json")
+	assert.Nil(t, os.WriteFile(schemaPath, []byte(`{
+	  "type": "object",
+	  "properties": {"name": {"type": "string"}, "age": {"type": "integer"}},
+	  "required": ["name", "age"]
+	}`), 0644))
+
+	// Only the JSON is printed, once it's right
+	code, stdout, stderr := runCLI("-C", conf, "--schema", schemaPath, "Who's Ann?")
+	assert.Equal(t, 0, code, stderr)
+	assert.Equal(t, "{\"name\": \"Ann\", \"age\": 30}\n", stdout)
+	assert.Contains(t, stderr, "The answer wasn't right ($.age: expected integer, got string); asking again")
+	assert.Equal(t, []string{`{"type":"object","properties":{"name":{"type":"string"},"age":{"type":"integer"}},"required":["name","age"]}`}, formats[:1])
+	assert.Len(t, formats, 2)
+
+	db, err := database.InitializeDB(filepath.Join(filepath.Dir(conf), "test.db"), "conversations")
+	assert.Nil(t, err)
+	conv, err := db.LoadConversationFromDB(1)
+	db.Close()
+	assert.Nil(t, err)
+	assert.Len(t, conv, 2)
+	assert.True(t, strings.HasPrefix(conv[0].Content, "Who's Ann?"))
+	assert.Contains(t, conv[1].Content, `"age": 30`)
+
+	// It gives up after format_retries
+	t.Setenv("ASKOLLAMA_GENERAL_FORMAT_RETRIES", "0")
+	code, stdout, stderr = runCLI("-C", conf, "--schema", schemaPath, "Who's Ann?")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "", stdout)
+	assert.Contains(t, stderr, "the answer still wasn't right after 1 try: $.age: expected integer, got string")
+
+	// Any JSON will do for --format json
+	formats = nil
+	code, stdout, stderr = runCLI("-C", conf, "--format", "json", "--output", "json", "Who's Ann?")
+	assert.Equal(t, 0, code, stderr)
+	assert.Equal(t, []string{`"json"`}, formats)
+	var answer struct {
+		Text string `json:"text"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(stdout), &answer))
+	assert.Equal(t, `{"name": "Ann", "age": "thirty"}`, answer.Text)
+
+	code, _, stderr = runCLI("-C", conf, "--format", "yaml", "Who's Ann?")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "unknown format: yaml (expected json)")
+
+	code, _, stderr = runCLI("-C", conf, "--schema", filepath.Join(filepath.Dir(conf), "missing.json"), "Who's Ann?")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "error reading schema")
+}
+
+func TestImages(t *testing.T) {
+	dir := t.TempDir()
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	pic := filepath.Join(dir, "pic.png")
+	assert.Nil(t, os.WriteFile(pic, png, 0644))
+
+	capabilities := `["completion","vision"]`
+	var requests []ollama.ChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/show":
+			w.Write([]byte(`{"capabilities":` + capabilities + `}`))
+		case "/api/chat":
+			var req ollama.ChatRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			requests = append(requests, req)
+			w.Write([]byte(`{"message":{"role":"assistant","content":"A picture."},"done":true}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	conf := testConfig(t)
+	t.Setenv("ASKOLLAMA_GENERAL_BASE_URL", server.URL)
+	encoded := base64.StdEncoding.EncodeToString(png)
+
+	code, _, stderr := runCLI("-C", conf, "--image", pic, "--raw", "What's this?")
+	assert.Equal(t, 0, code, stderr)
+	assert.Len(t, requests, 1)
+	assert.Equal(t, []string{encoded}, requests[0].Messages[1].Images)
+
+	// Continuing the conversation sends it again, with the context
+	code, _, stderr = runCLI("-C", conf, "--id", "1", "--raw", "What color is it?")
+	assert.Equal(t, 0, code, stderr)
+	assert.Len(t, requests, 2)
+	assert.Equal(t, []string{encoded}, requests[1].Messages[1].Images)
+	assert.Contains(t, requests[1].Messages[1].Content, "(Image "+pic+" was sent here)")
+	assert.Equal(t, "user", requests[1].Messages[1].Role)
+	assert.Nil(t, requests[1].Messages[2].Images)
+	assert.Nil(t, requests[1].Messages[3].Images)
+
+	code, out, _ := runCLI("export", "1", "-C", conf)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, out, "_Image: "+pic+"_")
+
+	// Unless it's changed since
+	assert.Nil(t, os.WriteFile(pic, append(png, 0), 0644))
+	code, _, stderr = runCLI("-C", conf, "--id", "1", "--raw", "And now?")
+	assert.Equal(t, 0, code, stderr)
+	assert.Contains(t, stderr, "Leaving out an image from earlier: "+pic+" has changed since it was sent")
+	assert.Nil(t, requests[2].Messages[1].Images)
+	assert.Contains(t, requests[2].Messages[1].Content, "(Image "+pic+" was sent here, but isn't available any more)")
+
+	// An image given by a relative path is found again from anywhere
+	shot := filepath.Join(dir, "shot.png")
+	assert.Nil(t, os.WriteFile(shot, png, 0644))
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	assert.Nil(t, os.Chdir(dir))
+	code, _, stderr = runCLI("-C", conf, "--image", "shot.png", "--raw", "What's this?")
+	assert.Equal(t, 0, code, stderr)
+	assert.Nil(t, os.Chdir(t.TempDir()))
+	code, _, stderr = runCLI("-C", conf, "--id", "2", "--raw", "What color is it?")
+	assert.Equal(t, 0, code, stderr)
+	assert.NotContains(t, stderr, "Leaving out an image")
+	last := requests[len(requests)-1]
+	assert.Equal(t, []string{encoded}, last.Messages[1].Images)
+	assert.Contains(t, last.Messages[1].Content, "(Image "+shot+" was sent here)")
+	assert.Nil(t, os.Chdir(wd))
+
+	code, _, stderr = runCLI("-C", conf, "--image", conf, "What's this?")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "isn't a PNG, JPEG or WebP image")
+
+	capabilities = `["completion"]`
+	code, _, stderr = runCLI("-C", conf, "--image", pic, "What's this?")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "llama3.1 can't see images, so it can't be used with --image")
+}
+
+func TestSemanticSearch(t *testing.T) {
+	// The embedding "model" only knows about chess and soup
+	embedded := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/chat":
+			w.Write([]byte(`{"message":{"role":"assistant","content":"I see."},"done":true}`))
+		case "/api/embed":
+			var req ollama.EmbedRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			var vectors []string
+			for _, text := range req.Input {
+				chess, soup := 0, 0
+				if strings.Contains(text, "chess") || strings.Contains(text, "knight") {
+					chess = 1
+				}
+				if strings.Contains(text, "soup") {
+					soup = 1
+				}
+				vectors = append(vectors, fmt.Sprintf("[%d,%d,0.1]", chess, soup))
+			}
+			embedded += len(req.Input)
+			w.Write([]byte(`{"embeddings":[` + strings.Join(vectors, ",") + `]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	conf := testConfig(t)
+	t.Setenv("ASKOLLAMA_GENERAL_BASE_URL", server.URL)
+
+	code, _, stderr := runCLI("search", "--semantic", "-C", conf, "chess")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "semantic search needs an embedding model")
+
+	// From before there was an embedding model
+	code, _, stderr = runCLI("-C", conf, "--raw", "Is leek soup good?")
+	assert.Equal(t, 0, code, stderr)
+	assert.Equal(t, 0, embedded)
+
+	t.Setenv("ASKOLLAMA_EMBEDDINGS_MODEL", "embed")
+	code, _, stderr = runCLI("-C", conf, "--raw", "How does the knight move?")
+	assert.Equal(t, 0, code, stderr)
+	assert.Equal(t, 2, embedded)
+
+	code, out, stderr := runCLI("search", "--semantic", "-C", conf, "chess openings")
+	assert.Equal(t, 0, code, stderr)
+	assert.NotContains(t, stderr, "Embedded")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Len(t, lines, 3)
+	assert.Regexp(t, `^SCORE +CONV +TIME +PROMPT$`, lines[0])
+	assert.Regexp(t, `^1\.00 +2 .* How does the knight move\?$`, lines[1])
+	assert.Regexp(t, ` 1 .* Is leek soup good\?$`, lines[2])
+
+	code, out, _ = runCLI("search", "--hybrid", "-n", "1", "-C", conf, "leek")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, out, "Is leek soup good?")
+	assert.NotContains(t, out, "knight")
+}
+
+func TestRAG(t *testing.T) {
+	// The embedding "model" only knows about installing and licenses
+	var sent []ollama.Message
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/chat":
+			var req ollama.ChatRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			sent = req.Messages
+			w.Write([]byte(`{"message":{"role":"assistant","content":"Run make install (docs/install.md:1-3)."},"done":true}`))
+		case "/api/embed":
+			var req ollama.EmbedRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			var vectors []string
+			for _, text := range req.Input {
+				install, license := 0, 0
+				if strings.Contains(strings.ToLower(text), "install") {
+					install = 1
+				}
+				if strings.Contains(strings.ToLower(text), "license") {
+					license = 1
+				}
+				vectors = append(vectors, fmt.Sprintf("[%d,%d,0.1]", install, license))
+			}
+			w.Write([]byte(`{"embeddings":[` + strings.Join(vectors, ",") + `]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	conf := testConfig(t)
+	dir := filepath.Dir(conf)
+	t.Setenv("ASKOLLAMA_GENERAL_BASE_URL", server.URL)
+	t.Setenv("ASKOLLAMA_RAG_INDEX", filepath.Join(dir, "index.db"))
+	t.Setenv("ASKOLLAMA_RAG_TOP_K", "1")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	docs := filepath.Join(dir, "docs")
+	if err := os.MkdirAll(docs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(docs, "install.md"), []byte("# Installing\n\nRun make install.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(docs, "license.md"), []byte("MIT license\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, stderr := runCLI("index", "-C", conf, "docs")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "indexing documents needs an embedding model")
+
+	t.Setenv("ASKOLLAMA_EMBEDDINGS_MODEL", "embed")
+	code, _, stderr = runCLI("-C", conf, "--rag", "docs", "How do I install it?")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "docs hasn't been indexed; run ask-ollama index docs")
+
+	code, out, stderr := runCLI("index", "-C", conf, "docs")
+	assert.Equal(t, 0, code, stderr)
+	assert.Equal(t, "docs: 2 added, 0 updated, 0 unchanged, 0 removed (2 chunks embedded)\n", out)
+
+	code, out, _ = runCLI("index", "-C", conf, "docs")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, out, "0 added, 0 updated, 2 unchanged")
+
+	code, out, stderr = runCLI("-C", conf, "--raw", "--rag", "docs", "How do I install it?")
+	assert.Equal(t, 0, code, stderr)
+	assert.Contains(t, out, "docs/install.md:1-3")
+	assert.Contains(t, stderr, "Sending 1 excerpt: docs/install.md:1-3")
+	prompt := sent[len(sent)-1].Content
+	assert.True(t, strings.HasPrefix(prompt, "How do I install it?\n\n"), prompt)
+	assert.Contains(t, prompt, "--- BEGIN EXCERPT: docs/install.md:1-3 ---\n# Installing\n\nRun make install.\n--- END EXCERPT: docs/install.md:1-3 ---")
+	assert.NotContains(t, prompt, "MIT license")
+}
+
+func TestRecall(t *testing.T) {
+	var sent []ollama.Message
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/chat":
+			var req ollama.ChatRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			sent = req.Messages
+			w.Write([]byte(`{"message":{"role":"assistant","content":"Noted."},"done":true}`))
+		case "/api/embed":
+			// Only knows about soup
+			var req ollama.EmbedRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			var vectors []string
+			for _, text := range req.Input {
+				soup := 0
+				if strings.Contains(text, "soup") {
+					soup = 1
+				}
+				vectors = append(vectors, fmt.Sprintf("[%d,0.1]", soup))
+			}
+			w.Write([]byte(`{"embeddings":[` + strings.Join(vectors, ",") + `]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	conf := testConfig(t)
+	t.Setenv("ASKOLLAMA_GENERAL_BASE_URL", server.URL)
+
+	code, _, stderr := runCLI("-C", conf, "--recall", "-1", "hi")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "--recall can't be negative")
+
+	for _, prompt := range []string{"My leek soup is bland", "Which chess opening should I learn?", "Thoughts on tomato soup?"} {
+		code, _, stderr := runCLI("-C", conf, "--raw", prompt)
+		assert.Equal(t, 0, code, stderr)
+	}
+
+	// By words, with no embedding model
+	code, _, stderr = runCLI("-C", conf, "--raw", "--recall", "2", "How can I thicken leek soup?")
+	assert.Equal(t, 0, code, stderr)
+	assert.Contains(t, stderr, "Recalled 2 earlier exchanges (conversations 1, 3)")
+	system := sent[0].Content
+	assert.True(t, strings.HasPrefix(system, "You are a helpful AI assistant.\n\nHere are some exchanges from earlier conversations"), system)
+	assert.Regexp(t, `--- BEGIN EARLIER EXCHANGE \(conversation 1, [^)]+\) ---\nUser: My leek soup is bland`, system)
+	assert.Contains(t, system, "Assistant: Noted.\n--- END EARLIER EXCHANGE ---")
+	assert.NotContains(t, system, "chess")
+	// The prompt itself is left alone
+	assert.True(t, strings.HasPrefix(sent[len(sent)-1].Content, "How can I thicken leek soup?"))
+
+	// Continuing leaves out the conversation itself
+	code, _, stderr = runCLI("-C", conf, "--raw", "--recall", "5", "--id", "1", "What about more leek?")
+	assert.Equal(t, 0, code, stderr)
+	assert.Contains(t, stderr, "Recalled 1 earlier exchange (conversation 4)")
+
+	// By meaning, with one
+	t.Setenv("ASKOLLAMA_EMBEDDINGS_MODEL", "embed")
+	code, _, stderr = runCLI("-C", conf, "--raw", "--recall", "1", "Any soup ideas?")
+	assert.Equal(t, 0, code, stderr)
+	assert.Contains(t, stderr, "Embedded 5 turns that hadn't been")
+	assert.Contains(t, stderr, "Recalled 1 earlier exchange")
+	assert.Contains(t, sent[0].Content, "soup")
+	assert.NotContains(t, sent[0].Content, "chess")
+
+	// Nothing relevant, nothing added
+	t.Setenv("ASKOLLAMA_EMBEDDINGS_MODEL", "")
+	code, _, stderr = runCLI("-C", conf, "--raw", "--recall", "3", "Recipes for quiche?")
+	assert.Equal(t, 0, code, stderr)
+	assert.NotContains(t, stderr, "Recalled")
+	assert.Equal(t, "You are a helpful AI assistant.", sent[0].Content)
+}
+
+func TestRecallBackground(t *testing.T) {
+	// Long answers are cut short, on a character and with a mark to say so
+	long := strings.Repeat("é", recallMaxBytes/2) + "and the rest"
+	system := recallBackground("Be brief.", []database.Match{{Turn: database.Turn{
+		ConvID: 7, Timestamp: "2026-10-01 12:00:00", Prompt: "  Soup?\n", Response: "x" + long,
+	}}})
+	assert.Equal(t, "Be brief.\n\nHere are some exchanges from earlier conversations that may be relevant. Build on them where they help, and ignore them where they don't; they aren't part of this conversation.\n"+
+		"\n--- BEGIN EARLIER EXCHANGE (conversation 7, 2026-10-01 12:00:00) ---\n"+
+		"User: Soup?\n"+
+		"Assistant: x"+strings.Repeat("é", recallMaxBytes/2-1)+" [...]\n"+
+		"--- END EARLIER EXCHANGE ---", system)
+}
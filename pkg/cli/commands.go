@@ -0,0 +1,276 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+
+	"github.com/duluk/ask-ollama/pkg/LLM"
+	"github.com/duluk/ask-ollama/pkg/config"
+	"github.com/duluk/ask-ollama/pkg/database"
+	"github.com/duluk/ask-ollama/pkg/ollama"
+)
+
+// What Ollama uses when it isn't told, for models that aren't in the config
+const ollamaDefaultTemperature = 0.8
+
+var modelsCommand = &Command{
+	Name:    "models",
+	Summary: "List the configured models, or the ones installed in Ollama",
+	Flags: func(fs *pflag.FlagSet) {
+		fs.Bool("installed", false, "List the models installed on the Ollama server instead")
+	},
+	Run: runModels,
+}
+
+var statsCommand = &Command{
+	Name:    "stats",
+	Summary: "Show how many conversations and tokens there have been, by model",
+	Flags: func(fs *pflag.FlagSet) {
+		fs.Bool("json", false, "Print the stats as JSON")
+	},
+	Run: runStats,
+}
+
+var dbCommand = &Command{
+	Name:    "db",
+	Summary: "Look after the conversation database",
+	Commands: []*Command{
+		{
+			Name:    "info",
+			Summary: "Show where the database is and what's in it",
+			Run:     runDBInfo,
+		},
+		{
+			Name:    "vacuum",
+			Summary: "Compact the database file",
+			Run: func(ctx *Context) error {
+				return withDB(ctx, (*database.ChatDB).Vacuum)
+			},
+		},
+		{
+			Name:    "backup",
+			Args:    "<file>",
+			Summary: "Copy the database to a new file, safely even while it's in use",
+			Run: func(ctx *Context) error {
+				if len(ctx.Args) != 1 {
+					return usageErrorf("expected a file to back up to")
+				}
+				return withDB(ctx, func(db *database.ChatDB) error {
+					return db.Backup(ctx.Args[0])
+				})
+			},
+		},
+		{
+			Name:    "audit",
+			Summary: "Show the tools models have called (with --tools), and whether they were allowed",
+			Flags: func(fs *pflag.FlagSet) {
+				fs.IntP("limit", "n", 20, "How many calls to show, newest first")
+			},
+			Run: runDBAudit,
+		},
+	},
+}
+
+var versionCommand = &Command{
+	Name:     "version",
+	Summary:  "Show the version",
+	NoConfig: true,
+	Flags: func(fs *pflag.FlagSet) {
+		fs.BoolP("full", "V", false, "Include the commit and build date")
+	},
+	Run: func(ctx *Context) error {
+		if ctx.flagBool("full") {
+			fmt.Fprintln(ctx.Stdout, config.VersionInfo())
+		} else {
+			fmt.Fprintln(ctx.Stdout, "ask-ollama version:", config.Version)
+		}
+		return nil
+	},
+}
+
+var helpCommand = &Command{
+	Name:     "help",
+	Args:     "[command]",
+	Summary:  "Show help for a command",
+	NoConfig: true,
+	Run:      runHelp,
+}
+
+func runHelp(ctx *Context) error {
+	if len(ctx.Args) == 0 {
+		fmt.Fprintf(ctx.Stdout, "Usage: %s [command] [flags] [prompt]\n\n", progName)
+		fmt.Fprintf(ctx.Stdout, "With no command, the prompt is sent with ask; with no prompt either, a chat\nis started.\n\n")
+		fmt.Fprintf(ctx.Stdout, "Commands:\n")
+		listCommands(ctx.Stdout, commands)
+		fmt.Fprintf(ctx.Stdout, "\nRun '%s help <command>' for more about a command.\n", progName)
+		return nil
+	}
+
+	cmds := commands
+	var cmd *Command
+	for _, name := range ctx.Args {
+		cmd = findCommand(cmds, name)
+		if cmd == nil {
+			return usageErrorf("unknown command: %s", name)
+		}
+		cmds = cmd.Commands
+	}
+	cmd.usage(ctx.Stdout, cmd.flagSet(ctx.App))
+	return nil
+}
+
+func withDB(ctx *Context, fn func(db *database.ChatDB) error) error {
+	db, err := openDB(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return fn(db)
+}
+
+func runModels(ctx *Context) error {
+	conf := ctx.Config
+	w := tabwriter.NewWriter(ctx.Stdout, 0, 0, 2, ' ', 0)
+
+	if ctx.flagBool("installed") {
+		models, err := ollama.NewClient(conf.General.BaseURL, "").ListModels()
+		if err != nil {
+			return fmt.Errorf("error listing installed models: %v", err)
+		}
+		fmt.Fprintln(w, "NAME\tSIZE\tPARAMETERS\tMODIFIED")
+		for _, m := range models {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", m.Name, humanSize(m.Size), m.Details.ParameterSize, m.ModifiedAt.Format("2006-01-02"))
+		}
+		return w.Flush()
+	}
+
+	names := make([]string, 0, len(conf.Models))
+	for name := range conf.Models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// The default is marked with a *
+	def, _, _ := conf.FindModel(conf.Opts.Model)
+	fmt.Fprintln(w, "  NAME\tMODEL\tALIASES\tMAX TOKENS\tTEMPERATURE")
+	for _, name := range names {
+		m := conf.Models[name]
+		mark := " "
+		if name == def {
+			mark = "*"
+		}
+		fmt.Fprintf(w, "%s %s\t%s\t%s\t%d\t%g\n", mark, name, m.Name, strings.Join(m.Aliases, ", "), m.MaxTokens, m.Temperature)
+	}
+	return w.Flush()
+}
+
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func runStats(ctx *Context) error {
+	db, err := openDB(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	stats, err := db.Stats()
+	if err != nil {
+		return fmt.Errorf("error getting stats: %v", err)
+	}
+
+	if ctx.flagBool("json") {
+		enc := json.NewEncoder(ctx.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	}
+
+	fmt.Fprintf(ctx.Stdout, "Conversations: %d\n", stats.Conversations)
+	fmt.Fprintf(ctx.Stdout, "Turns:         %d\n", stats.Turns)
+	fmt.Fprintf(ctx.Stdout, "Input tokens:  %d\n", stats.InputTokens)
+	fmt.Fprintf(ctx.Stdout, "Output tokens: %d\n", stats.OutputTokens)
+	if stats.First != "" {
+		fmt.Fprintf(ctx.Stdout, "First:         %s\n", stats.First)
+		fmt.Fprintf(ctx.Stdout, "Last:          %s\n", stats.Last)
+	}
+	if len(stats.Models) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(ctx.Stdout)
+	w := tabwriter.NewWriter(ctx.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "MODEL\tCONVERSATIONS\tTURNS\tINPUT TOKENS\tOUTPUT TOKENS\t")
+	for _, m := range stats.Models {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t\n", m.Model, m.Conversations, m.Turns, m.InputTokens, m.OutputTokens)
+	}
+	return w.Flush()
+}
+
+func runDBAudit(ctx *Context) error {
+	limit := ctx.flagInt("limit")
+	if limit <= 0 {
+		return usageErrorf("--limit must be more than 0")
+	}
+
+	return withDB(ctx, func(db *database.ChatDB) error {
+		entries, err := db.ToolAudit(limit)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			fmt.Fprintln(ctx.Stdout, "No tools have been called")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(ctx.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tCONV\tDECISION\tTOOK\tCALL")
+		for _, e := range entries {
+			call := LLM.ToolCall{Name: e.Name, Arguments: e.Arguments}.String()
+			if e.Error != "" {
+				call += ": " + e.Error
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%v\t%s\n", e.Timestamp, e.ConvID, e.Decision, e.Duration, call)
+		}
+		return w.Flush()
+	})
+}
+
+func runDBInfo(ctx *Context) error {
+	conf := ctx.Config
+	return withDB(ctx, func(db *database.ChatDB) error {
+		version, err := db.Version()
+		if err != nil {
+			return err
+		}
+		stats, err := db.Stats()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(ctx.Stdout, "Path:           %s\n", conf.Database.Path)
+		fmt.Fprintf(ctx.Stdout, "Table:          %s\n", conf.Database.TableName)
+		fmt.Fprintf(ctx.Stdout, "Schema version: %d\n", version)
+		fmt.Fprintf(ctx.Stdout, "Conversations:  %d\n", stats.Conversations)
+		fmt.Fprintf(ctx.Stdout, "Turns:          %d\n", stats.Turns)
+		if fi, err := os.Stat(conf.Database.Path); err == nil {
+			fmt.Fprintf(ctx.Stdout, "Size:           %s\n", humanSize(fi.Size()))
+		}
+		return nil
+	})
+}
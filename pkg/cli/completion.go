@@ -0,0 +1,420 @@
+package cli
+
+// Shell completion. The scripts are thin: they hand the words on the command
+// line to the hidden __complete command, which prints the candidates for the
+// last one, a line each, with an optional tab and description. When there
+// aren't any, the scripts fall back to completing file names.
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/duluk/ask-ollama/pkg/config"
+	"github.com/duluk/ask-ollama/pkg/ollama"
+)
+
+// How many recent conversations are offered for --id and show
+const recentConversations = 20
+
+// Installed models are looked up on every completion, so don't hang around
+// if Ollama isn't answering
+const completionTimeout = 500 * time.Millisecond
+
+var completionCommand = &Command{
+	Name:    "completion",
+	Args:    "<bash|zsh|fish>",
+	Summary: "Print a shell completion script",
+	Description: `
+To load completions:
+
+  bash:  source <(ask-ollama completion bash)
+         (or save it in /etc/bash_completion.d/ask-ollama)
+  zsh:   ask-ollama completion zsh > "${fpath[1]}/_ask-ollama"
+  fish:  ask-ollama completion fish > ~/.config/fish/completions/ask-ollama.fish
+
+Models, roles and conversation IDs are completed from the config, Ollama and
+the database as you type.`,
+	NoConfig: true,
+	Run: func(ctx *Context) error {
+		if len(ctx.Args) != 1 {
+			return usageErrorf("expected a shell: bash, zsh or fish")
+		}
+		script, ok := completionScripts[ctx.Args[0]]
+		if !ok {
+			return usageErrorf("unsupported shell: %s (expected bash, zsh or fish)", ctx.Args[0])
+		}
+		fmt.Fprint(ctx.Stdout, script)
+		return nil
+	},
+}
+
+var completeCommand = &Command{
+	Name:     "__complete",
+	Summary:  "Complete the last of the words given (used by the completion scripts)",
+	Hidden:   true,
+	NoConfig: true,
+	RawArgs:  true,
+	Run: func(ctx *Context) error {
+		words := ctx.Args
+		if len(words) == 0 {
+			words = []string{""}
+		}
+		for _, c := range complete(ctx.App, words) {
+			fmt.Fprintln(ctx.Stdout, c)
+		}
+		return nil
+	},
+}
+
+// A completion candidate and what it is
+type candidate struct {
+	value, desc string
+}
+
+func (c candidate) String() string {
+	if c.desc == "" {
+		return c.value
+	}
+	return c.value + "\t" + c.desc
+}
+
+// complete returns the candidates for the last of words (which may be empty,
+// for a new word); the ones before it are the command line so far.
+func complete(app *App, words []string) []candidate {
+	cur := words[len(words)-1]
+	prev := words[:len(words)-1]
+
+	// Nothing but the program name so far
+	if len(prev) == 0 && !strings.HasPrefix(cur, "-") {
+		return filter(commandCandidates(commands), cur)
+	}
+
+	cmd, rest := resolve(prev)
+	if len(prev) == 0 {
+		cmd, rest = askCommand, nil
+	}
+	fs := cmd.flagSet(app)
+	fs.SetOutput(io.Discard)
+
+	// --flag=value
+	if strings.HasPrefix(cur, "--") && strings.Contains(cur, "=") {
+		name, value, _ := strings.Cut(cur[2:], "=")
+		if flag := fs.Lookup(name); flag != nil {
+			var cands []candidate
+			for _, c := range filter(flagValues(flag.Name, words), value) {
+				cands = append(cands, candidate{"--" + name + "=" + c.value, c.desc})
+			}
+			return cands
+		}
+		return nil
+	}
+
+	// --flag value
+	if len(rest) > 0 {
+		if flag := valueFlag(fs, rest[len(rest)-1]); flag != nil {
+			return filter(flagValues(flag.Name, words), cur)
+		}
+	}
+
+	if strings.HasPrefix(cur, "-") {
+		return filter(flagCandidates(fs), cur)
+	}
+
+	args := positionals(fs, rest)
+	switch {
+	case cmd == helpCommand:
+		cmds := commands
+		for _, name := range args {
+			if c := findCommand(cmds, name); c != nil {
+				cmds = c.Commands
+			}
+		}
+		return filter(commandCandidates(cmds), cur)
+	case cmd == completionCommand && len(args) == 0:
+		return filter([]candidate{{"bash", ""}, {"zsh", ""}, {"fish", ""}}, cur)
+	case len(cmd.Commands) > 0 && len(args) == 0:
+		return filter(commandCandidates(cmd.Commands), cur)
+	case (cmd == showCommand || cmd == exportCommand) && len(args) == 0:
+		return filter(conversationCandidates(loadConfigFor(words)), cur)
+	}
+
+	return nil
+}
+
+func filter(cands []candidate, prefix string) []candidate {
+	var matches []candidate
+	for _, c := range cands {
+		if strings.HasPrefix(c.value, prefix) {
+			matches = append(matches, c)
+		}
+	}
+	return matches
+}
+
+func commandCandidates(cmds []*Command) []candidate {
+	var cands []candidate
+	for _, cmd := range cmds {
+		if !cmd.Hidden {
+			cands = append(cands, candidate{cmd.Name, cmd.Summary})
+		}
+	}
+	return cands
+}
+
+func flagCandidates(fs *pflag.FlagSet) []candidate {
+	var cands []candidate
+	fs.VisitAll(func(flag *pflag.Flag) {
+		if flag.Hidden || flag.Deprecated != "" {
+			return
+		}
+		cands = append(cands, candidate{"--" + flag.Name, flag.Usage})
+	})
+	return cands
+}
+
+// valueFlag returns the flag word is, if it's one that takes a value
+// separately (`--model x` or `-m x`, but not `--model=x`)
+func valueFlag(fs *pflag.FlagSet, word string) *pflag.Flag {
+	var flag *pflag.Flag
+	switch {
+	case strings.HasPrefix(word, "--") && !strings.Contains(word, "="):
+		flag = fs.Lookup(word[2:])
+	case strings.HasPrefix(word, "-") && len(word) >= 2 && word != "-":
+		// The last of a group of short flags (`-rm`) is the one that
+		// could take a value
+		flag = fs.ShorthandLookup(word[len(word)-1:])
+		if flag != nil && len(word) > 2 && strings.Contains(word[1:len(word)-1], flag.Shorthand) {
+			flag = nil
+		}
+	}
+	if flag == nil || flag.NoOptDefVal != "" {
+		return nil
+	}
+	return flag
+}
+
+// positionals picks the arguments out of words, skipping flags and their
+// values
+func positionals(fs *pflag.FlagSet, words []string) []string {
+	var args []string
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		if word == "--" {
+			return append(args, words[i+1:]...)
+		}
+		if strings.HasPrefix(word, "-") && word != "-" {
+			if valueFlag(fs, word) != nil {
+				i++
+			}
+			continue
+		}
+		args = append(args, word)
+	}
+	return args
+}
+
+func flagValues(name string, words []string) []candidate {
+	switch name {
+	case "model":
+		return modelCandidates(loadConfigFor(words))
+	case "role":
+		return roleCandidates(loadConfigFor(words))
+	case "id", "show":
+		return conversationCandidates(loadConfigFor(words))
+	case "output":
+		return []candidate{{"text", ""}, {"json", ""}, {"jsonl", ""}}
+	case "format":
+		return []candidate{{"markdown", ""}, {"json", ""}, {"yaml", ""}}
+	}
+	// Files, mostly
+	return nil
+}
+
+// loadConfigFor loads the config the command line being completed would
+// use. It's nil if that fails, leaving nothing to complete from.
+func loadConfigFor(words []string) *config.Config {
+	path := ""
+	for i, word := range words {
+		switch {
+		case (word == "-C" || word == "--config") && i+1 < len(words):
+			path = words[i+1]
+		case strings.HasPrefix(word, "--config="):
+			path = strings.TrimPrefix(word, "--config=")
+		}
+	}
+
+	conf, err := config.Load(path)
+	if err != nil {
+		return nil
+	}
+	return conf
+}
+
+func modelCandidates(conf *config.Config) []candidate {
+	if conf == nil {
+		return nil
+	}
+
+	var cands []candidate
+	names := make([]string, 0, len(conf.Models))
+	for name := range conf.Models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cands = append(cands, candidate{name, conf.Models[name].Name})
+	}
+	for _, name := range names {
+		for _, alias := range conf.Models[name].Aliases {
+			cands = append(cands, candidate{alias, "alias for " + name})
+		}
+	}
+
+	// Installed models that are in the config have been offered already
+	installed, _ := installedModels(conf)
+	for _, m := range installed {
+		if _, _, ok := conf.FindModel(m.Name); ok {
+			continue
+		}
+		desc := "installed"
+		if m.Details.ParameterSize != "" {
+			desc += ", " + m.Details.ParameterSize
+		}
+		cands = append(cands, candidate{m.Name, desc})
+	}
+
+	return cands
+}
+
+func roleCandidates(conf *config.Config) []candidate {
+	if conf == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(conf.Roles))
+	for name := range conf.Roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var cands []candidate
+	for _, name := range names {
+		cands = append(cands, candidate{name, conf.Roles[name].Description})
+	}
+	return cands
+}
+
+func conversationCandidates(conf *config.Config) []candidate {
+	if conf == nil {
+		return nil
+	}
+
+	db, err := openDB(&Context{Config: conf})
+	if err != nil {
+		return nil
+	}
+	defer db.Close()
+
+	convs, err := db.RecentConversations(recentConversations)
+	if err != nil {
+		return nil
+	}
+
+	var cands []candidate
+	for _, conv := range convs {
+		cands = append(cands, candidate{strconv.Itoa(conv.ConvID), conv.Title})
+	}
+	return cands
+}
+
+func installedModels(conf *config.Config) ([]ollama.ModelInfo, error) {
+	client := ollama.NewClient(conf.General.BaseURL, "")
+	client.HTTPClient.Timeout = completionTimeout
+	return client.ListModels()
+}
+
+var completionScripts = map[string]string{
+	"bash": `# bash completion for ask-ollama
+
+_ask_ollama() {
+    local cur words cword
+    # Keep model tags (llama3.1:8b) and --flag=value in one piece if
+    # bash-completion is around to help
+    if declare -F _get_comp_words_by_ref >/dev/null; then
+        _get_comp_words_by_ref -n =: cur words cword
+    else
+        cur=${COMP_WORDS[COMP_CWORD]}
+        words=("${COMP_WORDS[@]}")
+        cword=$COMP_CWORD
+    fi
+
+    local IFS=$'\n'
+    local candidates
+    candidates=$(ask-ollama __complete "${words[@]:1:cword}" 2>/dev/null | cut -f1)
+    if [ -z "$candidates" ]; then
+        COMPREPLY=($(compgen -f -- "$cur"))
+    else
+        COMPREPLY=($(compgen -W "$candidates" -- "$cur"))
+    fi
+
+    if declare -F __ltrim_colon_completions >/dev/null; then
+        __ltrim_colon_completions "$cur"
+    fi
+}
+
+complete -o filenames -F _ask_ollama ask-ollama
+`,
+
+	"zsh": `#compdef ask-ollama
+
+_ask-ollama() {
+    local -a candidates
+    local line value desc
+    for line in "${(@f)$(ask-ollama __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}"; do
+        [[ -n $line ]] || continue
+        value=${line%%$'\t'*}
+        desc=${line#*$'\t'}
+        # _describe splits on the first unescaped colon
+        value=${value//:/\\:}
+        if [[ $desc == $line ]]; then
+            candidates+=("$value")
+        else
+            candidates+=("$value:$desc")
+        fi
+    done
+
+    if (( ${#candidates} == 0 )); then
+        _files
+        return
+    fi
+    _describe 'ask-ollama' candidates
+}
+
+if [[ $funcstack[1] == _ask-ollama ]]; then
+    _ask-ollama "$@"
+else
+    compdef _ask-ollama ask-ollama
+fi
+`,
+
+	"fish": `# fish completion for ask-ollama
+
+function __ask_ollama_complete
+    set -l tokens (commandline -opc) (commandline -ct)
+    ask-ollama __complete $tokens[2..-1] 2>/dev/null
+end
+
+function __ask_ollama_no_candidates
+    test -z "$(__ask_ollama_complete)"
+end
+
+complete -c ask-ollama -f -a '(__ask_ollama_complete)'
+complete -c ask-ollama -n __ask_ollama_no_candidates -F
+`,
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/duluk/ask-ollama/pkg/database"
+)
+
+func values(cands []candidate) []string {
+	var vals []string
+	for _, c := range cands {
+		vals = append(vals, c.value)
+	}
+	return vals
+}
+
+func TestComplete(t *testing.T) {
+	conf := testConfig(t)
+	app := &App{}
+
+	db, err := database.InitializeDB(filepath.Join(filepath.Dir(conf), "test.db"), "conversations")
+	assert.Nil(t, err)
+	assert.Nil(t, db.InsertConversation("What's 2+2?\nShow your work", "4", "llama3.1", 0.7, 10, 20, 1))
+	assert.Nil(t, db.InsertConversation("Capital of France?", "Paris.", "qwen2.5:7b", 0.2, 8, 2, 2))
+	db.Close()
+
+	tests := []struct {
+		words    []string
+		expected []string
+	}{
+		// Commands, but not hidden ones
+		{[]string{""}, []string{"ask", "chat", "show", "search", "export", "index", "models", "config", "stats", "db", "completion", "version", "help"}},
+		{[]string{"s"}, []string{"show", "search", "stats"}},
+		{[]string{"config", ""}, []string{"dump", "path", "check", "init"}},
+		{[]string{"help", "d"}, []string{"db"}},
+		{[]string{"help", "db", "b"}, []string{"backup"}},
+		{[]string{"completion", ""}, []string{"bash", "zsh", "fish"}},
+		// Flags, without the deprecated ones
+		{[]string{"export", "--f"}, []string{"--format"}},
+		{[]string{"--con"}, []string{"--config", "--continue"}},
+		// Flag values
+		{[]string{"-C", conf, "--model", ""}, []string{"llama", "qwen", "ll"}},
+		{[]string{"-C", conf, "ask", "-m", "q"}, []string{"qwen"}},
+		{[]string{"-C", conf, "--model=l"}, []string{"--model=llama", "--model=ll"}},
+		{[]string{"-C", conf, "--role", ""}, []string{"coder", "default"}},
+		{[]string{"chat", "-C", conf, "--id", ""}, []string{"2", "1"}},
+		{[]string{"export", "--format", ""}, []string{"markdown", "json", "yaml"}},
+		{[]string{"-C", conf, "-rm", ""}, []string{"llama", "qwen", "ll"}},
+		// Positional conversation IDs, but only the first
+		{[]string{"show", "-C", conf, ""}, []string{"2", "1"}},
+		{[]string{"show", "-C", conf, "2", ""}, nil},
+		// Files are left to the shell
+		{[]string{"ask", "-f", ""}, nil},
+		{[]string{"-C", ""}, nil},
+		{[]string{"What is", ""}, nil},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, values(complete(app, tt.words)), "words: %q", tt.words)
+	}
+
+	// Descriptions are the model tags and conversation titles
+	cands := complete(app, []string{"show", "-C", conf, "1"})
+	assert.Equal(t, []candidate{{"1", "What's 2+2?"}}, cands)
+	assert.Equal(t, "1\tWhat's 2+2?", cands[0].String())
+}
+
+func TestCompletionScripts(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		code, stdout, _ := runCLI("completion", shell)
+		assert.Equal(t, 0, code)
+		assert.True(t, strings.Contains(stdout, "ask-ollama __complete"), "%s script doesn't call __complete", shell)
+	}
+
+	code, _, stderr := runCLI("completion", "tcsh")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "unsupported shell: tcsh")
+
+	code, stdout, _ := runCLI("__complete", "config", "")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "dump\tPrint the configuration, with defaults filled in\npath\tPrint the paths of the config files in use\ncheck\tCheck the config files for mistakes\ninit\tWrite a config.yml with the models installed in Ollama\n", stdout)
+}
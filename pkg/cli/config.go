@@ -0,0 +1,295 @@
+package cli
+
+// Commands for the config, and checking it before any other command runs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"golang.org/x/term"
+
+	"github.com/duluk/ask-ollama/pkg/config"
+	"github.com/duluk/ask-ollama/pkg/ollama"
+)
+
+// The most max_tokens `config init` gives a model (it's what the example
+// config uses), and what it gives one whose context length isn't known
+const (
+	initMaxTokens     = 16384
+	initUnknownTokens = 4096
+)
+
+var (
+	errBadConfig   = errors.New("the config has errors (see 'ask-ollama config check')")
+	errConfigCheck = errors.New("the config has errors")
+)
+
+var configCommand = &Command{
+	Name:    "config",
+	Summary: "Look at the configuration",
+	Commands: []*Command{
+		{
+			Name:    "dump",
+			Summary: "Print the configuration, with defaults filled in",
+			Run: func(ctx *Context) error {
+				ctx.Config.DumpConfig(ctx.Stdout)
+				return nil
+			},
+		},
+		{
+			Name:    "path",
+			Summary: "Print the paths of the config files in use",
+			Description: `
+The files are printed in the order they're merged, later ones overriding
+earlier ones: the system-wide config, the user's, then the nearest
+` + config.ProjectFile + ` in the current directory or above it.`,
+			Run: func(ctx *Context) error {
+				if len(ctx.Config.Files) == 0 {
+					return fmt.Errorf("no config file found (looked for %s and %s)", config.UserFile(), config.ProjectFile)
+				}
+				for _, file := range ctx.Config.Files {
+					fmt.Fprintln(ctx.Stdout, file)
+				}
+				return nil
+			},
+		},
+		{
+			Name:    "check",
+			Summary: "Check the config files for mistakes",
+			Description: `
+Every problem is reported with the file and line it's on: unknown keys
+(which would otherwise be ignored), values of the wrong type or out of range,
+a base_url the client can't use, a default model that isn't in models, and
+so on. Warnings are for things that work, but probably not as intended.
+
+The exit status is 1 if there are errors, but not for warnings alone.`,
+			// It loads the config itself, so a broken one can be reported
+			// instead of stopping it running
+			NoConfig: true,
+			Flags: func(fs *pflag.FlagSet) {
+				fs.StringP("config", "C", "", "Configuration file")
+			},
+			Run: runConfigCheck,
+		},
+		{
+			Name:    "init",
+			Summary: "Write a config.yml with the models installed in Ollama",
+			Description: `
+Each model the Ollama server has gets an entry under models, with max_tokens
+set from its context length. The default roles are added, and the database
+and chat log are put in the XDG data and state directories. The config goes
+in the user config directory unless --out says otherwise.
+
+An existing file is left alone unless --force is given.`,
+			NoConfig: true,
+			Flags: func(fs *pflag.FlagSet) {
+				fs.String("url", "", "Ollama server to ask (default: base_url from the current config, or "+config.DefaultBaseURL+")")
+				fs.String("default", "", "Model to make the default (tag or key); asked for on a terminal if not given")
+				fs.StringP("out", "O", "", "Where to write it (- for stdout; default: "+config.UserFile()+")")
+				fs.Bool("force", false, "Overwrite the file if it's already there")
+			},
+			Run: runConfigInit,
+		},
+	},
+}
+
+func runConfigCheck(ctx *Context) error {
+	path := ctx.flagString("config")
+	conf, err := config.Load(path)
+	if err != nil {
+		if err = loadError(ctx.Stdout, path, err); errors.Is(err, errBadConfig) {
+			return errConfigCheck
+		}
+		return err
+	}
+
+	if len(conf.Files) == 0 {
+		fmt.Fprintf(ctx.Stdout, "No config file found (looked for %s and %s)\n", config.UserFile(), config.ProjectFile)
+	}
+	problems := conf.Validate()
+	for _, p := range problems {
+		fmt.Fprintln(ctx.Stdout, p)
+	}
+	if config.HasErrors(problems) {
+		return errConfigCheck
+	}
+	if len(conf.Files) > 0 && len(problems) == 0 {
+		fmt.Fprintf(ctx.Stdout, "No problems found in %d config file(s)\n", len(conf.Files))
+	}
+	return nil
+}
+
+// loadError reports why the config at path (or the default files) couldn't
+// be loaded, with the file and line if the files themselves say
+func loadError(w io.Writer, path string, err error) error {
+	files := []string{path}
+	if path == "" {
+		files = config.Files()
+	}
+	problems := config.CheckFiles(files)
+	for _, p := range problems {
+		fmt.Fprintln(w, p)
+	}
+	if config.HasErrors(problems) {
+		return errBadConfig
+	}
+	return err
+}
+
+// checkConfig fails if anything in the loaded config is an error, saying
+// what, so a bad value is caught before the command uses it. Warnings are
+// left to config check, rather than repeated by every command.
+func checkConfig(w io.Writer, conf *config.Config) error {
+	problems := conf.Validate()
+	if !config.HasErrors(problems) {
+		return nil
+	}
+	for _, p := range problems {
+		if !p.Warning {
+			fmt.Fprintln(w, p)
+		}
+	}
+	return errBadConfig
+}
+
+func runConfigInit(ctx *Context) error {
+	out := ctx.flagString("out")
+	if out == "" {
+		out = config.UserFile()
+	}
+	if out != "-" && !ctx.flagBool("force") {
+		if _, err := os.Stat(out); err == nil {
+			return fmt.Errorf("%s already exists (use --force to overwrite it)", out)
+		}
+	}
+
+	baseURL := ctx.flagString("url")
+	if baseURL == "" {
+		baseURL = config.DefaultBaseURL
+		// The current config may not load; that's likely why it's being
+		// replaced
+		if conf, err := config.Load(""); err == nil {
+			baseURL = conf.General.BaseURL
+		}
+	}
+
+	client := ollama.NewClient(baseURL, "")
+	installed, err := client.ListModels()
+	if err != nil {
+		return fmt.Errorf("error listing the models on %s (use --url for another server): %v", baseURL, err)
+	}
+	if len(installed) == 0 {
+		fmt.Fprintf(ctx.Stderr, "Ollama has no models installed; add some with `ollama pull` and then to the config\n")
+	}
+
+	starter := &config.Starter{
+		BaseURL:      baseURL,
+		DatabasePath: filepath.Join(config.DataDir(), "ask-ollama.db"),
+		LogFile:      filepath.Join(config.StateDir(), "ask-ollama.chat.yml"),
+	}
+	keys := map[string]bool{}
+	for _, m := range installed {
+		key := config.ModelKey(m.Name)
+		for i := 2; keys[key]; i++ {
+			key = config.ModelKey(m.Name) + "-" + strconv.Itoa(i)
+		}
+		keys[key] = true
+
+		model := config.StarterModel{Key: key, Name: m.Name, MaxTokens: initUnknownTokens}
+		var about []string
+		if m.Details.ParameterSize != "" {
+			about = append(about, m.Details.ParameterSize)
+		}
+		// Without the details the model still gets an entry, just a
+		// cautious max_tokens
+		if info, err := client.ShowModel(m.Name); err == nil {
+			if n := info.ContextLength(); n > 0 {
+				model.MaxTokens = min(n/2, initMaxTokens)
+				about = append(about, fmt.Sprintf("%d token context", n))
+			}
+		}
+		model.About = strings.Join(about, ", ")
+		starter.Models = append(starter.Models, model)
+	}
+
+	starter.Model, err = initDefaultModel(ctx, starter.Models)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := starter.Write(&buf); err != nil {
+		return fmt.Errorf("error writing config: %v", err)
+	}
+	if out == "-" {
+		_, err := ctx.Stdout.Write(buf.Bytes())
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return fmt.Errorf("error creating config directory: %v", err)
+	}
+	if err := os.WriteFile(out, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error writing config: %v", err)
+	}
+
+	fmt.Fprintf(ctx.Stdout, "Wrote %s with %d models", out, len(starter.Models))
+	if starter.Model != "" {
+		fmt.Fprintf(ctx.Stdout, " (default: %s)", starter.Model)
+	}
+	fmt.Fprintln(ctx.Stdout)
+	return nil
+}
+
+// initDefaultModel picks the default model's key: the one given with
+// --default, or the one chosen on a terminal, or the first (the most
+// recently pulled, the way Ollama lists them)
+func initDefaultModel(ctx *Context, models []config.StarterModel) (string, error) {
+	if len(models) == 0 {
+		return "", nil
+	}
+
+	if name := ctx.flagString("default"); name != "" {
+		for _, m := range models {
+			if m.Key == name || m.Name == name || m.Key == config.ModelKey(name) {
+				return m.Key, nil
+			}
+		}
+		return "", fmt.Errorf("%s isn't one of the installed models", name)
+	}
+
+	f, ok := ctx.Stdin.(*os.File)
+	if !ok || len(models) == 1 || !term.IsTerminal(int(f.Fd())) {
+		return models[0].Key, nil
+	}
+
+	for i, m := range models {
+		fmt.Fprintf(ctx.Stdout, "%2d) %s\n", i+1, m.Name)
+	}
+	reader := bufio.NewReader(f)
+	for {
+		fmt.Fprintf(ctx.Stdout, "Default model [1]: ")
+		line, err := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if err != nil && err != io.EOF {
+				return "", err
+			}
+			return models[0].Key, nil
+		}
+		if n, convErr := strconv.Atoi(line); convErr == nil && n >= 1 && n <= len(models) {
+			return models[n-1].Key, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("no default model chosen")
+		}
+		fmt.Fprintf(ctx.Stdout, "Pick a number from 1 to %d\n", len(models))
+	}
+}
@@ -0,0 +1,57 @@
+package cli
+
+// Embeddings of past turns, for search --semantic. Each turn is embedded
+// as it's saved, once there's an embedding model, and any that weren't
+// (from before there was one, or when it couldn't be reached) are caught up
+// on before a search.
+
+import (
+	"fmt"
+
+	"github.com/duluk/ask-ollama/pkg/database"
+	"github.com/duluk/ask-ollama/pkg/ollama"
+)
+
+// Turns sent to be embedded at a time
+const embedBatch = 32
+
+// Turns embedded after each answer: the new one, and a few that were missed
+const embedCatchUp = 8
+
+// embedTurns embeds up to limit turns that model hasn't yet, or all of them
+// if limit is 0, and says how many it did
+func embedTurns(db *database.ChatDB, client *ollama.Client, model string, limit int) (int, error) {
+	done := 0
+	for limit == 0 || done < limit {
+		n := embedBatch
+		if limit > 0 {
+			n = min(n, limit-done)
+		}
+		turns, err := db.TurnsWithoutEmbeddings(model, n)
+		if err != nil {
+			return done, err
+		}
+		if len(turns) == 0 {
+			break
+		}
+
+		texts := make([]string, len(turns))
+		for i, turn := range turns {
+			texts[i] = turn.Prompt + "\n\n" + turn.Response
+		}
+		vectors, err := client.Embed(model, texts)
+		if err != nil {
+			return done, fmt.Errorf("error embedding with %s: %v", model, err)
+		}
+		for i, turn := range turns {
+			if err := db.SaveEmbedding(turn, model, vectors[i]); err != nil {
+				return done, err
+			}
+		}
+		done += len(turns)
+		if len(turns) < n {
+			break
+		}
+	}
+	return done, nil
+}
@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"io"
+	"os"
+
+	"github.com/spf13/pflag"
+
+	"github.com/duluk/ask-ollama/pkg/output"
+	"github.com/duluk/ask-ollama/pkg/pager"
+	"github.com/duluk/ask-ollama/pkg/render"
+	"github.com/duluk/ask-ollama/pkg/termsize"
+)
+
+// Flags for the commands that send a prompt to a model (ask and chat)
+func promptFlags(fs *pflag.FlagSet) {
+	fs.StringP("model", "m", "", "Model to use")
+	fs.String("role", "", "Role from the config to use for the system prompt")
+	fs.IntP("id", "i", 0, "Conversation ID")
+	fs.BoolP("continue", "c", false, "Continue conversation")
+	fs.StringArrayP("file", "f", nil, "Attach a file to the prompt (may be repeated; globs allowed)")
+	fs.StringArray("image", nil, "Send an image with the prompt, for models that can see (may be repeated)")
+	fs.Int("recall", 0, "Add the N most relevant exchanges from past conversations as background")
+	fs.StringArray("rag", nil, "Send excerpts from the documents indexed in this directory (may be repeated; see index)")
+	fs.Bool("tools", false, "Let the model call the tools in the config (read files, run commands...)")
+	fs.String("format", "", "Make the answer JSON: json is the only format")
+	fs.String("schema", "", "Make the answer JSON matching the JSON schema in this file")
+	fs.BoolP("raw", "r", false, "Print answers as plain wrapped text instead of rendering markdown")
+	fs.Bool("stream", false, "Show the answer as it's generated")
+	fs.StringP("output", "o", "text", "Output format: text, json or jsonl")
+	pagerFlags(fs)
+}
+
+func pagerFlags(fs *pflag.FlagSet) {
+	fs.Bool("no-pager", false, "Don't use a pager for long output")
+}
+
+// applyFlags sets the config's options from whichever of the flags above
+// the command has, on top of what came from the config file
+func (ctx *Context) applyFlags() error {
+	conf := ctx.Config
+	opts := &conf.Opts
+
+	if model := ctx.flagString("model"); model != "" {
+		opts.Model = model
+	}
+	opts.Role = ctx.flagString("role")
+	opts.ConversationID = ctx.flagInt("id")
+	opts.ContinueChat = ctx.flagBool("continue")
+	if ctx.hasFlag("file") {
+		opts.Files, _ = ctx.Flags.GetStringArray("file")
+	}
+	if ctx.hasFlag("image") {
+		opts.Images, _ = ctx.Flags.GetStringArray("image")
+	}
+	opts.Recall = ctx.flagInt("recall")
+	if opts.Recall < 0 {
+		return usageErrorf("--recall can't be negative")
+	}
+	if ctx.hasFlag("rag") {
+		opts.RAG, _ = ctx.Flags.GetStringArray("rag")
+	}
+	opts.Tools = ctx.flagBool("tools")
+	// export has a --format of its own
+	if ctx.hasFlag("schema") {
+		opts.Format = ctx.flagString("format")
+		if opts.Format != "" && opts.Format != "json" {
+			return usageErrorf("unknown format: %s (expected json)", opts.Format)
+		}
+		opts.Schema = ctx.flagString("schema")
+	}
+	opts.Raw = ctx.flagBool("raw")
+	opts.Stream = opts.Stream || ctx.flagBool("stream")
+	if ctx.hasFlag("output") {
+		format, err := output.ParseFormat(ctx.flagString("output"))
+		if err != nil {
+			return &usageError{err.Error()}
+		}
+		opts.Output = format
+	}
+	// A single JSON object can only be written once the answer's done;
+	// streaming is what jsonl is for
+	if opts.Output == output.JSON {
+		if ctx.flagBool("stream") {
+			return usageErrorf("--stream can't be used with --output json (use --output jsonl for an event per chunk)")
+		}
+		opts.Stream = false
+	}
+	opts.NoPager = !pager.Enabled(ctx.flagBool("no-pager"), conf.Display.NoPager, conf.Display.Pager)
+
+	return nil
+}
+
+// stdoutFile is stdout if it's a real file (or terminal), which is what
+// paging and color need to look at
+func (ctx *Context) stdoutFile() *os.File {
+	f, _ := ctx.Stdout.(*os.File)
+	return f
+}
+
+// pager returns where to write output that should be paged if it's long
+func (ctx *Context) pager(enabled bool) io.WriteCloser {
+	f := ctx.stdoutFile()
+	if f == nil {
+		return nopCloser{ctx.Stdout}
+	}
+	opts := &ctx.Config.Opts
+	// Outside a session, nothing's looked at the terminal yet
+	height := opts.ScreenHeight
+	if height == 0 {
+		_, height = termsize.SizeOrDefault()
+	}
+	return pager.New(f, ctx.Config.Display.Pager, height, enabled && !opts.NoPager)
+}
+
+func (ctx *Context) colorEnabled() bool {
+	f := ctx.stdoutFile()
+	return f != nil && render.ColorEnabled(f)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
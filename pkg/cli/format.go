@@ -0,0 +1,123 @@
+package cli
+
+// --format json and --schema: answers that have to be JSON (matching a
+// schema, for --schema). Ollama is told the format, which it mostly sticks
+// to, but the answer is checked anyway and the model asked again, told
+// what was wrong, when it isn't right.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/duluk/ask-ollama/pkg/LLM"
+	"github.com/duluk/ask-ollama/pkg/output"
+	"github.com/duluk/ask-ollama/pkg/schema"
+)
+
+type answerFormat struct {
+	// What Ollama is sent as format
+	ollama json.RawMessage
+	// nil for any JSON
+	schema *schema.Schema
+}
+
+// newAnswerFormat is the format for --format (which can only be json) or
+// --schema, or nil if neither was given
+func newAnswerFormat(format, schemaPath string) (*answerFormat, error) {
+	if schemaPath != "" {
+		s, err := schema.Load(schemaPath)
+		if err != nil {
+			return nil, err
+		}
+		return &answerFormat{ollama: s.JSON(), schema: s}, nil
+	}
+	if format != "" {
+		return &answerFormat{ollama: json.RawMessage(`"json"`)}, nil
+	}
+	return nil, nil
+}
+
+// check returns the JSON in answer if it's what was asked for. Models
+// sometimes put it in a code block anyway, which is let go.
+func (f *answerFormat) check(answer string) (string, error) {
+	text := strings.TrimSpace(answer)
+	if strings.HasPrefix(text, "```") && strings.HasSuffix(text, "```") {
+		text = strings.TrimSuffix(text, "```")
+		// Along with the language, if there is one
+		if i := strings.Index(text, "\n"); i >= 0 {
+			text = text[i+1:]
+		}
+		text = strings.TrimSpace(text)
+	}
+
+	if f.schema != nil {
+		return text, f.schema.Validate([]byte(text))
+	}
+	var v any
+	if err := json.Unmarshal([]byte(text), &v); err != nil {
+		return text, fmt.Errorf("not valid JSON: %v", err)
+	}
+	return text, nil
+}
+
+// retryPrompt tells the model what was wrong with its last answer
+func (f *answerFormat) retryPrompt(err error) string {
+	what := "valid JSON"
+	if f.schema != nil {
+		what = "JSON that matches the schema"
+	}
+	return fmt.Sprintf("That isn't %s: %v. Answer again with only %s, and nothing else.", what, err, what)
+}
+
+// answerWithFormat gets an answer in the format asked for, asking again up
+// to general.format_retries times if need be. Only the JSON is printed
+// (or, with --output, the usual answer object with the JSON as its text).
+func (s *session) answerWithFormat(client LLM.Client, args LLM.ClientArgs) (LLM.ClientResponse, error) {
+	opts := &s.conf.Opts
+	retries := s.conf.General.FormatRetries
+
+	// Nothing's shown until it's been checked
+	args.Output = io.Discard
+	args.Stream = false
+	args.OnChunk = nil
+
+	var resp LLM.ClientResponse
+	var inputTokens, outputTokens int32
+	for try := 0; ; try++ {
+		var err error
+		resp, err = client.Chat(args, opts.WrapWidth(), opts.TabWidth)
+		inputTokens += resp.InputTokens
+		outputTokens += resp.OutputTokens
+		if err != nil {
+			return resp, err
+		}
+
+		answer, err := s.format.check(resp.Answer)
+		if err == nil {
+			resp.Answer = answer
+			break
+		}
+		if try == retries {
+			return resp, fmt.Errorf("the answer still wasn't right after %d %s: %v", try+1, plural(try+1, "try", "tries"), err)
+		}
+		fmt.Fprintf(s.ctx.Stderr, "The answer wasn't right (%v); asking again\n", err)
+
+		// The model gets to see what it said, and what was wrong with it
+		args.Context = append(args.Context,
+			LLM.LLMConversations{Role: "User", Content: *args.Prompt},
+			LLM.LLMConversations{Role: "Assistant", Content: resp.Answer, Model: *args.Model},
+		)
+		prompt := s.format.retryPrompt(err)
+		args.Prompt = &prompt
+	}
+	// For what it took altogether
+	resp.InputTokens, resp.OutputTokens = inputTokens, outputTokens
+
+	if opts.Output.Machine() {
+		return resp, output.WriteAnswer(s.ctx.Stdout, opts.Output, output.NewAnswer(resp, *args.ConvID))
+	}
+	_, err := fmt.Fprintln(s.ctx.Stdout, resp.Answer)
+	return resp, err
+}
@@ -0,0 +1,263 @@
+package cli
+
+// Commands for looking through past conversations in the database
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+
+	"github.com/duluk/ask-ollama/pkg/LLM"
+	"github.com/duluk/ask-ollama/pkg/database"
+	"github.com/duluk/ask-ollama/pkg/ollama"
+)
+
+var showCommand = &Command{
+	Name:    "show",
+	Args:    "<id>",
+	Summary: "Show a conversation",
+	Flags:   pagerFlags,
+	Run: func(ctx *Context) error {
+		id, err := convIDArg(ctx)
+		if err != nil {
+			return err
+		}
+		return showConversation(ctx, id)
+	},
+}
+
+var searchCommand = &Command{
+	Name:    "search",
+	Args:    "<text>",
+	Summary: "Find conversations with answers containing some text",
+	Description: `
+With --semantic, conversations are found by what they were about rather
+than the words in them, using embeddings.model from the config.`,
+	Flags: func(fs *pflag.FlagSet) {
+		fs.Bool("semantic", false, "Find turns that mean much the same as the text")
+		fs.Bool("hybrid", false, "Like --semantic, but the words themselves count too (see embeddings.keyword_weight)")
+		fs.IntP("limit", "n", 10, "Most turns to show with --semantic")
+	},
+	Run: runSearch,
+}
+
+var exportCommand = &Command{
+	Name:    "export",
+	Args:    "<id>",
+	Summary: "Write out a conversation as markdown, JSON or YAML",
+	Flags: func(fs *pflag.FlagSet) {
+		fs.StringP("format", "F", "markdown", "Format: markdown, json or yaml")
+		fs.StringP("out", "O", "", "File to write to (default stdout)")
+	},
+	Run: runExport,
+}
+
+func convIDArg(ctx *Context) (int, error) {
+	if len(ctx.Args) != 1 {
+		return 0, usageErrorf("expected a conversation ID")
+	}
+	id, err := strconv.Atoi(ctx.Args[0])
+	if err != nil || id <= 0 {
+		return 0, usageErrorf("invalid conversation ID: %s", ctx.Args[0])
+	}
+	return id, nil
+}
+
+func openDB(ctx *Context) (*database.ChatDB, error) {
+	conf := ctx.Config
+	if conf.Database.Path == "" {
+		return nil, fmt.Errorf("database file not set")
+	}
+	if conf.Database.TableName == "" {
+		return nil, fmt.Errorf("database table not set")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(conf.Database.Path), 0755); err != nil {
+		return nil, fmt.Errorf("error creating database directory: %v", err)
+	}
+
+	// If DB exists, it just opens it; otherwise, it creates it first
+	db, err := database.InitializeDB(conf.Database.Path, conf.Database.TableName)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %v", err)
+	}
+	return db, nil
+}
+
+func showConversation(ctx *Context, convID int) error {
+	db, err := openDB(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	out := ctx.pager(true)
+	err = db.ShowConversation(out, convID)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func runSearch(ctx *Context) error {
+	if len(ctx.Args) == 0 {
+		return usageErrorf("expected something to search for")
+	}
+
+	if ctx.flagBool("semantic") || ctx.flagBool("hybrid") {
+		return runSemanticSearch(ctx, strings.Join(ctx.Args, " "))
+	}
+
+	db, err := openDB(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ids, err := db.SearchForConversation(strings.Join(ctx.Args, " "))
+	if err != nil {
+		return fmt.Errorf("error searching for conversation: %v", err)
+	}
+
+	uniqIDs := make([]string, 0)
+	unique := make(map[int]bool)
+	for _, id := range ids {
+		if !unique[id] {
+			unique[id] = true
+			uniqIDs = append(uniqIDs, strconv.Itoa(id))
+		}
+	}
+
+	fmt.Fprintf(ctx.Stdout, "Found %d conversations: %s\n", len(uniqIDs), strings.Join(uniqIDs, ", "))
+	return nil
+}
+
+// runSemanticSearch lists the turns closest in meaning to text, best first
+func runSemanticSearch(ctx *Context, text string) error {
+	conf := ctx.Config
+	model := conf.Embeddings.Model
+	if model == "" {
+		return fmt.Errorf("semantic search needs an embedding model: set embeddings.model in the config (eg, nomic-embed-text)")
+	}
+	limit := ctx.flagInt("limit")
+	if limit <= 0 {
+		return usageErrorf("--limit must be more than 0")
+	}
+
+	return withDB(ctx, func(db *database.ChatDB) error {
+		client := ollama.NewClient(conf.General.BaseURL, "")
+		n, err := embedTurns(db, client, model, 0)
+		if n > 0 {
+			fmt.Fprintf(ctx.Stderr, "Embedded %d %s that hadn't been\n", n, plural(n, "turn", "turns"))
+		}
+		if err != nil {
+			return err
+		}
+
+		vectors, err := client.Embed(model, []string{text})
+		if err != nil {
+			return fmt.Errorf("error embedding with %s: %v", model, err)
+		}
+		query := database.SemanticQuery{Model: model, Vector: vectors[0], Limit: limit}
+		if ctx.flagBool("hybrid") {
+			query.Keywords = text
+			query.KeywordWeight = conf.Embeddings.KeywordWeight
+		}
+		matches, err := db.SemanticSearch(query)
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			fmt.Fprintln(ctx.Stdout, "No conversations found")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(ctx.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SCORE\tCONV\tTIME\tPROMPT")
+		for _, m := range matches {
+			fmt.Fprintf(w, "%.2f\t%d\t%s\t%s\n", m.Score, m.ConvID, m.Timestamp, m.Title())
+		}
+		return w.Flush()
+	})
+}
+
+func runExport(ctx *Context) error {
+	id, err := convIDArg(ctx)
+	if err != nil {
+		return err
+	}
+
+	format := ctx.flagString("format")
+	switch format {
+	case "markdown", "md", "json", "yaml", "yml":
+	default:
+		return usageErrorf("unknown export format: %s (expected markdown, json or yaml)", format)
+	}
+
+	db, err := openDB(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	conv, err := db.LoadConversationFromDB(id)
+	if err != nil {
+		return err
+	}
+	if len(conv) == 0 {
+		return fmt.Errorf("no conversation with ID %d", id)
+	}
+
+	out := ctx.Stdout
+	if path := ctx.flagString("out"); path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(conv)
+	case "yaml", "yml":
+		return yaml.NewEncoder(out).Encode(conv)
+	}
+	return exportMarkdown(out, id, conv)
+}
+
+func exportMarkdown(w io.Writer, id int, conv []LLM.LLMConversations) error {
+	fmt.Fprintf(w, "# Conversation %d\n", id)
+	for _, turn := range conv {
+		// The log says "User" and the database "user"
+		if strings.EqualFold(turn.Role, "user") {
+			fmt.Fprintf(w, "\n## User\n\n")
+			if len(turn.Attachments) > 0 {
+				fmt.Fprintf(w, "_Attached: %s_\n\n", strings.Join(turn.Attachments, ", "))
+			}
+			for _, img := range turn.Images {
+				fmt.Fprintf(w, "_Image: %s_\n\n", img.Path)
+			}
+		} else {
+			fmt.Fprintf(w, "\n## Assistant (%s)\n\n", turn.Model)
+			for _, call := range turn.ToolCalls {
+				fmt.Fprintf(w, "_Called %s_\n\n", call)
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", strings.TrimSpace(turn.Content)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package cli
+
+// Answering from indexed documents: index embeds the files in a directory,
+// and --rag sends the excerpts closest to each prompt along with it
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/duluk/ask-ollama/pkg/ollama"
+	"github.com/duluk/ask-ollama/pkg/rag"
+)
+
+var indexCommand = &Command{
+	Name:    "index",
+	Args:    "<dir>...",
+	Summary: "Index the documents in a directory, to answer from them with --rag",
+	Description: `
+The text files in each directory (and those under it) are split into
+excerpts and embedded with embeddings.model from the config. Running it
+again only embeds the files that have changed, and forgets the ones that
+have gone.`,
+	Run: runIndex,
+}
+
+func runIndex(ctx *Context) error {
+	if len(ctx.Args) == 0 {
+		return usageErrorf("expected a directory to index")
+	}
+
+	idx, err := openIndex(ctx)
+	if err != nil {
+		return err
+	}
+	defer idx.Close()
+
+	for _, dir := range ctx.Args {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("%s isn't a directory", dir)
+		}
+		stats, err := idx.Update(dir)
+		for _, skip := range stats.Skipped {
+			fmt.Fprintf(ctx.Stderr, "Skipping %s: %s\n", relPath(skip.Path), skip.Reason)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(ctx.Stdout, "%s: %s\n", dir, stats)
+	}
+	return nil
+}
+
+// openIndex opens the document index, embedding with the embeddings model
+func openIndex(ctx *Context) (*rag.Index, error) {
+	conf := ctx.Config
+	model := conf.Embeddings.Model
+	if model == "" {
+		return nil, fmt.Errorf("indexing documents needs an embedding model: set embeddings.model in the config (eg, nomic-embed-text)")
+	}
+
+	client := ollama.NewClient(conf.General.BaseURL, "")
+	idx, err := rag.Open(conf.RAG.Index, model, func(texts []string) ([][]float32, error) {
+		vectors, err := client.Embed(model, texts)
+		if err != nil {
+			return nil, fmt.Errorf("error embedding with %s: %v", model, err)
+		}
+		return vectors, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	idx.ChunkSize = conf.RAG.ChunkSize
+	idx.MaxFileSize = conf.General.MaxAttachmentSize
+	return idx, nil
+}
+
+// openRAG opens the index for --rag, making sure each of the directories
+// has been indexed
+func (s *session) openRAG() error {
+	idx, err := openIndex(s.ctx)
+	if err != nil {
+		return err
+	}
+	for _, dir := range s.conf.Opts.RAG {
+		indexed, err := idx.Indexed(dir)
+		if err != nil {
+			idx.Close()
+			return err
+		}
+		if !indexed {
+			idx.Close()
+			return fmt.Errorf("%s hasn't been indexed; run %s index %s", dir, progName, dir)
+		}
+	}
+	s.index = idx
+	return nil
+}
+
+// retrieve adds the excerpts closest to prompt to it, from all the --rag
+// directories together
+func (s *session) retrieve(prompt string) (string, error) {
+	vectors, err := s.index.Embed([]string{prompt})
+	if err != nil {
+		return "", err
+	}
+
+	topK := s.conf.RAG.TopK
+	var results []rag.Result
+	for _, dir := range s.conf.Opts.RAG {
+		found, err := s.index.Search(dir, vectors[0], topK)
+		if err != nil {
+			return "", err
+		}
+		results = append(results, found...)
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > topK {
+		results = results[:topK]
+	}
+	if len(results) == 0 {
+		return prompt, nil
+	}
+
+	cites := make([]string, len(results))
+	for i := range results {
+		results[i].Path = relPath(results[i].Path)
+		cites[i] = results[i].Cite()
+	}
+	fmt.Fprintf(s.ctx.Stderr, "Sending %d %s: %s\n", len(results), plural(len(results), "excerpt", "excerpts"), strings.Join(cites, ", "))
+	return rag.BuildPrompt(prompt, results), nil
+}
+
+// relPath is path relative to the working directory, if it's under it, as
+// that's how it's most likely to be recognised
+func relPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	if wd, err = filepath.EvalSymlinks(wd); err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return rel
+}
@@ -0,0 +1,108 @@
+package cli
+
+// --recall: the exchanges from past conversations most relevant to a
+// prompt, found by their embeddings if there's an embedding model or by
+// their words if not, go in the system prompt as background. They aren't
+// part of the prompt, so they aren't saved with it (and recalled again).
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/duluk/ask-ollama/pkg/database"
+	"github.com/duluk/ask-ollama/pkg/ollama"
+)
+
+// Bytes of each prompt and answer recalled; the rest is left out
+const recallMaxBytes = 2000
+
+// recall finds the exchanges most relevant to prompt, leaving out the
+// conversation it's part of
+func (s *session) recall(prompt string) ([]database.Match, error) {
+	conf := s.conf
+	limit := conf.Opts.Recall
+	convID := 0
+	if s.clientArgs.ConvID != nil {
+		convID = *s.clientArgs.ConvID
+	}
+
+	model := conf.Embeddings.Model
+	if model == "" {
+		return s.db.KeywordSearch(prompt, convID, limit)
+	}
+
+	client := ollama.NewClient(conf.General.BaseURL, "")
+	n, err := embedTurns(s.db, client, model, 0)
+	if n > 0 {
+		fmt.Fprintf(s.ctx.Stderr, "Embedded %d %s that hadn't been\n", n, plural(n, "turn", "turns"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	vectors, err := client.Embed(model, []string{prompt})
+	if err != nil {
+		return nil, fmt.Errorf("error embedding with %s: %v", model, err)
+	}
+	return s.db.SemanticSearch(database.SemanticQuery{
+		Model:         model,
+		Vector:        vectors[0],
+		Keywords:      prompt,
+		KeywordWeight: conf.Embeddings.KeywordWeight,
+		ExcludeConv:   convID,
+		Limit:         limit,
+	})
+}
+
+// recallPrompt is the system prompt with the exchanges recalled for prompt
+// after it
+func (s *session) recallPrompt(prompt string) (string, error) {
+	matches, err := s.recall(prompt)
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return s.systemPrompt, nil
+	}
+
+	var convs []string
+	seen := make(map[int]bool)
+	for _, m := range matches {
+		if !seen[m.ConvID] {
+			seen[m.ConvID] = true
+			convs = append(convs, strconv.Itoa(m.ConvID))
+		}
+	}
+	fmt.Fprintf(s.ctx.Stderr, "Recalled %d earlier %s (%s %s)\n", len(matches), plural(len(matches), "exchange", "exchanges"),
+		plural(len(convs), "conversation", "conversations"), strings.Join(convs, ", "))
+	return recallBackground(s.systemPrompt, matches), nil
+}
+
+// recallBackground adds the exchanges to the system prompt, each marked off
+// so they can't be mistaken for this conversation
+func recallBackground(systemPrompt string, matches []database.Match) string {
+	var sb strings.Builder
+	sb.WriteString(systemPrompt)
+	sb.WriteString("\n\nHere are some exchanges from earlier conversations that may be relevant. Build on them where they help, and ignore them where they don't; they aren't part of this conversation.\n")
+	for _, m := range matches {
+		fmt.Fprintf(&sb, "\n--- BEGIN EARLIER EXCHANGE (conversation %d, %s) ---\n", m.ConvID, m.Timestamp)
+		fmt.Fprintf(&sb, "User: %s\n", clip(m.Prompt, recallMaxBytes))
+		fmt.Fprintf(&sb, "Assistant: %s\n", clip(m.Response, recallMaxBytes))
+		sb.WriteString("--- END EARLIER EXCHANGE ---\n")
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// clip cuts s down to max bytes (without splitting a character)
+func clip(s string, max int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= max {
+		return s
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + " [...]"
+}
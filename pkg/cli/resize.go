@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"sync"
+
+	"github.com/duluk/ask-ollama/pkg/config"
+	"github.com/duluk/ask-ollama/pkg/termsize"
+)
+
+// The answer writers can have their width changed while they're in use
+type resizable interface {
+	SetWidth(width int)
+}
+
+// screen tracks the terminal's size as it's resized. The signal handler runs
+// on its own goroutine, so it only touches this (and the writer of the answer
+// being shown); conf.Opts is updated from it on the main goroutine before
+// each answer.
+var screen struct {
+	sync.Mutex
+	width, height int
+	maxWidth      int
+	writer        resizable
+}
+
+// watchScreenSize sets the screen size in opts from the terminal, and keeps
+// track of it from then on
+func watchScreenSize(opts *config.Options) (stop func()) {
+	opts.ScreenWidth, opts.ScreenHeight = termsize.SizeOrDefault()
+	screen.Lock()
+	screen.width, screen.height = opts.ScreenWidth, opts.ScreenHeight
+	screen.maxWidth = opts.MaxWidth
+	screen.Unlock()
+
+	return termsize.Watch(func(width, height int) {
+		screen.Lock()
+		defer screen.Unlock()
+		screen.width, screen.height = width, height
+		if screen.writer != nil {
+			screen.writer.SetWidth(config.WrapWidth(width, screen.maxWidth))
+		}
+	})
+}
+
+// updateScreenSize picks up any resize since the last call and sets the
+// writer that's showing the answer (nil once it's done), bringing its width
+// up to date in case the terminal changed since it was made
+func updateScreenSize(opts *config.Options, writer resizable) {
+	screen.Lock()
+	defer screen.Unlock()
+	opts.ScreenWidth, opts.ScreenHeight = screen.width, screen.height
+	screen.writer = writer
+	if writer != nil {
+		writer.SetWidth(opts.WrapWidth())
+	}
+}
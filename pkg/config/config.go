@@ -2,52 +2,96 @@ package config
 
 import (
 	"fmt"
+	"io"
+	"maps"
 	"os"
-	"path/filepath"
-
-	"golang.org/x/term"
+	"slices"
 
 	"gopkg.in/yaml.v3"
 
 	"github.com/mitchellh/mapstructure"
-	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
-	"github.com/duluk/ask-ollama/pkg/database"
+	"github.com/duluk/ask-ollama/pkg/LLM"
+	"github.com/duluk/ask-ollama/pkg/attachments"
+	"github.com/duluk/ask-ollama/pkg/output"
+	"github.com/duluk/ask-ollama/pkg/pager"
+	"github.com/duluk/ask-ollama/pkg/rag"
+	"github.com/duluk/ask-ollama/pkg/tools"
 )
 
 const Version = "0.0.1"
 
-const MaxTermWidth = 80
-const widthPad = 5
 const TabWidth = 4
 
+// DefaultContextLength is context.default_length if it isn't set
+const DefaultContextLength = 8192
+
+// DefaultKeywordWeight is embeddings.keyword_weight if it isn't set
+const DefaultKeywordWeight = 0.3
+
+// DefaultFormatRetries is general.format_retries if it isn't set
+const DefaultFormatRetries = 2
+
+// DefaultTopK is rag.top_k if it isn't set
+const DefaultTopK = 5
+
 var (
 	commit = "Unknown"
 	date   = "Unknown"
 )
 
 type Config struct {
-	General  GeneralConfig    `mapstructure:"general"`
-	Models   map[string]Model `mapstructure:"models"`
-	Logging  LogConfig        `mapstructure:"logging"`
-	Database DBConfig         `mapstructure:"database"`
-	Roles    map[string]Role  `mapstructure:"roles"`
-	Opts     Options
+	// The model used when --model isn't given (a key, alias or tag from
+	// Models). If it isn't set and there's only one model, that's it.
+	Model      string           `mapstructure:"model"`
+	General    GeneralConfig    `mapstructure:"general"`
+	Models     map[string]Model `mapstructure:"models"`
+	Logging    LogConfig        `mapstructure:"logging"`
+	Database   DBConfig         `mapstructure:"database"`
+	Roles      map[string]Role  `mapstructure:"roles"`
+	Display    DisplayConfig    `mapstructure:"display"`
+	Context    ContextConfig    `mapstructure:"context"`
+	Tools      ToolsConfig      `mapstructure:"tools"`
+	Embeddings EmbeddingsConfig `mapstructure:"embeddings"`
+	RAG        RAGConfig        `mapstructure:"rag"`
+	Opts       Options
+
+	// The config files that were read, in the order they were merged
+	Files []string `mapstructure:"-" yaml:"-"`
+	// The keys set by environment variables, and which ones
+	env map[string]string
 }
 
 type GeneralConfig struct {
 	BaseURL string `mapstructure:"base_url"`
+	// Largest file (or piped stdin) that will be attached to a prompt
+	MaxAttachmentSize int64 `mapstructure:"max_attachment_size"`
+	// Largest image that will be sent with --image
+	MaxImageSize int64 `mapstructure:"max_image_size"`
+	// Show answers as they're generated
+	Stream bool `mapstructure:"stream"`
+	// With --format or --schema, how many more times the model is asked
+	// when its answer isn't the JSON that was asked for
+	FormatRetries int `mapstructure:"format_retries"`
 }
 
 type Model struct {
-	Name             string  `mapstructure:"name"`
-	MaxTokens        int     `mapstructure:"max_tokens"`
-	Temperature      float64 `mapstructure:"temperature"`
-	TopP             float64 `mapstructure:"top_p"`
-	PresencePenalty  float64 `mapstructure:"presence_penalty,omitempty"`
-	FrequencyPenalty float64 `mapstructure:"frequency_penalty,omitempty"`
-	Timeout          int     `mapstructure:"timeout"`
+	Name string `mapstructure:"name"`
+	// Other names it can be given by, with --model
+	Aliases          []string `mapstructure:"aliases"`
+	MaxTokens        int      `mapstructure:"max_tokens"`
+	Temperature      float64  `mapstructure:"temperature"`
+	TopP             float64  `mapstructure:"top_p"`
+	PresencePenalty  float64  `mapstructure:"presence_penalty,omitempty"`
+	FrequencyPenalty float64  `mapstructure:"frequency_penalty,omitempty"`
+	Timeout          int      `mapstructure:"timeout"`
+	// The context window to ask Ollama for (num_ctx). If it isn't set, it's
+	// the model's own, up to context.default_length.
+	ContextLength int `mapstructure:"context_length"`
+	// A tokenizer.json for counting the model's tokens. If it isn't set,
+	// there may be one for its family in TokenizerDir.
+	Tokenizer string `mapstructure:"tokenizer"`
 }
 
 type LogConfig struct {
@@ -64,6 +108,91 @@ type DBConfig struct {
 	BackupInterval int    `mapstructure:"backup_interval"`
 }
 
+type DisplayConfig struct {
+	// Syntax highlighting theme for code blocks, and any colors (token kind
+	// to SGR parameters, eg `keyword: "1;35"`) to change in it
+	Theme       string            `mapstructure:"theme"`
+	ThemeColors map[string]string `mapstructure:"theme_colors"`
+	// Long answers and transcripts are shown with this ($PAGER or `less -R`
+	// if empty) unless paging is turned off
+	Pager   string `mapstructure:"pager"`
+	NoPager bool   `mapstructure:"no_pager"`
+	// Answers are wrapped at the terminal's width, but no wider than this
+	// (0 for no limit). Long lines are hard to read on a wide terminal.
+	MaxWidth int `mapstructure:"max_width"`
+}
+
+// ContextConfig is what to do with conversations too long for a model's
+// context window
+type ContextConfig struct {
+	// drop_oldest, keep_ends or summarize
+	Strategy string `mapstructure:"strategy"`
+	// For keep_ends, the turns to keep from the start and the end
+	KeepFirst int `mapstructure:"keep_first"`
+	KeepLast  int `mapstructure:"keep_last"`
+	// The context window for models without context_length, unless the
+	// model's own is smaller. Ollama's default is a lot smaller than most
+	// models can take, but a bigger one takes more memory.
+	DefaultLength int `mapstructure:"default_length"`
+	// For summarize, the model that writes the summaries, if not the one
+	// being talked to. A small, quick one does fine.
+	SummaryModel string `mapstructure:"summary_model"`
+}
+
+// ToolsConfig is the tools a model can call with --tools
+type ToolsConfig struct {
+	// Which of the built-in tools to offer, all of them by default
+	Enabled []string `mapstructure:"enabled"`
+	// Rounds of tool calls before the model has to answer
+	MaxRounds int `mapstructure:"max_rounds"`
+	// The commands run_command may run (with any arguments), none by
+	// default, so there's no run_command unless some are listed
+	Commands []string `mapstructure:"commands"`
+	// allow, ask or deny for each tool. Looking at files and history is
+	// allowed by default, but running a command has to be asked about.
+	Policy map[string]string `mapstructure:"policy"`
+	// The directories read_file and list_directory can look in, relative
+	// to the working directory (which is all they can by default)
+	Paths []string `mapstructure:"paths"`
+	// Seconds a call can take
+	Timeout int `mapstructure:"timeout"`
+	// Bytes of what a call returns that are passed on to the model
+	MaxOutput int `mapstructure:"max_output"`
+}
+
+// Policies is Policy parsed, leaving out any that aren't valid
+func (t ToolsConfig) Policies() map[string]tools.Policy {
+	policies := make(map[string]tools.Policy)
+	for name, s := range t.Policy {
+		if p, err := tools.ParsePolicy(s); err == nil {
+			policies[name] = p
+		}
+	}
+	return policies
+}
+
+// EmbeddingsConfig is for finding past conversations by what they were
+// about (search --semantic)
+type EmbeddingsConfig struct {
+	// The embedding model, eg nomic-embed-text. Without one, nothing is
+	// embedded.
+	Model string `mapstructure:"model"`
+	// With search --hybrid, how much matching the words searched for counts
+	// (0 to 1) against matching their meaning
+	KeywordWeight float64 `mapstructure:"keyword_weight"`
+}
+
+// RAGConfig is for answering from indexed documents (index and --rag),
+// which are embedded with the embeddings model
+type RAGConfig struct {
+	// The index of the documents, a database of its own
+	Index string `mapstructure:"index"`
+	// How many excerpts are sent with a prompt
+	TopK int `mapstructure:"top_k"`
+	// About how many bytes are in each excerpt
+	ChunkSize int `mapstructure:"chunk_size"`
+}
+
 type Role struct {
 	Description string `mapstructure:"description"`
 	Prompt      string `mapstructure:"prompt"`
@@ -71,14 +200,42 @@ type Role struct {
 
 type Options struct {
 	Model string
-	// Context        int
+	Role  string
+	// How many relevant exchanges from past conversations to add to each
+	// prompt, with --recall
+	Recall int
 	// ContextLength  int
 	ContinueChat   bool
-	DumpConfig     bool
 	ConversationID int
-	ScreenWidth    int
-	ScreenHeight   int
-	TabWidth       int
+	Files          []string
+	Images         []string
+	// The indexed directories to send excerpts from
+	RAG   []string
+	Tools bool
+	// --format json, or the schema file from --schema
+	Format       string
+	Schema       string
+	Raw          bool
+	NoPager      bool
+	Stream       bool
+	Output       output.Format
+	ScreenWidth  int
+	ScreenHeight int
+	MaxWidth     int
+	TabWidth     int
+}
+
+// WrapWidth is the width answers should be wrapped at
+func (o *Options) WrapWidth() int {
+	return WrapWidth(o.ScreenWidth, o.MaxWidth)
+}
+
+// WrapWidth is the terminal's width, capped at maxWidth if that's set
+func WrapWidth(screenWidth, maxWidth int) int {
+	if maxWidth > 0 && maxWidth < screenWidth {
+		return maxWidth
+	}
+	return screenWidth
 }
 
 func (c *Config) String() string {
@@ -89,52 +246,50 @@ func (c *Config) String() string {
 	return string(b)
 }
 
-func Initialize() (*Config, error) {
-	configDir := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "ask-ollama")
-	if configDir == "" {
-		configDir = filepath.Join(os.Getenv("HOME"), ".config", "ask-ollama")
-	}
-
-	viper.SetConfigName("config")
-	viper.SetConfigType("yml")
-	viper.AddConfigPath(configDir)
-
-	pflag.StringP("config", "C", "", "Configuration file")
-	pflag.StringP("model", "m", "", "Model to use")
-	pflag.IntP("id", "i", 0, "Conversation ID")
-	pflag.IntP("show", "s", 0, "Show conversation")
-	pflag.BoolP("continue", "c", false, "Continue conversation")
-	pflag.BoolP("version", "v", false, "Show version")
-	pflag.BoolP("full-version", "V", false, "Show full version")
-	pflag.BoolP("dump-config", "d", false, "Dump configuration")
-
-	pflag.Parse()
-
-	if err := viper.BindPFlags(pflag.CommandLine); err != nil {
-		return nil, fmt.Errorf("error binding flags: %w", err)
+// Load reads the config file at path or, if path is empty, merges the
+// config files there are (see Files), then any environment variables on top
+// (see EnvVar). It doesn't look at the command line or
+// print anything; flags are up to the caller. Having no config file isn't an
+// error (there are defaults for everything but the models), in which case
+// Files is left empty.
+func Load(path string) (*Config, error) {
+	v := viper.New()
+	v.SetConfigType("yml")
+
+	v.SetDefault("general.base_url", DefaultBaseURL)
+	v.SetDefault("logging.log_file", defaultPath(StateDir(), "ask-ollama.chat.yml"))
+	v.SetDefault("database.path", defaultPath(DataDir(), "ask-ollama.db"))
+	v.SetDefault("database.table_name", "conversations")
+	v.SetDefault("general.max_attachment_size", attachments.DefaultMaxSize)
+	v.SetDefault("general.max_image_size", attachments.DefaultMaxImageSize)
+	v.SetDefault("general.format_retries", DefaultFormatRetries)
+	v.SetDefault("context.strategy", "drop_oldest")
+	v.SetDefault("context.keep_first", 1)
+	v.SetDefault("context.keep_last", 4)
+	v.SetDefault("context.default_length", DefaultContextLength)
+	v.SetDefault("embeddings.keyword_weight", DefaultKeywordWeight)
+	v.SetDefault("rag.index", defaultPath(DataDir(), "ask-ollama.index.db"))
+	v.SetDefault("rag.top_k", DefaultTopK)
+	v.SetDefault("rag.chunk_size", rag.DefaultChunkSize)
+	v.SetDefault("tools.enabled", tools.Builtins)
+	v.SetDefault("tools.max_rounds", LLM.DefaultToolRounds)
+	v.SetDefault("tools.paths", []string{"."})
+	v.SetDefault("tools.timeout", int(tools.DefaultTimeout.Seconds()))
+	v.SetDefault("tools.max_output", tools.DefaultMaxOutput)
+
+	// A file given on the command line is read on its own
+	files := []string{path}
+	if path == "" {
+		files = Files()
 	}
-
-	viper.SetDefault("model", "deepseek-r1")
-	viper.SetDefault("logging.log_file", filepath.Join(configDir, "ask-ollama.chat.yml"))
-	viper.SetDefault("database.path", filepath.Join(configDir, "ask-ollama.db"))
-	viper.SetDefault("database.table_name", "conversations")
-	// viper.SetDefault("screen.width", width)
-	// viper.SetDefault("screen.height", height)
-
-	if configFile := viper.GetString("config"); configFile != "" {
-		viper.SetConfigFile(configFile)
-	}
-
-	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			return nil, fmt.Errorf("error reading config file (%s): %w", viper.ConfigFileUsed(), err)
+	for _, file := range files {
+		v.SetConfigFile(file)
+		if err := v.MergeInConfig(); err != nil {
+			return nil, fmt.Errorf("error reading config file (%s): %w", file, err)
 		}
-		fmt.Printf("Config file read: %s\n", viper.ConfigFileUsed())
 	}
 
-	// Setup environment variables
-	viper.AutomaticEnv()
-	viper.SetEnvPrefix("ASKOLLAMA")
+	env := bindEnv(v)
 
 	var config Config
 	decoderConfig := viper.DecoderConfigOption(func(dc *mapstructure.DecoderConfig) {
@@ -143,140 +298,54 @@ func Initialize() (*Config, error) {
 		dc.WeaklyTypedInput = true
 	})
 
-	if err := viper.Unmarshal(&config, decoderConfig); err != nil {
+	if err := v.Unmarshal(&config, decoderConfig); err != nil {
 		return nil, fmt.Errorf("error unmarshaling config: %w", err)
 	}
 
+	config.Files = files
+	config.env = env
 	config.Logging.LogFile = os.ExpandEnv(config.Logging.LogFile)
 	config.Database.Path = os.ExpandEnv(config.Database.Path)
-
-	// fmt.Printf("Config loaded: %+v\n", config)
-
-	config.Opts.Model = viper.GetString("model")
-	config.Opts.ConversationID = viper.GetInt("id")
-	config.Opts.ContinueChat = viper.GetBool("continue")
-	config.Opts.ScreenWidth, config.Opts.ScreenHeight = determineScreenSize()
-	config.Opts.TabWidth = TabWidth
-	config.Opts.DumpConfig = viper.GetBool("dump-config")
-
-	// fmt.Printf("Config dump: %+v\n", config)
-
-	// Handle version flags and bail if necessary
-	if handleVersionFlags() {
-		os.Exit(0)
-	}
-
-	// if viper.GetString("search") != "" {
-	// 	searchForConversation(viper.GetString("search"))
-	// }
-
-	if viper.GetInt("show") != 0 {
-		showConversation(viper.GetInt("show"))
-	}
-
-	return &config, nil
-}
-
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
-func max(a, b int) int {
-	return -min(-a, -b)
-}
-
-// Maybe this shouldn't be in config...
-func searchForConversation(search string) {
-	if viper.GetString("database.file") == "" {
-		fmt.Println("Database file not set")
-		os.Exit(1)
-	}
-	if viper.GetString("database.table") == "" {
-		fmt.Println("Database table not set")
-		os.Exit(1)
-	}
-
-	db, err := database.InitializeDB(os.ExpandEnv(viper.GetString("database.file")), viper.GetString("database.table"))
-	if err != nil {
-		fmt.Printf("Error opening database: %s", err)
-		os.Exit(1)
-	}
-	defer db.Close()
-
-	ids, err := db.SearchForConversation(search)
-	if err != nil {
-		fmt.Printf("Error searching for conversation: %s", err)
-	}
-
-	uniqIDs := make([]int, 0)
-	unique := make(map[int]bool)
-	for _, id := range ids {
-		if !unique[id] {
-			unique[id] = true
-			uniqIDs = append(uniqIDs, id)
+	config.RAG.Index = os.ExpandEnv(config.RAG.Index)
+	for key, m := range config.Models {
+		if m.Tokenizer != "" {
+			m.Tokenizer = os.ExpandEnv(m.Tokenizer)
+			config.Models[key] = m
 		}
 	}
-
-	fmt.Printf("Found %d conversations: ", len(uniqIDs))
-	for i, id := range uniqIDs {
-		fmt.Printf("%d", id)
-		if i < len(uniqIDs)-1 {
-			fmt.Printf(", ")
-		}
+	for i, path := range config.Tools.Paths {
+		config.Tools.Paths[i] = os.ExpandEnv(path)
 	}
-	fmt.Println()
-
-	os.Exit(0)
-}
 
-func determineScreenSize() (int, int) {
-	width, height, err := term.GetSize(int(os.Stdin.Fd()))
-	if err != nil {
-		return 80, 24
-	}
+	// Options that come from the config file alone; the rest are set from
+	// flags by the command being run
+	config.Opts.Model = config.DefaultModel()
+	config.Opts.Stream = config.General.Stream
+	config.Opts.Output = output.Text
+	config.Opts.NoPager = !pager.Enabled(false, config.Display.NoPager, config.Display.Pager)
+	config.Opts.MaxWidth = config.Display.MaxWidth
+	config.Opts.TabWidth = TabWidth
 
-	return width, height
+	return &config, nil
 }
 
-func showConversation(convID int) {
-	if viper.GetString("database.file") == "" {
-		fmt.Println("Database file not set")
-		os.Exit(1)
-	}
-	if viper.GetString("database.table") == "" {
-		fmt.Println("Database table not set")
-		os.Exit(1)
-	}
-
-	db, err := database.InitializeDB(os.ExpandEnv(viper.GetString("database.file")), viper.GetString("database.table"))
-	if err != nil {
-		fmt.Printf("Error opening database: %s", err)
-		os.Exit(1)
-	}
-	defer db.Close()
-
-	db.ShowConversation(convID)
-	os.Exit(0)
+// VersionInfo is the version along with the commit and build date, which are
+// set by the Makefile
+func VersionInfo() string {
+	return fmt.Sprintf("Version: %s\nCommit:  %s\nDate:    %s", Version, commit, date)
 }
 
-func handleVersionFlags() bool {
-	if viper.GetBool("version") {
-		fmt.Println("ask-ollama version:", Version)
-		return true
+func (c *Config) DumpConfig(w io.Writer) {
+	if len(c.Files) == 0 {
+		fmt.Fprintln(w, "Config file: (none)")
 	}
-	if viper.GetBool("full-version") {
-		fmt.Printf("Version: %s\nCommit:  %s\nDate:    %s\n", Version, commit, date)
-		return true
+	for _, file := range c.Files {
+		fmt.Fprintf(w, "Config file: %s\n", file)
 	}
-	return false
-}
-
-func (c *Config) DumpConfig() {
-	fmt.Printf("Config file: %s\n", viper.ConfigFileUsed())
-	fmt.Printf("%s\n", c.String())
+	for _, key := range slices.Sorted(maps.Keys(c.env)) {
+		fmt.Fprintf(w, "Environment: %s (%s)\n", c.env[key], key)
+	}
+	fmt.Fprintf(w, "%s\n", c.String())
 }
 
 // // Example usage of roles
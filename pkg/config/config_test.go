@@ -0,0 +1,202 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+}
+
+// isolate points HOME and the XDG variables at an empty directory, so the
+// real config files aren't read
+func isolate(t *testing.T) string {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("XDG_STATE_HOME", "")
+	t.Setenv("XDG_CONFIG_DIRS", filepath.Join(home, "etc"))
+	t.Setenv("OLLAMA_HOST", "")
+	chdir(t, home)
+	return home
+}
+
+func TestDirs(t *testing.T) {
+	home := isolate(t)
+
+	assert.Equal(t, filepath.Join(home, ".config", "ask-ollama"), Dir())
+	assert.Equal(t, filepath.Join(home, ".local", "share", "ask-ollama"), DataDir())
+	assert.Equal(t, filepath.Join(home, ".local", "state", "ask-ollama"), StateDir())
+
+	t.Setenv("XDG_CONFIG_HOME", "/xdg/config")
+	t.Setenv("XDG_DATA_HOME", "/xdg/data")
+	assert.Equal(t, "/xdg/config/ask-ollama", Dir())
+	assert.Equal(t, "/xdg/data/ask-ollama", DataDir())
+
+	// Relative paths are ignored
+	t.Setenv("XDG_STATE_HOME", "state")
+	assert.Equal(t, filepath.Join(home, ".local", "state", "ask-ollama"), StateDir())
+
+	t.Setenv("XDG_CONFIG_DIRS", "/first:/second:relative")
+	assert.Equal(t, []string{"/second/ask-ollama/config.yml", "/first/ask-ollama/config.yml"}, SystemFiles())
+}
+
+func TestProjectFileFrom(t *testing.T) {
+	root := t.TempDir()
+	deep := filepath.Join(root, "a", "b", "c")
+	if err := os.MkdirAll(deep, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "", ProjectFileFrom(deep))
+
+	writeFile(t, filepath.Join(root, ProjectFile), "model: x\n")
+	assert.Equal(t, filepath.Join(root, ProjectFile), ProjectFileFrom(deep))
+
+	// The nearest one wins
+	writeFile(t, filepath.Join(root, "a", ProjectFile), "model: y\n")
+	assert.Equal(t, filepath.Join(root, "a", ProjectFile), ProjectFileFrom(deep))
+}
+
+func TestLoadLayers(t *testing.T) {
+	home := isolate(t)
+
+	// With no config at all, everything goes in the XDG directories
+	conf, err := Load("")
+	assert.Nil(t, err)
+	assert.Empty(t, conf.Files)
+	assert.Equal(t, filepath.Join(home, ".local", "share", "ask-ollama", "ask-ollama.db"), conf.Database.Path)
+	assert.Equal(t, filepath.Join(home, ".local", "state", "ask-ollama", "ask-ollama.chat.yml"), conf.Logging.LogFile)
+
+	system := filepath.Join(home, "etc", "ask-ollama", "config.yml")
+	writeFile(t, system, `
+model: llama
+general:
+  base_url: "http://ollama.internal:11434"
+models:
+  llama:
+    name: "llama3.1"
+    temperature: 0.7
+`)
+	user := filepath.Join(home, ".config", "ask-ollama", "config.yml")
+	writeFile(t, user, `
+models:
+  llama:
+    temperature: 0.2
+  qwen:
+    name: "qwen2.5:7b"
+`)
+	project := filepath.Join(home, "src", "proj", ProjectFile)
+	writeFile(t, project, `
+model: qwen
+`)
+	chdir(t, filepath.Join(home, "src", "proj"))
+
+	conf, err = Load("")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{system, user, project}, conf.Files)
+	assert.Equal(t, "qwen", conf.Opts.Model)
+	assert.Equal(t, "http://ollama.internal:11434", conf.General.BaseURL)
+	assert.Equal(t, "llama3.1", conf.Models["llama"].Name)
+	assert.Equal(t, 0.2, conf.Models["llama"].Temperature)
+	assert.Equal(t, "qwen2.5:7b", conf.Models["qwen"].Name)
+
+	// --config is read on its own
+	conf, err = Load(user)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{user}, conf.Files)
+	// With two models and no model key, there's no default
+	assert.Equal(t, "", conf.Opts.Model)
+
+	_, err = Load(filepath.Join(home, "missing.yml"))
+	assert.NotNil(t, err)
+}
+
+func TestLegacyPaths(t *testing.T) {
+	home := isolate(t)
+
+	// A database already in the config directory stays there
+	legacy := filepath.Join(home, ".config", "ask-ollama", "ask-ollama.db")
+	writeFile(t, legacy, "")
+
+	conf, err := Load("")
+	assert.Nil(t, err)
+	assert.Equal(t, legacy, conf.Database.Path)
+	assert.Equal(t, filepath.Join(home, ".local", "state", "ask-ollama", "ask-ollama.chat.yml"), conf.Logging.LogFile)
+}
+
+func TestEnvVar(t *testing.T) {
+	assert.Equal(t, "ASKOLLAMA_MODEL", EnvVar("model"))
+	assert.Equal(t, "ASKOLLAMA_GENERAL_BASE_URL", EnvVar("general.base_url"))
+	assert.Equal(t, "ASKOLLAMA_MODELS_LLAMA_3_TEMPERATURE", EnvVar("models.llama-3.temperature"))
+}
+
+func TestEnvOverrides(t *testing.T) {
+	home := isolate(t)
+
+	writeFile(t, filepath.Join(home, ".config", "ask-ollama", "config.yml"), `
+model: llama
+general:
+  base_url: "localhost:11434"
+models:
+  llama-3:
+    name: "llama3.1"
+    temperature: 0.7
+`)
+	project := filepath.Join(home, ProjectFile)
+	writeFile(t, project, `
+model: llama-3
+`)
+
+	// OLLAMA_HOST is used, but the variable of our own wins
+	t.Setenv("OLLAMA_HOST", "gpu-box:11434")
+	t.Setenv("ASKOLLAMA_MODEL", "qwen")
+	t.Setenv("ASKOLLAMA_MODELS_LLAMA_3_TEMPERATURE", "0.3")
+	t.Setenv("ASKOLLAMA_MODELS_LLAMA_3_MAX_TOKENS", "2048")
+	t.Setenv("ASKOLLAMA_GENERAL_STREAM", "true")
+	t.Setenv("ASKOLLAMA_DISPLAY_MAX_WIDTH", "100")
+
+	conf, err := Load("")
+	assert.Nil(t, err)
+	assert.Equal(t, "gpu-box:11434", conf.General.BaseURL)
+	assert.Equal(t, "qwen", conf.Opts.Model)
+	assert.Equal(t, Model{Name: "llama3.1", Temperature: 0.3, MaxTokens: 2048}, conf.Models["llama-3"])
+	assert.True(t, conf.Opts.Stream)
+	assert.Equal(t, 100, conf.Opts.MaxWidth)
+
+	t.Setenv("ASKOLLAMA_GENERAL_BASE_URL", "http://localhost:8080")
+	t.Setenv("ASKOLLAMA_MODELS_LLAMA_3_TEMPERATURE", "9")
+	conf, err = Load("")
+	assert.Nil(t, err)
+	assert.Equal(t, "http://localhost:8080", conf.General.BaseURL)
+
+	// Problems with a value from the environment point there, not at the
+	// file it overrides
+	assert.Equal(t, []string{
+		`$ASKOLLAMA_MODEL: warning: model: the default model "qwen" isn't in models, so it has to be a model Ollama has`,
+		"$ASKOLLAMA_MODELS_LLAMA_3_TEMPERATURE: models.llama-3.temperature: 9 is out of range (0 to 2)",
+	}, problemStrings(conf.Validate()))
+}
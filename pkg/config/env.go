@@ -0,0 +1,83 @@
+package config
+
+// Environment variables override config keys: ASKOLLAMA_ then the key in
+// capitals, with dots (and dashes, which can't be in a variable's name) as
+// underscores. So ASKOLLAMA_GENERAL_BASE_URL is general.base_url, and
+// ASKOLLAMA_MODELS_LLAMA_3_TEMPERATURE is models.llama-3.temperature. An
+// entry in models or roles has to be in a config file for the variables to
+// change it; they can't add one.
+//
+// OLLAMA_HOST, which the ollama command uses, sets general.base_url too, but
+// ASKOLLAMA_GENERAL_BASE_URL wins if both are set.
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const EnvPrefix = "ASKOLLAMA"
+
+var envReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// EnvVar is the environment variable for a config key
+func EnvVar(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(envReplacer.Replace(key))
+}
+
+// envVars are the variables that can set key, the most important first
+func envVars(key string) []string {
+	vars := []string{EnvVar(key)}
+	if key == "general.base_url" {
+		vars = append(vars, "OLLAMA_HOST")
+	}
+	return vars
+}
+
+// bindEnv has viper look at the environment for every key there is, once
+// the config files have been read (they decide which models and roles
+// there are). It returns the keys that are set from the environment, and
+// by which variable.
+func bindEnv(v *viper.Viper) map[string]string {
+	set := map[string]string{}
+	for _, key := range configKeyPaths(v, reflect.TypeOf(Config{}), "") {
+		vars := envVars(key)
+		v.BindEnv(append([]string{key}, vars...)...)
+		for _, name := range vars {
+			// Viper ignores empty variables, so they don't count here
+			// either
+			if os.Getenv(name) != "" {
+				set[key] = name
+				break
+			}
+		}
+	}
+	return set
+}
+
+// configKeyPaths lists the dotted keys under prefix for a t, with the
+// entries of maps being the ones v has
+func configKeyPaths(v *viper.Viper, t reflect.Type, prefix string) []string {
+	switch t.Kind() {
+	case reflect.Struct:
+		var keys []string
+		for name, field := range configKeys(t) {
+			keys = append(keys, configKeyPaths(v, field.Type, join(prefix, name))...)
+		}
+		sort.Strings(keys)
+		return keys
+
+	case reflect.Map:
+		var keys []string
+		for name := range v.GetStringMap(prefix) {
+			keys = append(keys, configKeyPaths(v, t.Elem(), join(prefix, name))...)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+
+	return []string{prefix}
+}
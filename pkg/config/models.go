@@ -0,0 +1,116 @@
+package config
+
+import (
+	"sort"
+	"strings"
+)
+
+// FindModel looks name up in the models, as a key, one of a model's aliases
+// or its Ollama tag (with or without ":latest"), in that order. It returns
+// the key with the model.
+func (c *Config) FindModel(name string) (string, Model, bool) {
+	if m, ok := c.Models[name]; ok {
+		return name, m, true
+	}
+
+	// Map order is random, so go through them in order in case two models
+	// have the same tag
+	keys := c.modelKeys()
+	for _, key := range keys {
+		for _, alias := range c.Models[key].Aliases {
+			if alias == name {
+				return key, c.Models[key], true
+			}
+		}
+	}
+	for _, key := range keys {
+		if sameTag(c.Models[key].Name, name) {
+			return key, c.Models[key], true
+		}
+	}
+
+	return "", Model{}, false
+}
+
+// sameTag reports whether a and b are the same Ollama model, where no tag
+// means ":latest"
+func sameTag(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	if !strings.Contains(a, ":") {
+		a += ":latest"
+	}
+	if !strings.Contains(b, ":") {
+		b += ":latest"
+	}
+	return a == b
+}
+
+func (c *Config) modelKeys() []string {
+	keys := make([]string, 0, len(c.Models))
+	for key := range c.Models {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ModelNames are all the names FindModel knows: keys, aliases and tags
+func (c *Config) ModelNames() []string {
+	var names []string
+	for _, key := range c.modelKeys() {
+		m := c.Models[key]
+		names = append(names, key)
+		names = append(names, m.Aliases...)
+		if m.Name != "" {
+			names = append(names, m.Name)
+		}
+	}
+	return names
+}
+
+// DefaultModel is the model to use when --model isn't given: the model key
+// if it's set, or the only model if there's just one
+func (c *Config) DefaultModel() string {
+	if c.Model != "" {
+		return c.Model
+	}
+	if len(c.Models) == 1 {
+		return c.modelKeys()[0]
+	}
+	return ""
+}
+
+// Suggest returns the option most like name, for "did you mean" messages,
+// or "" if none of them is close
+func Suggest(name string, options []string) string {
+	name = strings.ToLower(name)
+
+	// One that starts with name (qwen2.5-coder:14b for qwen) is the best
+	// match, the shortest if there are several
+	best := ""
+	for _, option := range options {
+		if len(name) > 1 && strings.HasPrefix(strings.ToLower(option), name) && (best == "" || len(option) < len(best)) {
+			best = option
+		}
+	}
+	if best != "" {
+		return best
+	}
+
+	// Otherwise the closest, if it's close enough to be a typo. The tag
+	// (":14b") is often left off, so it's left off the options too.
+	bestDist := max(2, len(name)/3) + 1
+	for _, option := range options {
+		lower := strings.ToLower(option)
+		d := editDistance(name, lower)
+		if base, _, ok := strings.Cut(lower, ":"); ok && !strings.Contains(name, ":") {
+			d = min(d, editDistance(name, base))
+		}
+		if d < bestDist {
+			best, bestDist = option, d
+		}
+	}
+	return best
+}
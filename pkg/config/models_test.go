@@ -0,0 +1,73 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindModel(t *testing.T) {
+	conf := &Config{Models: map[string]Model{
+		"llama":    {Name: "llama3.1", Aliases: []string{"ll", "meta"}},
+		"coder":    {Name: "qwen2.5-coder:14b", Aliases: []string{"qc"}},
+		"deepseek": {Name: "deepseek-r1:latest"},
+	}}
+
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"llama", "llama"},
+		{"meta", "llama"},
+		{"qc", "coder"},
+		{"qwen2.5-coder:14b", "coder"},
+		// No tag means :latest, either way round
+		{"llama3.1:latest", "llama"},
+		{"deepseek-r1", "deepseek"},
+		{"qwen2.5-coder", ""},
+		{"mistral", ""},
+	}
+	for _, tt := range tests {
+		key, m, ok := conf.FindModel(tt.name)
+		assert.Equal(t, tt.key, key, tt.name)
+		assert.Equal(t, tt.key != "", ok, tt.name)
+		if ok {
+			assert.Equal(t, conf.Models[tt.key], m, tt.name)
+		}
+	}
+
+	assert.Equal(t, []string{"coder", "qc", "qwen2.5-coder:14b", "deepseek", "deepseek-r1:latest", "llama", "ll", "meta", "llama3.1"}, conf.ModelNames())
+}
+
+func TestDefaultModel(t *testing.T) {
+	conf := &Config{Models: map[string]Model{"llama": {Name: "llama3.1"}}}
+	assert.Equal(t, "llama", conf.DefaultModel())
+
+	conf.Models["qwen"] = Model{Name: "qwen2.5"}
+	assert.Equal(t, "", conf.DefaultModel())
+
+	conf.Model = "qwen"
+	assert.Equal(t, "qwen", conf.DefaultModel())
+}
+
+func TestSuggest(t *testing.T) {
+	options := []string{"llama", "llama3.1", "qwen2.5-coder:14b", "qwen2.5:7b", "deepseek-r1:14b"}
+	tests := map[string]string{
+		"lama":        "llama",
+		"qwen":        "qwen2.5:7b",
+		"qwen2.5-cod": "qwen2.5-coder:14b",
+		"deepsek-r1":  "deepseek-r1:14b",
+		"DeepSeek":    "deepseek-r1:14b",
+		"mistral":     "",
+		"q":           "",
+		"gpt-4":       "",
+		"tempreature": "",
+		"llama3.1:8b": "llama3.1",
+		"llama-3.1":   "llama3.1",
+		"deepseek-r2": "deepseek-r1:14b",
+		"":            "",
+	}
+	for name, expected := range tests {
+		assert.Equal(t, expected, Suggest(name, options), "Suggest(%q)", name)
+	}
+}
@@ -0,0 +1,131 @@
+package config
+
+// Where things live, following the XDG base directory spec: config.yml in
+// $XDG_CONFIG_HOME, the database in $XDG_DATA_HOME and the chat log in
+// $XDG_STATE_HOME, each with the spec's default under $HOME when unset.
+//
+// The config is read in layers, each overriding the ones before it:
+//
+//	/etc/xdg/ask-ollama/config.yml     (or each of $XDG_CONFIG_DIRS)
+//	~/.config/ask-ollama/config.yml    (or $XDG_CONFIG_HOME)
+//	.ask-ollama.yml                    (the nearest, from the current directory up)
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+const appName = "ask-ollama"
+
+// ProjectFile is the per-project config, looked for in the current directory
+// and the ones above it
+const ProjectFile = ".ask-ollama.yml"
+
+// Dir is where the user's config.yml lives
+func Dir() string {
+	return xdgDir("XDG_CONFIG_HOME", ".config")
+}
+
+// DataDir is where the database goes by default
+func DataDir() string {
+	return xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share"))
+}
+
+// TokenizerDir is where tokenizers are looked for, as <family>.json, for
+// models without a tokenizer of their own in the config
+func TokenizerDir() string {
+	return filepath.Join(DataDir(), "tokenizers")
+}
+
+// StateDir is where the chat log goes by default
+func StateDir() string {
+	return xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state"))
+}
+
+// xdgDir is ask-ollama under the directory in env, or under fallback in the
+// home directory. The spec says relative paths in the variables are invalid
+// and should be ignored.
+func xdgDir(env, fallback string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return filepath.Join(dir, appName)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		// Nowhere better to put things
+		return filepath.Join(fallback, appName)
+	}
+	return filepath.Join(home, fallback, appName)
+}
+
+// SystemFiles are the system-wide config files that could be read, lowest
+// precedence first. $XDG_CONFIG_DIRS lists the most important first, so it's
+// reversed.
+func SystemFiles() []string {
+	dirs := filepath.SplitList(os.Getenv("XDG_CONFIG_DIRS"))
+	if len(dirs) == 0 {
+		dirs = []string{"/etc/xdg"}
+	}
+
+	var files []string
+	for _, dir := range slices.Backward(dirs) {
+		if filepath.IsAbs(dir) {
+			files = append(files, filepath.Join(dir, appName, "config.yml"))
+		}
+	}
+	return files
+}
+
+// UserFile is the user's config file
+func UserFile() string {
+	return filepath.Join(Dir(), "config.yml")
+}
+
+// ProjectFileFrom returns the nearest ProjectFile in dir or above it, or ""
+// if there isn't one
+func ProjectFileFrom(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, ProjectFile)
+		if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Files are the config files that exist, in the order they're merged
+func Files() []string {
+	candidates := append(SystemFiles(), UserFile())
+	if cwd, err := os.Getwd(); err == nil {
+		if project := ProjectFileFrom(cwd); project != "" {
+			candidates = append(candidates, project)
+		}
+	}
+
+	var files []string
+	for _, path := range candidates {
+		if fi, err := os.Stat(path); err == nil && !fi.IsDir() && !slices.Contains(files, path) {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// defaultPath is where a file goes by default: in dir, unless there's already
+// one where older versions put everything (the config directory), in which
+// case it's left there rather than starting afresh
+func defaultPath(dir, name string) string {
+	legacy := filepath.Join(Dir(), name)
+	if _, err := os.Stat(legacy); err == nil {
+		return legacy
+	}
+	return filepath.Join(dir, name)
+}
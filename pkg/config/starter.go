@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// DefaultBaseURL is where Ollama listens unless it's been told otherwise
+const DefaultBaseURL = "localhost:11434"
+
+// Starter is a new config.yml, as written by `config init`
+type Starter struct {
+	BaseURL string
+	// The key of the default model
+	Model  string
+	Models []StarterModel
+	// Where the database and chat log go
+	DatabasePath string
+	LogFile      string
+}
+
+type StarterModel struct {
+	Key       string
+	Name      string
+	MaxTokens int
+	// What Ollama says about the model, for a comment
+	About string
+}
+
+// ModelKey turns a model tag into a key for the models section. Viper splits
+// keys on dots, so `qwen2.5:7b` can't be used as it is.
+func ModelKey(tag string) string {
+	tag = strings.TrimSuffix(strings.ToLower(tag), ":latest")
+	return strings.NewReplacer(".", "-", ":", "-", "/", "-").Replace(tag)
+}
+
+// Write writes the config out as YAML, with comments
+func (s *Starter) Write(w io.Writer) error {
+	return starterTemplate.Execute(w, s)
+}
+
+var starterTemplate = template.Must(template.New("config").Funcs(template.FuncMap{
+	"quote": func(s string) string { return fmt.Sprintf("%q", s) },
+}).Parse(`# ask-ollama config, written by ` + "`ask-ollama config init`" + `.
+# Check it after editing with ` + "`ask-ollama config check`" + `.
+
+{{ if .Model -}}
+# The model used when --model isn't given (one of the keys under models)
+model: {{ quote .Model }}
+
+{{ end -}}
+general:
+  base_url: {{ quote .BaseURL }}
+  max_attachment_size: 1048576  # 1MB, per file (and for piped stdin)
+  max_image_size: 10485760  # 10MB, per image (--image)
+  stream: false  # show answers as they're generated (same as --stream)
+  format_retries: 2  # times to ask again when --format/--schema JSON is wrong
+
+# ` + "`name`" + ` is the model tag as Ollama knows it (see ` + "`ollama list`" + `)
+models:
+{{- range .Models }}
+  {{ .Key }}:{{ if .About }}  # {{ .About }}{{ end }}
+    name: {{ quote .Name }}
+    max_tokens: {{ .MaxTokens }}
+    temperature: 0.7
+{{- else }}
+  # None were installed; add them here once they are
+{{- end }}
+
+logging:
+  log_file: {{ quote .LogFile }}
+
+database:
+  type: "sqlite3"
+  path: {{ quote .DatabasePath }}
+  table_name: "conversations"
+
+display:
+  theme: "default"
+  pager: ""
+  no_pager: false
+  max_width: 0
+
+roles:
+  default:
+    description: "A helpful AI assistant"
+    prompt: "You are a helpful AI assistant who provides clear and accurate information."
+
+  developer:
+    description: "Software development expert"
+    prompt: "You are an expert software developer with deep knowledge of programming languages, design patterns, and best practices."
+
+  analyst:
+    description: "Data analysis specialist"
+    prompt: "You are a data analyst who excels at interpreting data and explaining complex patterns in simple terms."
+
+  teacher:
+    description: "Educational assistant"
+    prompt: "You are a patient teacher who explains concepts clearly and builds upon fundamental understanding."
+`))
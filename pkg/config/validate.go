@@ -0,0 +1,523 @@
+package config
+
+// Checking the config. Viper (well, mapstructure) ignores keys it doesn't
+// know and only complains about bad values, without saying where they are,
+// so the files are read again here as YAML nodes, which know their lines.
+// Each file is checked against the Config struct for keys and types, then
+// the merged values are checked, with the line of whichever file set them.
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/duluk/ask-ollama/pkg/LLM"
+	"github.com/duluk/ask-ollama/pkg/render"
+	"github.com/duluk/ask-ollama/pkg/tools"
+)
+
+// Problem is something wrong with the config
+type Problem struct {
+	// Where it is, if it's in a file (Line is 0 if it's the whole file),
+	// or the environment variable it's from
+	File string
+	Line int
+	Env  string
+	// The dotted key, eg "models.llama.temperature"
+	Key     string
+	Message string
+	// Warnings are for things that work, but probably not how they were
+	// meant to (like a misspelled key, which is ignored)
+	Warning bool
+}
+
+func (p Problem) String() string {
+	var b strings.Builder
+	if p.Env != "" {
+		b.WriteString("$" + p.Env + ": ")
+	} else if p.File != "" {
+		b.WriteString(p.File)
+		if p.Line > 0 {
+			fmt.Fprintf(&b, ":%d", p.Line)
+		}
+		b.WriteString(": ")
+	}
+	if p.Warning {
+		b.WriteString("warning: ")
+	}
+	if p.Key != "" {
+		b.WriteString(p.Key + ": ")
+	}
+	b.WriteString(p.Message)
+	return b.String()
+}
+
+// HasErrors reports whether any of problems isn't just a warning
+func HasErrors(problems []Problem) bool {
+	for _, p := range problems {
+		if !p.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+type position struct {
+	file string
+	line int
+	env  string
+}
+
+// validator collects the problems, and where each key was last set
+type validator struct {
+	problems  []Problem
+	positions map[string]position
+}
+
+// Validate checks the config files that were loaded and the config they
+// add up to, returning the problems in the order of the files
+func (c *Config) Validate() []Problem {
+	v := &validator{positions: map[string]position{}}
+	for _, file := range c.Files {
+		v.checkFile(file)
+	}
+	for key, name := range c.env {
+		v.positions[key] = position{env: name}
+	}
+	v.checkValues(c)
+
+	// The merged checks run over maps, so put everything in file order, then
+	// the ones from the environment, then the rest
+	order := func(p Problem) int {
+		switch {
+		case p.Env != "":
+			return len(c.Files)
+		case p.File == "":
+			return len(c.Files) + 1
+		}
+		return slices.Index(c.Files, p.File)
+	}
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		a, b := v.problems[i], v.problems[j]
+		if order(a) != order(b) {
+			return order(a) < order(b)
+		}
+		if a.Env != b.Env {
+			return a.Env < b.Env
+		}
+		return a.Line < b.Line
+	})
+
+	return v.problems
+}
+
+// CheckFiles checks just the files, for when they can't be loaded at all
+// (Load's errors don't say where the problem is)
+func CheckFiles(files []string) []Problem {
+	v := &validator{positions: map[string]position{}}
+	for _, file := range files {
+		v.checkFile(file)
+	}
+	return v.problems
+}
+
+func (v *validator) add(key, format string, args ...any) {
+	pos := v.positions[key]
+	v.problems = append(v.problems, Problem{File: pos.file, Line: pos.line, Env: pos.env, Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) warn(key, format string, args ...any) {
+	v.add(key, format, args...)
+	v.problems[len(v.problems)-1].Warning = true
+}
+
+// yaml.v3's errors start "yaml: line N: "
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+func (v *validator) checkFile(file string) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		v.problems = append(v.problems, Problem{File: file, Message: err.Error()})
+		return
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		p := Problem{File: file, Message: err.Error()}
+		if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+			p.Line, _ = strconv.Atoi(m[1])
+			p.Message = m[2]
+		}
+		v.problems = append(v.problems, p)
+		return
+	}
+	if len(doc.Content) == 0 {
+		// An empty file
+		return
+	}
+
+	v.checkNode(file, doc.Content[0], reflect.TypeOf(Config{}), "")
+}
+
+// checkNode checks that node is the right shape for a t, and records the
+// positions of the keys in it
+func (v *validator) checkNode(file string, node *yaml.Node, t reflect.Type, key string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Tag == "!!null" {
+		return
+	}
+	bad := func(want string) {
+		v.problems = append(v.problems, Problem{File: file, Line: node.Line, Key: key,
+			Message: fmt.Sprintf("expected %s, not %q", want, nodeValue(node))})
+	}
+
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			bad("a mapping")
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, value := node.Content[i], node.Content[i+1]
+			// Viper doesn't care about case
+			name := strings.ToLower(k.Value)
+			if name == "<<" {
+				v.checkNode(file, value, t, key)
+				continue
+			}
+			child := join(key, name)
+			v.positions[child] = position{file: file, line: k.Line}
+
+			if t.Kind() == reflect.Map {
+				v.checkNode(file, value, t.Elem(), child)
+				continue
+			}
+			field, ok := fieldByKey(t, name)
+			if !ok {
+				v.problems = append(v.problems, Problem{File: file, Line: k.Line, Key: child, Warning: true,
+					Message: "unknown key" + suggestKey(t, name)})
+				continue
+			}
+			v.checkNode(file, value, field.Type, child)
+		}
+
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			bad("a list")
+			return
+		}
+		for i, item := range node.Content {
+			v.checkNode(file, item, t.Elem(), fmt.Sprintf("%s[%d]", key, i))
+		}
+
+	case reflect.String:
+		if node.Kind != yaml.ScalarNode {
+			bad("a string")
+		}
+
+	case reflect.Int, reflect.Int64:
+		if _, err := strconv.ParseInt(node.Value, 0, 64); node.Kind != yaml.ScalarNode || err != nil {
+			bad("a whole number")
+		}
+
+	case reflect.Float64:
+		if _, err := strconv.ParseFloat(node.Value, 64); node.Kind != yaml.ScalarNode || err != nil {
+			bad("a number")
+		}
+
+	case reflect.Bool:
+		if _, err := strconv.ParseBool(node.Value); node.Kind != yaml.ScalarNode || err != nil {
+			bad("true or false")
+		}
+	}
+}
+
+func nodeValue(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	}
+	return node.Value
+}
+
+func join(key, name string) string {
+	if key == "" {
+		return name
+	}
+	return key + "." + name
+}
+
+// configKeys are the keys a struct in the config has, from the mapstructure
+// tags, leaving out the fields that aren't read from the file
+func configKeys(t reflect.Type) map[string]reflect.StructField {
+	keys := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		keys[tag] = field
+	}
+	return keys
+}
+
+func fieldByKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	field, ok := configKeys(t)[key]
+	return field, ok
+}
+
+// suggestKey names the key in t that name is most likely a misspelling of
+func suggestKey(t reflect.Type, name string) string {
+	var keys []string
+	for key := range configKeys(t) {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return suggest(name, keys)
+}
+
+// suggest is " (did you mean ...?)" with the candidate most like name, to
+// go on the end of a message, or nothing if none of them is much like it
+func suggest(name string, candidates []string) string {
+	if best := Suggest(name, candidates); best != "" {
+		return fmt.Sprintf(" (did you mean %q?)", best)
+	}
+	return ""
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func (v *validator) set(key string) bool {
+	_, ok := v.positions[key]
+	return ok
+}
+
+// checkValues checks the merged config's values and that the things it
+// refers to exist
+func (v *validator) checkValues(c *Config) {
+	if err := checkBaseURL(c.General.BaseURL); err != nil {
+		v.add("general.base_url", "%v", err)
+	}
+	if c.General.MaxAttachmentSize <= 0 {
+		v.add("general.max_attachment_size", "must be more than 0")
+	}
+	if c.General.MaxImageSize <= 0 {
+		v.add("general.max_image_size", "must be more than 0")
+	}
+	if c.General.FormatRetries < 0 {
+		v.add("general.format_retries", "can't be less than 0")
+	}
+
+	names := make([]string, 0, len(c.Models))
+	for name := range c.Models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m := c.Models[name]
+		key := "models." + name
+		if m.Name == "" {
+			v.add(key, "no name (the model's tag in Ollama, eg llama3.1:8b)")
+		}
+		if m.MaxTokens < 0 || (m.MaxTokens == 0 && v.set(key+".max_tokens")) {
+			v.add(key+".max_tokens", "must be more than 0")
+		}
+		checkRange(v, key+".temperature", m.Temperature, 0, 2)
+		checkRange(v, key+".top_p", m.TopP, 0, 1)
+		checkRange(v, key+".presence_penalty", m.PresencePenalty, -2, 2)
+		checkRange(v, key+".frequency_penalty", m.FrequencyPenalty, -2, 2)
+		if m.Timeout < 0 {
+			v.add(key+".timeout", "can't be negative")
+		}
+		if m.ContextLength < 0 {
+			v.add(key+".context_length", "can't be negative")
+		}
+		if m.Tokenizer != "" {
+			if _, err := os.Stat(m.Tokenizer); os.IsNotExist(err) {
+				v.add(key+".tokenizer", "%s doesn't exist", m.Tokenizer)
+			} else if err != nil {
+				v.add(key+".tokenizer", "%v", err)
+			}
+		}
+	}
+
+	// Aliases can't be another model's name
+	owner := map[string]string{}
+	for _, name := range names {
+		owner[name] = name
+	}
+	for _, name := range names {
+		for _, alias := range c.Models[name].Aliases {
+			if other, ok := owner[alias]; ok && other != name {
+				v.add("models."+name+".aliases", "%q is already models.%s or one of its aliases", alias, other)
+				continue
+			}
+			owner[alias] = name
+		}
+	}
+
+	switch _, _, ok := c.FindModel(c.Model); {
+	case c.Model == "" && len(c.Models) > 1:
+		v.warn("model", "not set, so --model has to be given every time")
+	case c.Model != "" && !ok && len(c.Models) > 0:
+		msg := fmt.Sprintf("the default model %q isn't in models, so it has to be a model Ollama has", c.Model)
+		msg += suggest(c.Model, c.ModelNames())
+		v.warn("model", "%s", msg)
+	}
+	if c.Opts.Role != "" {
+		if _, ok := c.Roles[c.Opts.Role]; !ok {
+			v.add("", "unknown role: %s", c.Opts.Role)
+		}
+	}
+	for name, role := range c.Roles {
+		if strings.TrimSpace(role.Prompt) == "" {
+			v.warn("roles."+name+".prompt", "empty prompt")
+		}
+	}
+
+	if _, err := render.LoadTheme(c.Display.Theme, c.Display.ThemeColors); err != nil {
+		key := "display.theme"
+		if strings.Contains(err.Error(), "color") {
+			key = "display.theme_colors"
+		}
+		v.add(key, "%v", err)
+	}
+	if _, err := LLM.ParseStrategy(c.Context.Strategy); err != nil {
+		v.add("context.strategy", "%v", err)
+	}
+	if c.Context.KeepFirst < 0 {
+		v.add("context.keep_first", "can't be negative")
+	}
+	if c.Context.KeepLast < 0 {
+		v.add("context.keep_last", "can't be negative")
+	}
+	if c.Context.DefaultLength <= 0 {
+		v.add("context.default_length", "must be more than 0")
+	}
+	if name := c.Context.SummaryModel; name != "" && len(c.Models) > 0 {
+		if _, _, ok := c.FindModel(name); !ok {
+			msg := fmt.Sprintf("%q isn't in models, so it has to be a model Ollama has", name)
+			msg += suggest(name, c.ModelNames())
+			v.warn("context.summary_model", "%s", msg)
+		}
+	}
+
+	for _, name := range c.Tools.Enabled {
+		if !slices.Contains(tools.Builtins, name) {
+			msg := fmt.Sprintf("there's no tool called %q", name)
+			msg += suggest(name, tools.Builtins)
+			v.add("tools.enabled", "%s", msg)
+		}
+	}
+	if c.Tools.MaxRounds <= 0 {
+		v.add("tools.max_rounds", "must be more than 0")
+	}
+	policyNames := make([]string, 0, len(c.Tools.Policy))
+	for name := range c.Tools.Policy {
+		policyNames = append(policyNames, name)
+	}
+	sort.Strings(policyNames)
+	for _, name := range policyNames {
+		key := "tools.policy." + name
+		if !slices.Contains(tools.Builtins, name) {
+			msg := fmt.Sprintf("there's no tool called %q", name)
+			msg += suggest(name, tools.Builtins)
+			v.add(key, "%s", msg)
+		}
+		if _, err := tools.ParsePolicy(c.Tools.Policy[name]); err != nil {
+			v.add(key, "%v", err)
+		}
+	}
+	// Relative paths depend on where it's run from, so only the others are
+	// checked
+	for _, path := range c.Tools.Paths {
+		if !filepath.IsAbs(path) {
+			continue
+		}
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			v.warn("tools.paths", "%s isn't a directory", path)
+		}
+	}
+	if c.Tools.Timeout <= 0 {
+		v.add("tools.timeout", "must be more than 0")
+	}
+	if c.Tools.MaxOutput <= 0 {
+		v.add("tools.max_output", "must be more than 0")
+	}
+
+	if w := c.Embeddings.KeywordWeight; w < 0 || w > 1 {
+		v.add("embeddings.keyword_weight", "must be from 0 to 1")
+	}
+
+	if c.RAG.TopK <= 0 {
+		v.add("rag.top_k", "must be more than 0")
+	}
+	if c.RAG.ChunkSize <= 0 {
+		v.add("rag.chunk_size", "must be more than 0")
+	}
+
+	if c.Display.MaxWidth < 0 {
+		v.add("display.max_width", "can't be negative (0 means no limit)")
+	}
+}
+
+func checkRange(v *validator, key string, value, lo, hi float64) {
+	if value < lo || value > hi {
+		v.add(key, "%g is out of range (%g to %g)", value, lo, hi)
+	}
+}
+
+// checkBaseURL checks that url is something the Ollama client can use: a URL
+// or, like OLLAMA_HOST, just host:port
+func checkBaseURL(baseURL string) error {
+	if baseURL == "" {
+		return fmt.Errorf("not set (eg localhost:11434)")
+	}
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("not a valid URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https, not %s", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("no host in %s", baseURL)
+	}
+	return nil
+}
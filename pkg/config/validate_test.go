@@ -0,0 +1,234 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/duluk/ask-ollama/pkg/tools"
+)
+
+func problemStrings(problems []Problem) []string {
+	var s []string
+	for _, p := range problems {
+		s = append(s, p.String())
+	}
+	return s
+}
+
+func TestValidate(t *testing.T) {
+	home := isolate(t)
+
+	user := filepath.Join(home, ".config", "ask-ollama", "config.yml")
+	writeFile(t, user, `model: llama
+general:
+  base_url: "ftp://localhost:11434"
+models:
+  llama:
+    name: "llama3.1"
+    max_tokens: 0
+    temperature: 2.5
+    top_p: 0.9
+  qwen:
+    tempreature: 0.2
+display:
+  max_width: "wide"
+`)
+	project := filepath.Join(home, ProjectFile)
+	writeFile(t, project, `models:
+  llama:
+    top_p: 1.5
+roles:
+  terse:
+    prompt: ""
+`)
+
+	// max_width can't be decoded, so Load fails; CheckFiles says where
+	_, err := Load("")
+	assert.NotNil(t, err)
+
+	problems := CheckFiles(Files())
+	assert.Equal(t, []string{
+		user + `:11: warning: models.qwen.tempreature: unknown key (did you mean "temperature"?)`,
+		user + `:13: display.max_width: expected a whole number, not "wide"`,
+	}, problemStrings(problems))
+	assert.True(t, HasErrors(problems))
+
+	writeFile(t, user, `model: llama
+general:
+  base_url: "ftp://localhost:11434"
+models:
+  llama:
+    name: "llama3.1"
+    max_tokens: 0
+    temperature: 2.5
+    top_p: 0.9
+  qwen:
+    tempreature: 0.2
+`)
+	conf, err := Load("")
+	assert.Nil(t, err)
+	conf.Opts.Role = "pirate"
+	assert.Equal(t, []string{
+		user + `:3: general.base_url: scheme must be http or https, not ftp`,
+		user + `:7: models.llama.max_tokens: must be more than 0`,
+		user + `:8: models.llama.temperature: 2.5 is out of range (0 to 2)`,
+		user + `:10: models.qwen: no name (the model's tag in Ollama, eg llama3.1:8b)`,
+		user + `:11: warning: models.qwen.tempreature: unknown key (did you mean "temperature"?)`,
+		project + `:3: models.llama.top_p: 1.5 is out of range (0 to 1)`,
+		project + `:6: warning: roles.terse.prompt: empty prompt`,
+		`unknown role: pirate`,
+	}, problemStrings(conf.Validate()))
+}
+
+func TestValidateDefaults(t *testing.T) {
+	example, err := filepath.Abs(filepath.Join("..", "..", "config.yml.example"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	isolate(t)
+
+	// No config at all is fine
+	conf, err := Load("")
+	assert.Nil(t, err)
+	assert.Empty(t, conf.Validate())
+
+	// As is the example
+	conf, err = Load(example)
+	assert.Nil(t, err)
+	assert.Empty(t, conf.Validate())
+}
+
+func TestCheckBaseURL(t *testing.T) {
+	for _, url := range []string{"localhost:11434", "http://localhost:11434", "https://ollama.example.com/", "[::1]:11434"} {
+		assert.Nil(t, checkBaseURL(url), url)
+	}
+	for _, url := range []string{"", "ftp://host", "http://", "http://host:port"} {
+		assert.NotNil(t, checkBaseURL(url), url)
+	}
+}
+
+func TestValidateModels(t *testing.T) {
+	home := isolate(t)
+
+	path := filepath.Join(home, "config.yml")
+	writeFile(t, path, `model: lama
+models:
+  llama:
+    name: "llama3.1"
+    aliases: ["ll"]
+    tokenizer: "$HOME/llama3.json"
+  qwen:
+    name: "qwen2.5"
+    aliases: ["q", "ll", "llama"]
+context:
+  summary_model: "qwen2"
+`)
+	conf, err := Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		path + `:1: warning: model: the default model "lama" isn't in models, so it has to be a model Ollama has (did you mean "llama"?)`,
+		path + `:6: models.llama.tokenizer: ` + filepath.Join(home, "llama3.json") + ` doesn't exist`,
+		path + `:9: models.qwen.aliases: "ll" is already models.llama or one of its aliases`,
+		path + `:9: models.qwen.aliases: "llama" is already models.llama or one of its aliases`,
+		path + `:11: warning: context.summary_model: "qwen2" isn't in models, so it has to be a model Ollama has (did you mean "qwen2.5"?)`,
+	}, problemStrings(conf.Validate()))
+
+	writeFile(t, path, `models:
+  llama:
+    name: "llama3.1"
+  qwen:
+    name: "qwen2.5"
+`)
+	conf, err = Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"warning: model: not set, so --model has to be given every time"}, problemStrings(conf.Validate()))
+}
+
+func TestValidateTools(t *testing.T) {
+	home := isolate(t)
+
+	path := filepath.Join(home, "config.yml")
+	writeFile(t, path, `tools:
+  enabled: ["read_file", "list_dir"]
+  max_rounds: 0
+  commands: ["git", "ls"]
+  policy:
+    run_command: allow
+    read_file: sometimes
+    run_commands: ask
+  paths: [".", "docs", "/nowhere/at/all"]
+  timeout: 0
+`)
+	conf, err := Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"git", "ls"}, conf.Tools.Commands)
+	assert.Equal(t, []string{
+		path + `:2: tools.enabled: there's no tool called "list_dir" (did you mean "list_directory"?)`,
+		path + `:3: tools.max_rounds: must be more than 0`,
+		path + `:7: tools.policy.read_file: unknown policy "sometimes" (expected allow, ask or deny)`,
+		path + `:8: tools.policy.run_commands: there's no tool called "run_commands" (did you mean "run_command"?)`,
+		path + `:9: warning: tools.paths: /nowhere/at/all isn't a directory`,
+		path + `:10: tools.timeout: must be more than 0`,
+	}, problemStrings(conf.Validate()))
+	assert.Equal(t, map[string]tools.Policy{"run_command": tools.Allow, "run_commands": tools.Ask}, conf.Tools.Policies())
+
+	// All of them by default
+	writeFile(t, path, "")
+	conf, err = Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"read_file", "list_directory", "run_command", "query_history"}, conf.Tools.Enabled)
+	assert.Equal(t, 8, conf.Tools.MaxRounds)
+	assert.Equal(t, []string{"."}, conf.Tools.Paths)
+	assert.Equal(t, 30, conf.Tools.Timeout)
+	assert.Empty(t, conf.Tools.Policies())
+}
+
+func TestValidateEmbeddings(t *testing.T) {
+	home := isolate(t)
+
+	path := filepath.Join(home, "config.yml")
+	writeFile(t, path, `embeddings:
+  model: nomic-embed-text
+  keyword_weight: 1.5
+`)
+	conf, err := Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "nomic-embed-text", conf.Embeddings.Model)
+	assert.Equal(t, []string{
+		path + `:3: embeddings.keyword_weight: must be from 0 to 1`,
+	}, problemStrings(conf.Validate()))
+
+	// No model, so nothing's embedded, by default
+	writeFile(t, path, "")
+	conf, err = Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "", conf.Embeddings.Model)
+	assert.Equal(t, 0.3, conf.Embeddings.KeywordWeight)
+}
+
+func TestValidateRAG(t *testing.T) {
+	home := isolate(t)
+
+	path := filepath.Join(home, "config.yml")
+	writeFile(t, path, `rag:
+  index: "$HOME/docs.db"
+  top_k: 0
+  chunk_size: -1
+`)
+	conf, err := Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(home, "docs.db"), conf.RAG.Index)
+	assert.Equal(t, []string{
+		path + `:3: rag.top_k: must be more than 0`,
+		path + `:4: rag.chunk_size: must be more than 0`,
+	}, problemStrings(conf.Validate()))
+
+	writeFile(t, path, "")
+	conf, err = Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(DataDir(), "ask-ollama.index.db"), conf.RAG.Index)
+	assert.Equal(t, 5, conf.RAG.TopK)
+	assert.Equal(t, 1500, conf.RAG.ChunkSize)
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AuditEntry is a record of a tool call, and whether it was allowed
+type AuditEntry struct {
+	ID        int
+	Timestamp string
+	ConvID    int
+	Name      string
+	Arguments map[string]any
+	// allowed, approved, denied, declined...
+	Decision  string
+	Result    string
+	Error     string
+	Duration  time.Duration
+	Directory string
+}
+
+// AuditToolCall records a tool call, which is done as it happens, so
+// there's a record even if the turn it was part of is never saved
+func (sqlDB *ChatDB) AuditToolCall(entry AuditEntry) error {
+	args, err := json.Marshal(entry.Arguments)
+	if err != nil {
+		return fmt.Errorf("error auditing tool call: %v", err)
+	}
+
+	_, err = sqlDB.db.Exec(`
+		INSERT INTO `+auditTable(sqlDB.dbTable)+` (conv_id, name, arguments, decision, result, error, duration_ms, directory)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+	`, entry.ConvID, entry.Name, string(args), entry.Decision, entry.Result, entry.Error, entry.Duration.Milliseconds(), entry.Directory)
+	if err != nil {
+		return fmt.Errorf("error auditing tool call: %v", err)
+	}
+	return nil
+}
+
+// ToolAudit returns the latest tool calls, newest first
+func (sqlDB *ChatDB) ToolAudit(limit int) ([]AuditEntry, error) {
+	rows, err := sqlDB.db.Query(`
+		SELECT id, timestamp, COALESCE(conv_id, 0), name, arguments, decision, result, error, COALESCE(duration_ms, 0), directory
+		FROM `+auditTable(sqlDB.dbTable)+`
+		ORDER BY id DESC
+		LIMIT ?;
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tool audit: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		var args, result, errText, directory sql.NullString
+		var ms int64
+		err := rows.Scan(&entry.ID, &entry.Timestamp, &entry.ConvID, &entry.Name, &args, &entry.Decision, &result, &errText, &ms, &directory)
+		if err != nil {
+			return nil, fmt.Errorf("error reading tool audit: %v", err)
+		}
+		if args.Valid && args.String != "null" {
+			if err := json.Unmarshal([]byte(args.String), &entry.Arguments); err != nil {
+				return nil, fmt.Errorf("error decoding tool call arguments: %v", err)
+			}
+		}
+		entry.Result = result.String
+		entry.Error = errText.String
+		entry.Duration = time.Duration(ms) * time.Millisecond
+		entry.Directory = directory.String
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
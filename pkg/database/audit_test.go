@@ -0,0 +1,74 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToolAudit(t *testing.T) {
+	db, err := NewDB(dbPath, dbTable)
+	assert.Nil(t, err)
+
+	entries, err := db.ToolAudit(10)
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+
+	assert.Nil(t, db.AuditToolCall(AuditEntry{
+		ConvID:    3,
+		Name:      "run_command",
+		Arguments: map[string]any{"command": "git status"},
+		Decision:  "approved",
+		Result:    "nothing to commit",
+		Duration:  25 * time.Millisecond,
+		Directory: "/home/me/project",
+	}))
+	assert.Nil(t, db.AuditToolCall(AuditEntry{
+		ConvID:   3,
+		Name:     "run_command",
+		Decision: "declined",
+		Error:    "the user said no to run_command",
+	}))
+
+	entries, err = db.ToolAudit(10)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "declined", entries[0].Decision)
+	assert.Equal(t, "the user said no to run_command", entries[0].Error)
+	assert.Nil(t, entries[0].Arguments)
+	assert.Equal(t, 3, entries[1].ConvID)
+	assert.Equal(t, map[string]any{"command": "git status"}, entries[1].Arguments)
+	assert.Equal(t, "nothing to commit", entries[1].Result)
+	assert.Equal(t, 25*time.Millisecond, entries[1].Duration)
+	assert.Equal(t, "/home/me/project", entries[1].Directory)
+	assert.NotEmpty(t, entries[1].Timestamp)
+
+	entries, err = db.ToolAudit(1)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+
+	db.Close()
+	RemoveDB()
+}
+
+func TestUpgradeAddsToolAudit(t *testing.T) {
+	// A database from before there was an audit
+	path := filepath.Join(t.TempDir(), "old.db")
+	old, err := sql.Open("sqlite3", path)
+	assert.Nil(t, err)
+	_, err = old.Exec(SchemaQueryV1(dbTable) + SchemaQueryV2(dbTable) + SchemaQueryV3(dbTable) +
+		SchemaQueryV4(dbTable) + SchemaQueryV5(dbTable) + SchemaQueryV6(dbTable))
+	assert.Nil(t, err)
+	old.Close()
+
+	db, err := InitializeDB(path, dbTable)
+	assert.Nil(t, err)
+	version, err := db.Version()
+	assert.Nil(t, err)
+	assert.Equal(t, SchemaVersion, version)
+	assert.Nil(t, db.AuditToolCall(AuditEntry{Name: "read_file", Decision: "allowed"}))
+	db.Close()
+}
@@ -5,7 +5,7 @@ import (
 	"strconv"
 )
 
-const SchemaVersion = 3
+const SchemaVersion = 10
 
 func DBSchema(dbTable string) string {
 	return `
@@ -18,11 +18,144 @@ func DBSchema(dbTable string) string {
 		temperature REAL NOT NULL,
 		input_tokens INTEGER,
 		output_tokens INTEGER,
-		conv_id INTEGER
+		conv_id INTEGER,
+		attachments TEXT
 	);
+	` + summarySchema(dbTable) + toolCallSchema(dbTable) + auditSchema(dbTable) + imageSchema(dbTable) + embeddingSchema(dbTable) + searchSchema(dbTable)
+}
+
+// The rolling summary of the start of each conversation, for the summarize
+// context strategy, so it's made once rather than every time the
+// conversation is continued
+func summarySchema(dbTable string) string {
+	return `
+	CREATE TABLE IF NOT EXISTS ` + summaryTable(dbTable) + ` (
+		conv_id INTEGER PRIMARY KEY,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+		summary TEXT NOT NULL,
+		turns INTEGER NOT NULL,
+		model_name TEXT NOT NULL
+	);
+	`
+}
+
+func summaryTable(dbTable string) string {
+	return dbTable + "_summaries"
+}
+
+// The tools a model called in each turn, with what they returned. turn_id
+// is the id of the turn in the main table, which is only there once the
+// turn's been saved, hence this being saved after it.
+func toolCallSchema(dbTable string) string {
+	return `
+	CREATE TABLE IF NOT EXISTS ` + toolCallTable(dbTable) + ` (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		turn_id INTEGER NOT NULL,
+		conv_id INTEGER,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+		name TEXT NOT NULL,
+		arguments TEXT,
+		result TEXT,
+		error TEXT
+	);
+	`
+}
+
+func toolCallTable(dbTable string) string {
+	return dbTable + "_tool_calls"
+}
+
+// Every call a model made to a tool, as it happened, including the ones
+// that weren't allowed and the ones from turns that never finished. The
+// directory is the working directory, which relative paths are from.
+func auditSchema(dbTable string) string {
+	return `
+	CREATE TABLE IF NOT EXISTS ` + auditTable(dbTable) + ` (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+		conv_id INTEGER,
+		name TEXT NOT NULL,
+		arguments TEXT,
+		decision TEXT NOT NULL,
+		result TEXT,
+		error TEXT,
+		duration_ms INTEGER,
+		directory TEXT
+	);
+	`
+}
+
+func auditTable(dbTable string) string {
+	return dbTable + "_tool_audit"
+}
+
+// The images sent with each prompt. Only where they were and their hash
+// are kept, not the images themselves, which would soon make the database
+// huge; turn_id is as for tool calls.
+func imageSchema(dbTable string) string {
+	return `
+	CREATE TABLE IF NOT EXISTS ` + imageTable(dbTable) + ` (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		turn_id INTEGER NOT NULL,
+		conv_id INTEGER,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+		path TEXT NOT NULL,
+		hash TEXT NOT NULL
+	);
+	`
+}
+
+func imageTable(dbTable string) string {
+	return dbTable + "_images"
+}
+
+// An embedding of each turn (prompt and response together), for finding
+// turns by what they were about. There can be one per embedding model, as
+// they can't be compared with each other's. The vector is little-endian
+// float32s.
+func embeddingSchema(dbTable string) string {
+	return `
+	CREATE TABLE IF NOT EXISTS ` + embeddingTable(dbTable) + ` (
+		turn_id INTEGER NOT NULL,
+		conv_id INTEGER,
+		model_name TEXT NOT NULL,
+		dimensions INTEGER NOT NULL,
+		vector BLOB NOT NULL,
+		PRIMARY KEY (turn_id, model_name)
+	);
+	`
+}
+
+func embeddingTable(dbTable string) string {
+	return dbTable + "_embeddings"
+}
+
+// A full-text index of the prompts and responses, for KeywordSearch. It
+// indexes the main table rather than keeping a copy of it, and the
+// triggers keep it up to date with it.
+func searchSchema(dbTable string) string {
+	fts := searchTable(dbTable)
+	return `
+	CREATE VIRTUAL TABLE IF NOT EXISTS ` + fts + ` USING fts4(content="` + dbTable + `", prompt, response, tokenize=unicode61);
+	CREATE TRIGGER IF NOT EXISTS ` + fts + `_insert AFTER INSERT ON ` + dbTable + ` BEGIN
+		INSERT INTO ` + fts + `(docid, prompt, response) VALUES (new.id, new.prompt, new.response);
+	END;
+	CREATE TRIGGER IF NOT EXISTS ` + fts + `_before_update BEFORE UPDATE ON ` + dbTable + ` BEGIN
+		DELETE FROM ` + fts + ` WHERE docid = old.id;
+	END;
+	CREATE TRIGGER IF NOT EXISTS ` + fts + `_after_update AFTER UPDATE ON ` + dbTable + ` BEGIN
+		INSERT INTO ` + fts + `(docid, prompt, response) VALUES (new.id, new.prompt, new.response);
+	END;
+	CREATE TRIGGER IF NOT EXISTS ` + fts + `_delete BEFORE DELETE ON ` + dbTable + ` BEGIN
+		DELETE FROM ` + fts + ` WHERE docid = old.id;
+	END;
 	`
 }
 
+func searchTable(dbTable string) string {
+	return dbTable + "_fts"
+}
+
 func SchemaQueryV1(dbTable string) string {
 	return `
 	CREATE TABLE IF NOT EXISTS ` + dbTable + ` (
@@ -55,6 +188,54 @@ func SchemaQueryV3(dbTable string) string {
 	`
 }
 
+// Attachments are stored as a JSON array of file names
+func SchemaQueryV4(dbTable string) string {
+	return `
+	ALTER TABLE ` + dbTable + ` ADD COLUMN attachments TEXT;
+
+	PRAGMA user_version = 4;
+	`
+}
+
+func SchemaQueryV5(dbTable string) string {
+	return summarySchema(dbTable) + `
+	PRAGMA user_version = 5;
+	`
+}
+
+func SchemaQueryV6(dbTable string) string {
+	return toolCallSchema(dbTable) + `
+	PRAGMA user_version = 6;
+	`
+}
+
+func SchemaQueryV7(dbTable string) string {
+	return auditSchema(dbTable) + `
+	PRAGMA user_version = 7;
+	`
+}
+
+func SchemaQueryV8(dbTable string) string {
+	return imageSchema(dbTable) + `
+	PRAGMA user_version = 8;
+	`
+}
+
+func SchemaQueryV9(dbTable string) string {
+	return embeddingSchema(dbTable) + `
+	PRAGMA user_version = 9;
+	`
+}
+
+// The turns from before there was an index are indexed as it's added
+func SchemaQueryV10(dbTable string) string {
+	return searchSchema(dbTable) + `
+	INSERT INTO ` + searchTable(dbTable) + `(` + searchTable(dbTable) + `) VALUES ('rebuild');
+
+	PRAGMA user_version = 10;
+	`
+}
+
 // There's got to be a better way to do this
 func getSchemaSQL(schemaVersion int, dbTable string) string {
 	switch schemaVersion {
@@ -64,6 +245,20 @@ func getSchemaSQL(schemaVersion int, dbTable string) string {
 		return SchemaQueryV2(dbTable)
 	case 3:
 		return SchemaQueryV3(dbTable)
+	case 4:
+		return SchemaQueryV4(dbTable)
+	case 5:
+		return SchemaQueryV5(dbTable)
+	case 6:
+		return SchemaQueryV6(dbTable)
+	case 7:
+		return SchemaQueryV7(dbTable)
+	case 8:
+		return SchemaQueryV8(dbTable)
+	case 9:
+		return SchemaQueryV9(dbTable)
+	case 10:
+		return SchemaQueryV10(dbTable)
 	default:
 		return ""
 	}
@@ -0,0 +1,313 @@
+package database
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// TurnsWithoutEmbeddings returns the turns that model hasn't embedded yet,
+// oldest first
+func (sqlDB *ChatDB) TurnsWithoutEmbeddings(model string, limit int) ([]Turn, error) {
+	rows, err := sqlDB.db.Query(`
+		SELECT c.id, COALESCE(c.conv_id, 0), c.timestamp, c.model_name, c.prompt, c.response
+		FROM `+sqlDB.dbTable+` c
+		LEFT JOIN `+embeddingTable(sqlDB.dbTable)+` e ON e.turn_id = c.id AND e.model_name = ?
+		WHERE e.turn_id IS NULL
+		ORDER BY c.id
+		LIMIT ?;
+	`, model, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error finding turns to embed: %v", err)
+	}
+	defer rows.Close()
+
+	var turns []Turn
+	for rows.Next() {
+		var turn Turn
+		if err := rows.Scan(&turn.ID, &turn.ConvID, &turn.Timestamp, &turn.Model, &turn.Prompt, &turn.Response); err != nil {
+			return nil, fmt.Errorf("error finding turns to embed: %v", err)
+		}
+		turns = append(turns, turn)
+	}
+	return turns, rows.Err()
+}
+
+// SaveEmbedding keeps model's embedding of a turn, replacing any it had
+func (sqlDB *ChatDB) SaveEmbedding(turn Turn, model string, vector []float32) error {
+	_, err := sqlDB.db.Exec(`
+		INSERT OR REPLACE INTO `+embeddingTable(sqlDB.dbTable)+` (turn_id, conv_id, model_name, dimensions, vector)
+		VALUES (?, ?, ?, ?, ?);
+	`, turn.ID, turn.ConvID, model, len(vector), EncodeVector(vector))
+	if err != nil {
+		return fmt.Errorf("error saving embedding: %v", err)
+	}
+	return nil
+}
+
+// SemanticQuery is what to look for with SemanticSearch
+type SemanticQuery struct {
+	// The embedding model, and its embedding of what's being looked for
+	Model  string
+	Vector []float32
+	// Words to look for as well, and how much finding them counts (0 to 1)
+	// against how close the meaning is
+	Keywords      string
+	KeywordWeight float64
+	// A conversation to leave out, if not 0
+	ExcludeConv int
+	Limit       int
+}
+
+// Match is a turn found by SemanticSearch, with how well it matched (the
+// higher the better, up to 1)
+type Match struct {
+	Turn
+	Score float64
+}
+
+// SemanticSearch returns the turns whose embeddings are closest to the
+// query's, best first. Every embedding is compared, which is quick enough
+// for one person's history.
+func (sqlDB *ChatDB) SemanticSearch(q SemanticQuery) ([]Match, error) {
+	rows, err := sqlDB.db.Query(`
+		SELECT c.id, COALESCE(c.conv_id, 0), c.timestamp, c.model_name, c.prompt, c.response, e.vector
+		FROM `+sqlDB.dbTable+` c
+		JOIN `+embeddingTable(sqlDB.dbTable)+` e ON e.turn_id = c.id
+		WHERE e.model_name = ? AND e.dimensions = ? AND COALESCE(c.conv_id, 0) != ?;
+	`, q.Model, len(q.Vector), q.ExcludeConv)
+	if err != nil {
+		return nil, fmt.Errorf("error searching embeddings: %v", err)
+	}
+	defer rows.Close()
+
+	words := searchTerms(q.Keywords)
+	var matches []Match
+	for rows.Next() {
+		var m Match
+		var blob []byte
+		if err := rows.Scan(&m.ID, &m.ConvID, &m.Timestamp, &m.Model, &m.Prompt, &m.Response, &blob); err != nil {
+			return nil, fmt.Errorf("error searching embeddings: %v", err)
+		}
+		m.Score = Cosine(q.Vector, DecodeVector(blob))
+		if q.KeywordWeight > 0 && len(words) > 0 {
+			m.Score = (1-q.KeywordWeight)*m.Score + q.KeywordWeight*keywordScore(words, m.Prompt+"\n"+m.Response)
+		}
+		matches = append(matches, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error searching embeddings: %v", err)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if q.Limit > 0 && len(matches) > q.Limit {
+		matches = matches[:q.Limit]
+	}
+	return matches, nil
+}
+
+// Words too common to say anything about what a prompt is about
+var stopWords = map[string]bool{
+	"a": true, "about": true, "an": true, "and": true, "any": true, "are": true,
+	"as": true, "at": true, "be": true, "but": true, "by": true, "can": true,
+	"could": true, "d": true, "did": true, "do": true, "does": true, "for": true,
+	"from": true, "had": true, "has": true, "have": true, "how": true, "i": true,
+	"if": true, "in": true, "is": true, "it": true, "its": true, "ll": true,
+	"m": true, "me": true, "my": true, "of": true, "on": true, "or": true,
+	"s": true, "should": true, "so": true, "t": true, "that": true, "the": true,
+	"their": true, "there": true, "this": true, "to": true, "ve": true,
+	"was": true, "we": true, "what": true, "when": true, "where": true,
+	"which": true, "who": true, "why": true, "will": true, "with": true,
+	"would": true, "you": true, "your": true,
+}
+
+// KeywordSearch returns the turns that use the most of the words in text,
+// best first, for when there's no embedding model. Rare words count for
+// more than common ones, and words in over half the turns (once there are
+// a few) don't count at all, nor do words like "the". Turns from
+// excludeConv, if it isn't 0, are left out.
+func (sqlDB *ChatDB) KeywordSearch(text string, excludeConv, limit int) ([]Match, error) {
+	words := searchTerms(text)
+	if len(words) == 0 {
+		return nil, nil
+	}
+	fts := searchTable(sqlDB.dbTable)
+
+	var turns int
+	err := sqlDB.db.QueryRow(`SELECT COUNT(*) FROM `+sqlDB.dbTable+` WHERE COALESCE(conv_id, 0) != ?;`, excludeConv).Scan(&turns)
+	if err != nil {
+		return nil, fmt.Errorf("error searching conversations: %v", err)
+	}
+
+	// How much each word counts, by how few turns use it
+	weights := make([]float64, len(words))
+	phrases := make([]string, len(words))
+	total := 0.0
+	for i, word := range words {
+		phrases[i] = `"` + word + `"`
+		var n int
+		err := sqlDB.db.QueryRow(`
+			SELECT COUNT(*) FROM `+fts+` f
+			JOIN `+sqlDB.dbTable+` c ON c.id = f.docid
+			WHERE `+fts+` MATCH ? AND COALESCE(c.conv_id, 0) != ?;
+		`, phrases[i], excludeConv).Scan(&n)
+		if err != nil {
+			return nil, fmt.Errorf("error searching conversations: %v", err)
+		}
+		if n == 0 || (turns >= 10 && 2*n > turns) {
+			continue
+		}
+		weights[i] = math.Log(1 + float64(turns)/float64(n))
+		total += weights[i]
+	}
+	if total == 0 {
+		return nil, nil
+	}
+
+	// matchinfo's "pcx" is the number of phrases and columns, then for each
+	// phrase and column, how many times it's in this turn (and two counts
+	// for the whole table, which aren't needed)
+	rows, err := sqlDB.db.Query(`
+		SELECT c.id, COALESCE(c.conv_id, 0), c.timestamp, c.model_name, c.prompt, c.response, matchinfo(`+fts+`, 'pcx')
+		FROM `+fts+` f
+		JOIN `+sqlDB.dbTable+` c ON c.id = f.docid
+		WHERE `+fts+` MATCH ? AND COALESCE(c.conv_id, 0) != ?;
+	`, strings.Join(phrases, " OR "), excludeConv)
+	if err != nil {
+		return nil, fmt.Errorf("error searching conversations: %v", err)
+	}
+	defer rows.Close()
+
+	var matches []Match
+	for rows.Next() {
+		var m Match
+		var info []byte
+		if err := rows.Scan(&m.ID, &m.ConvID, &m.Timestamp, &m.Model, &m.Prompt, &m.Response, &info); err != nil {
+			return nil, fmt.Errorf("error searching conversations: %v", err)
+		}
+		counts := decodeMatchInfo(info)
+		if len(counts) < 2 {
+			continue
+		}
+		phraseCount, columns := int(counts[0]), int(counts[1])
+		for i := 0; i < phraseCount && i < len(weights); i++ {
+			for col := 0; col < columns; col++ {
+				if k := 2 + 3*(i*columns+col); k < len(counts) && counts[k] > 0 {
+					m.Score += weights[i]
+					break
+				}
+			}
+		}
+		if m.Score > 0 {
+			m.Score /= total
+			matches = append(matches, m)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error searching conversations: %v", err)
+	}
+
+	// Newest first when they're as good as each other
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ID > matches[j].ID
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// decodeMatchInfo is matchinfo's blob as the unsigned 32-bit integers it
+// is, in the machine's byte order
+func decodeMatchInfo(blob []byte) []uint32 {
+	counts := make([]uint32, len(blob)/4)
+	for i := range counts {
+		counts[i] = binary.NativeEndian.Uint32(blob[4*i:])
+	}
+	return counts
+}
+
+// Cosine is how alike two vectors are: 1 if they point the same way, 0 if
+// they have nothing in common
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// keywords are the distinct words in s, lowercased
+func keywords(s string) []string {
+	seen := make(map[string]bool)
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// searchTerms are the words in s worth looking for: its keywords, less
+// the stop words
+func searchTerms(s string) []string {
+	var terms []string
+	for _, word := range keywords(s) {
+		if !stopWords[word] {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// keywordScore is the fraction of words that are words in text (so "cat"
+// isn't found in "concatenate")
+func keywordScore(words []string, text string) float64 {
+	used := make(map[string]bool)
+	for _, word := range keywords(text) {
+		used[word] = true
+	}
+	found := 0
+	for _, word := range words {
+		if used[word] {
+			found++
+		}
+	}
+	return float64(found) / float64(len(words))
+}
+
+// EncodeVector is how embeddings are stored: as little-endian float32s
+func EncodeVector(vector []float32) []byte {
+	blob := make([]byte, 4*len(vector))
+	for i, f := range vector {
+		binary.LittleEndian.PutUint32(blob[4*i:], math.Float32bits(f))
+	}
+	return blob
+}
+
+// DecodeVector is a vector as EncodeVector stored it
+func DecodeVector(blob []byte) []float32 {
+	vector := make([]float32, len(blob)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(blob[4*i:]))
+	}
+	return vector
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbeddings(t *testing.T) {
+	db, err := NewDB(dbPath, dbTable)
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.InsertConversation("How do castles move?", "Along ranks and files.", "llama", 0.5, 10, 20, 1))
+	assert.Nil(t, db.InsertConversation("What's a good soup?", "Leek and potato.", "llama", 0.5, 10, 20, 2))
+	assert.Nil(t, db.InsertConversation("And the knight?", "In an L.", "llama", 0.5, 10, 20, 1))
+
+	turns, err := db.TurnsWithoutEmbeddings("embed", 10)
+	assert.Nil(t, err)
+	assert.Len(t, turns, 3)
+	assert.Equal(t, "How do castles move?", turns[0].Prompt)
+
+	vectors := [][]float32{{1, 0, 0}, {0, 1, 0}, {0.8, 0.2, 0}}
+	for i, turn := range turns[:2] {
+		assert.Nil(t, db.SaveEmbedding(turn, "embed", vectors[i]))
+	}
+	turns, err = db.TurnsWithoutEmbeddings("embed", 10)
+	assert.Nil(t, err)
+	assert.Len(t, turns, 1)
+	assert.Equal(t, "And the knight?", turns[0].Prompt)
+	assert.Nil(t, db.SaveEmbedding(turns[0], "embed", vectors[2]))
+
+	// Another model's are separate
+	turns, err = db.TurnsWithoutEmbeddings("other", 2)
+	assert.Nil(t, err)
+	assert.Len(t, turns, 2)
+
+	matches, err := db.SemanticSearch(SemanticQuery{Model: "embed", Vector: []float32{1, 0.1, 0}, Limit: 2})
+	assert.Nil(t, err)
+	assert.Len(t, matches, 2)
+	assert.Equal(t, "How do castles move?", matches[0].Prompt)
+	assert.Equal(t, "And the knight?", matches[1].Prompt)
+	assert.Equal(t, 1, matches[1].ConvID)
+	assert.InDelta(t, 0.995, matches[0].Score, 0.001)
+
+	// Keywords can make up for meaning
+	matches, err = db.SemanticSearch(SemanticQuery{Model: "embed", Vector: []float32{1, 0.1, 0}, Keywords: "knight L", KeywordWeight: 0.5})
+	assert.Nil(t, err)
+	assert.Len(t, matches, 3)
+	assert.Equal(t, "And the knight?", matches[0].Prompt)
+
+	// But only whole words count, and not ones like "the"
+	matches, err = db.SemanticSearch(SemanticQuery{Model: "embed", Vector: []float32{0, 1, 0}, Keywords: "the cast", KeywordWeight: 0.9})
+	assert.Nil(t, err)
+	assert.Len(t, matches, 3)
+	assert.Equal(t, "What's a good soup?", matches[0].Prompt)
+	assert.InDelta(t, 0.1, matches[0].Score, 0.001)
+
+	// Leaving out a conversation
+	matches, err = db.SemanticSearch(SemanticQuery{Model: "embed", Vector: []float32{1, 0.1, 0}, ExcludeConv: 1})
+	assert.Nil(t, err)
+	assert.Len(t, matches, 1)
+	assert.Equal(t, "What's a good soup?", matches[0].Prompt)
+
+	// As can't vectors of a different length
+	matches, err = db.SemanticSearch(SemanticQuery{Model: "embed", Vector: []float32{1, 0}})
+	assert.Nil(t, err)
+	assert.Empty(t, matches)
+
+	db.Close()
+	RemoveDB()
+}
+
+func TestKeywordSearch(t *testing.T) {
+	db, err := NewDB(dbPath, dbTable)
+	assert.Nil(t, err)
+	defer RemoveDB()
+	defer db.Close()
+
+	assert.Nil(t, db.InsertConversation("How do castles move?", "Along ranks and files.", "llama", 0.5, 10, 20, 1))
+	assert.Nil(t, db.InsertConversation("What's a good soup?", "Leek and potato soup.", "llama", 0.5, 10, 20, 2))
+	assert.Nil(t, db.InsertConversation("And how does the knight move?", "In an L.", "llama", 0.5, 10, 20, 1))
+	assert.Nil(t, db.InsertConversation("Is potato soup hard to make?", "Not at all.", "llama", 0.5, 10, 20, 3))
+
+	// "soup" is in two turns and "leek" in one, so leek counts for more
+	matches, err := db.KeywordSearch("leek soup", 0, 10)
+	assert.Nil(t, err)
+	assert.Len(t, matches, 2)
+	assert.Equal(t, "What's a good soup?", matches[0].Prompt)
+	assert.InDelta(t, 1, matches[0].Score, 1e-9)
+	assert.Equal(t, "Is potato soup hard to make?", matches[1].Prompt)
+
+	matches, err = db.KeywordSearch("How does a KNIGHT move", 0, 2)
+	assert.Nil(t, err)
+	assert.Len(t, matches, 2)
+	assert.Equal(t, "And how does the knight move?", matches[0].Prompt)
+	assert.Equal(t, "How do castles move?", matches[1].Prompt)
+
+	// Ties are newest first
+	matches, err = db.KeywordSearch("potato", 0, 10)
+	assert.Nil(t, err)
+	assert.Len(t, matches, 2)
+	assert.Equal(t, "Is potato soup hard to make?", matches[0].Prompt)
+
+	matches, err = db.KeywordSearch("soup", 2, 10)
+	assert.Nil(t, err)
+	assert.Len(t, matches, 1)
+	assert.Equal(t, 3, matches[0].ConvID)
+
+	matches, err = db.KeywordSearch("quiche", 0, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, matches)
+}
+
+func TestCosine(t *testing.T) {
+	assert.InDelta(t, 1, Cosine([]float32{1, 2}, []float32{2, 4}), 1e-9)
+	assert.InDelta(t, 0, Cosine([]float32{1, 0}, []float32{0, 3}), 1e-9)
+	assert.InDelta(t, -1, Cosine([]float32{1, 0}, []float32{-1, 0}), 1e-9)
+	assert.Equal(t, 0.0, Cosine([]float32{0, 0}, []float32{1, 0}))
+	assert.Equal(t, 0.0, Cosine([]float32{1}, []float32{1, 0}))
+
+	vector := []float32{0.25, -1.5, 3}
+	assert.Equal(t, vector, DecodeVector(EncodeVector(vector)))
+}
+
+func TestUpgradeAddsEmbeddings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	old, err := sql.Open("sqlite3", path)
+	assert.Nil(t, err)
+	_, err = old.Exec(SchemaQueryV1(dbTable) + SchemaQueryV2(dbTable) + SchemaQueryV3(dbTable) + SchemaQueryV4(dbTable) +
+		SchemaQueryV5(dbTable) + SchemaQueryV6(dbTable) + SchemaQueryV7(dbTable) + SchemaQueryV8(dbTable))
+	assert.Nil(t, err)
+	old.Close()
+
+	db, err := InitializeDB(path, dbTable)
+	assert.Nil(t, err)
+	version, err := db.Version()
+	assert.Nil(t, err)
+	assert.Equal(t, SchemaVersion, version)
+	assert.Nil(t, db.InsertConversation("Hi", "Hello.", "llama", 0.5, 10, 20, 1))
+	turns, err := db.TurnsWithoutEmbeddings("embed", 10)
+	assert.Nil(t, err)
+	assert.Nil(t, db.SaveEmbedding(turns[0], "embed", []float32{1, 0}))
+	db.Close()
+}
+
+func TestUpgradeIndexesTurns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	old, err := sql.Open("sqlite3", path)
+	assert.Nil(t, err)
+	_, err = old.Exec(SchemaQueryV1(dbTable) + SchemaQueryV2(dbTable) + SchemaQueryV3(dbTable) + SchemaQueryV4(dbTable) +
+		SchemaQueryV5(dbTable) + SchemaQueryV6(dbTable) + SchemaQueryV7(dbTable) + SchemaQueryV8(dbTable) + SchemaQueryV9(dbTable))
+	assert.Nil(t, err)
+	_, err = old.Exec(`INSERT INTO `+dbTable+` (prompt, response, model_name, temperature, conv_id) VALUES (?, ?, 'llama', 0.5, 1);`, "What's a good soup?", "Leek and potato.")
+	assert.Nil(t, err)
+	old.Close()
+
+	db, err := InitializeDB(path, dbTable)
+	assert.Nil(t, err)
+	defer db.Close()
+	version, err := db.Version()
+	assert.Nil(t, err)
+	assert.Equal(t, SchemaVersion, version)
+
+	// What was there before is found, as is what's added since
+	assert.Nil(t, db.InsertConversation("Is potato soup hard to make?", "Not at all.", "llama", 0.5, 10, 20, 2))
+	matches, err := db.KeywordSearch("leek", 0, 10)
+	assert.Nil(t, err)
+	assert.Len(t, matches, 1)
+	assert.Equal(t, 1, matches[0].ConvID)
+	matches, err = db.KeywordSearch("potato", 0, 10)
+	assert.Nil(t, err)
+	assert.Len(t, matches, 2)
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/duluk/ask-ollama/pkg/LLM"
+)
+
+// SaveImages keeps where the images sent with the latest turn of a
+// conversation were, so it's saved after the turn is
+func (sqlDB *ChatDB) SaveImages(convID int, images []LLM.Image) error {
+	if len(images) == 0 {
+		return nil
+	}
+
+	turnID, err := sqlDB.latestTurn(convID)
+	if err != nil {
+		return fmt.Errorf("error saving images: %v", err)
+	}
+
+	tx, err := sqlDB.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error saving images: %v", err)
+	}
+	for _, img := range images {
+		_, err = tx.Exec(`
+			INSERT INTO `+imageTable(sqlDB.dbTable)+` (turn_id, conv_id, path, hash)
+			VALUES (?, ?, ?, ?);
+		`, turnID, convID, img.Path, img.Hash)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error saving images: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error saving images: %v", err)
+	}
+	return nil
+}
+
+// loadImages returns the images sent in a conversation by the id of the
+// turn they were sent with
+func (sqlDB *ChatDB) loadImages(convID int) (map[int][]LLM.Image, error) {
+	rows, err := sqlDB.db.Query(`
+		SELECT turn_id, path, hash
+		FROM `+imageTable(sqlDB.dbTable)+` WHERE conv_id = ? ORDER BY id;
+	`, convID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading images: %v", err)
+	}
+	defer rows.Close()
+
+	images := make(map[int][]LLM.Image)
+	for rows.Next() {
+		var turnID int
+		var img LLM.Image
+		if err := rows.Scan(&turnID, &img.Path, &img.Hash); err != nil {
+			return nil, fmt.Errorf("error loading images: %v", err)
+		}
+		images[turnID] = append(images[turnID], img)
+	}
+	return images, rows.Err()
+}
+
+// imagePaths is for showing which images were sent
+func imagePaths(images []LLM.Image) string {
+	paths := make([]string, 0, len(images))
+	for _, img := range images {
+		paths = append(paths, img.Path)
+	}
+	return strings.Join(paths, ", ")
+}
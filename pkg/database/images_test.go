@@ -0,0 +1,58 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/duluk/ask-ollama/pkg/LLM"
+)
+
+func TestImages(t *testing.T) {
+	db, err := NewDB(dbPath, dbTable)
+	assert.Nil(t, err)
+
+	images := []LLM.Image{{Path: "cat.png", Hash: "abc"}, {Path: "dog.jpg", Hash: "def"}}
+	assert.Nil(t, db.InsertConversation("What are these?", "A cat and a dog.", "llava", 0.5, 10, 20, 1))
+	// Only where they were is kept
+	assert.Nil(t, db.SaveImages(1, []LLM.Image{{Path: "cat.png", Hash: "abc", Data: []byte("meow")}, images[1]}))
+	assert.Nil(t, db.InsertConversation("Which is bigger?", "The dog.", "llava", 0.5, 10, 20, 1))
+	assert.Nil(t, db.SaveImages(1, nil))
+
+	conv, err := db.LoadConversationFromDB(1)
+	assert.Nil(t, err)
+	assert.Len(t, conv, 4)
+	assert.Equal(t, images, conv[0].Images)
+	assert.Nil(t, conv[1].Images)
+	assert.Nil(t, conv[2].Images)
+
+	var buffer bytes.Buffer
+	assert.Nil(t, db.ShowConversation(&buffer, 1))
+	assert.Contains(t, buffer.String(), "Images: cat.png, dog.jpg\n")
+	assert.Equal(t, 1, bytes.Count(buffer.Bytes(), []byte("Images:")))
+
+	db.Close()
+	RemoveDB()
+}
+
+func TestUpgradeAddsImages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	old, err := sql.Open("sqlite3", path)
+	assert.Nil(t, err)
+	_, err = old.Exec(SchemaQueryV1(dbTable) + SchemaQueryV2(dbTable) + SchemaQueryV3(dbTable) +
+		SchemaQueryV4(dbTable) + SchemaQueryV5(dbTable) + SchemaQueryV6(dbTable) + SchemaQueryV7(dbTable))
+	assert.Nil(t, err)
+	old.Close()
+
+	db, err := InitializeDB(path, dbTable)
+	assert.Nil(t, err)
+	version, err := db.Version()
+	assert.Nil(t, err)
+	assert.Equal(t, SchemaVersion, version)
+	assert.Nil(t, db.InsertConversation("What's this?", "A cat.", "llava", 0.5, 10, 20, 1))
+	assert.Nil(t, db.SaveImages(1, []LLM.Image{{Path: "cat.png", Hash: "abc"}}))
+	db.Close()
+}
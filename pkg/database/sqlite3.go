@@ -6,8 +6,11 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"strings"
 
 	"github.com/duluk/ask-ollama/pkg/LLM"
 	_ "github.com/mattn/go-sqlite3"
@@ -46,11 +49,23 @@ func (sqlDB *ChatDB) InsertConversation(
 	inputTokens int32,
 	outputTokens int32,
 	convID int,
+	attachments ...string,
 ) error {
+	// Leave the column NULL when there's nothing attached
+	var attachmentsJSON *string
+	if len(attachments) > 0 {
+		data, err := json.Marshal(attachments)
+		if err != nil {
+			return fmt.Errorf("%v", err)
+		}
+		attachmentsJSON = new(string)
+		*attachmentsJSON = string(data)
+	}
+
 	_, err := sqlDB.db.Exec(`
-		INSERT INTO `+sqlDB.dbTable+` (prompt, response, model_name, temperature, input_tokens, output_tokens, conv_id)
-		VALUES (?, ?, ?, ?, ?, ?, ?);
-	`, prompt, response, modelName, temperature, inputTokens, outputTokens, convID)
+		INSERT INTO `+sqlDB.dbTable+` (prompt, response, model_name, temperature, input_tokens, output_tokens, conv_id, attachments)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+	`, prompt, response, modelName, temperature, inputTokens, outputTokens, convID, attachmentsJSON)
 	if err != nil {
 		return fmt.Errorf("%v", err)
 	}
@@ -70,8 +85,17 @@ func (sqlDB *ChatDB) Close() {
 // structure has one etnry for the user role with prompt and another with the
 // assistant role and response.
 func (sqlDB *ChatDB) LoadConversationFromDB(convID int) ([]LLM.LLMConversations, error) {
+	toolCalls, err := sqlDB.loadToolCalls(convID)
+	if err != nil {
+		return nil, err
+	}
+	images, err := sqlDB.loadImages(convID)
+	if err != nil {
+		return nil, err
+	}
+
 	rows, err := sqlDB.db.Query(`
-		SELECT prompt, response, model_name, timestamp, temperature, input_tokens, output_tokens, conv_id
+		SELECT id, prompt, response, model_name, timestamp, temperature, input_tokens, output_tokens, conv_id, attachments
 		FROM `+sqlDB.dbTable+` WHERE conv_id = ?;
 	`, convID)
 	if err != nil {
@@ -80,6 +104,7 @@ func (sqlDB *ChatDB) LoadConversationFromDB(convID int) ([]LLM.LLMConversations,
 	defer rows.Close()
 
 	var row struct {
+		id           int
 		prompt       string
 		response     string
 		modelName    string
@@ -88,14 +113,20 @@ func (sqlDB *ChatDB) LoadConversationFromDB(convID int) ([]LLM.LLMConversations,
 		inputTokens  int32
 		outputTokens int32
 		convID       int
+		attachments  sql.NullString
 	}
 	var conversations []LLM.LLMConversations
 	for rows.Next() {
-		err := rows.Scan(&row.prompt, &row.response, &row.modelName, &row.timestamp, &row.temperature, &row.inputTokens, &row.outputTokens, &row.convID)
+		err := rows.Scan(&row.id, &row.prompt, &row.response, &row.modelName, &row.timestamp, &row.temperature, &row.inputTokens, &row.outputTokens, &row.convID, &row.attachments)
 		if err != nil {
 			return nil, fmt.Errorf("%v", err)
 		}
 
+		attachments, err := decodeAttachments(row.attachments)
+		if err != nil {
+			return nil, err
+		}
+
 		userTurn := LLM.LLMConversations{
 			Role:         "user",
 			Content:      row.prompt,
@@ -104,6 +135,8 @@ func (sqlDB *ChatDB) LoadConversationFromDB(convID int) ([]LLM.LLMConversations,
 			InputTokens:  row.inputTokens,
 			OutputTokens: 0,
 			ConvID:       row.convID,
+			Attachments:  attachments,
+			Images:       images[row.id],
 		}
 		conversations = append(conversations, userTurn)
 
@@ -115,6 +148,7 @@ func (sqlDB *ChatDB) LoadConversationFromDB(convID int) ([]LLM.LLMConversations,
 			InputTokens:  row.inputTokens,
 			OutputTokens: row.outputTokens,
 			ConvID:       row.convID,
+			ToolCalls:    toolCalls[row.id],
 		}
 		conversations = append(conversations, assistantTurn)
 	}
@@ -122,6 +156,138 @@ func (sqlDB *ChatDB) LoadConversationFromDB(convID int) ([]LLM.LLMConversations,
 	return conversations, nil
 }
 
+func decodeAttachments(col sql.NullString) ([]string, error) {
+	if !col.Valid || col.String == "" {
+		return nil, nil
+	}
+
+	var attachments []string
+	if err := json.Unmarshal([]byte(col.String), &attachments); err != nil {
+		return nil, fmt.Errorf("error decoding attachments: %v", err)
+	}
+	return attachments, nil
+}
+
+// SaveToolCalls keeps the tools called in the latest turn of a conversation,
+// so it's saved after the turn is
+func (sqlDB *ChatDB) SaveToolCalls(convID int, calls []LLM.ToolCall) error {
+	if len(calls) == 0 {
+		return nil
+	}
+
+	turnID, err := sqlDB.latestTurn(convID)
+	if err != nil {
+		return fmt.Errorf("error saving tool calls: %v", err)
+	}
+
+	tx, err := sqlDB.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error saving tool calls: %v", err)
+	}
+	for _, call := range calls {
+		args, err := json.Marshal(call.Arguments)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error saving tool calls: %v", err)
+		}
+		_, err = tx.Exec(`
+			INSERT INTO `+toolCallTable(sqlDB.dbTable)+` (turn_id, conv_id, name, arguments, result, error)
+			VALUES (?, ?, ?, ?, ?, ?);
+		`, turnID, convID, call.Name, string(args), call.Result, call.Error)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error saving tool calls: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error saving tool calls: %v", err)
+	}
+	return nil
+}
+
+// latestTurn is the id of the last turn saved in a conversation, for the
+// things that are saved along with a turn, after it
+func (sqlDB *ChatDB) latestTurn(convID int) (int, error) {
+	var turnID int
+	err := sqlDB.db.QueryRow(`
+		SELECT MAX(id) FROM `+sqlDB.dbTable+` WHERE conv_id = ?;
+	`, convID).Scan(&turnID)
+	return turnID, err
+}
+
+// loadToolCalls returns the tools called in a conversation by the id of the
+// turn they were called in
+func (sqlDB *ChatDB) loadToolCalls(convID int) (map[int][]LLM.ToolCall, error) {
+	rows, err := sqlDB.db.Query(`
+		SELECT turn_id, name, arguments, result, error
+		FROM `+toolCallTable(sqlDB.dbTable)+` WHERE conv_id = ? ORDER BY id;
+	`, convID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading tool calls: %v", err)
+	}
+	defer rows.Close()
+
+	calls := make(map[int][]LLM.ToolCall)
+	for rows.Next() {
+		var turnID int
+		var call LLM.ToolCall
+		var args, result, errText sql.NullString
+		if err := rows.Scan(&turnID, &call.Name, &args, &result, &errText); err != nil {
+			return nil, fmt.Errorf("error loading tool calls: %v", err)
+		}
+		if args.Valid && args.String != "null" {
+			if err := json.Unmarshal([]byte(args.String), &call.Arguments); err != nil {
+				return nil, fmt.Errorf("error decoding tool call arguments: %v", err)
+			}
+		}
+		call.Result = result.String
+		call.Error = errText.String
+		calls[turnID] = append(calls[turnID], call)
+	}
+	return calls, rows.Err()
+}
+
+// Turn is one prompt and the response to it
+type Turn struct {
+	ID        int
+	ConvID    int
+	Timestamp string
+	Model     string
+	Prompt    string
+	Response  string
+}
+
+// Title is the first line of the prompt, cut short if it's long
+func (t Turn) Title() string {
+	return title(t.Prompt)
+}
+
+// SearchTurns returns the turns whose prompt or response mentions text,
+// newest first
+func (sqlDB *ChatDB) SearchTurns(text string, limit int) ([]Turn, error) {
+	rows, err := sqlDB.db.Query(`
+		SELECT id, COALESCE(conv_id, 0), timestamp, model_name, prompt, response
+		FROM `+sqlDB.dbTable+`
+		WHERE prompt LIKE ? OR response LIKE ?
+		ORDER BY id DESC
+		LIMIT ?;
+	`, "%"+text+"%", "%"+text+"%", limit)
+	if err != nil {
+		return nil, fmt.Errorf("error searching conversations: %v", err)
+	}
+	defer rows.Close()
+
+	var turns []Turn
+	for rows.Next() {
+		var turn Turn
+		if err := rows.Scan(&turn.ID, &turn.ConvID, &turn.Timestamp, &turn.Model, &turn.Prompt, &turn.Response); err != nil {
+			return nil, fmt.Errorf("error searching conversations: %v", err)
+		}
+		turns = append(turns, turn)
+	}
+	return turns, rows.Err()
+}
+
 // TODO: probably want a different return structure, so that the ID and
 // response at the minimum can be returned. But may want prompt too. May want
 // everything.
@@ -151,6 +317,88 @@ func (sqlDB *ChatDB) SearchForConversation(keyword string) ([]int, error) {
 	return responses, nil
 }
 
+// ConversationSummary is enough about a conversation to pick it out of a list
+type ConversationSummary struct {
+	ConvID int
+	// The first line of the first prompt
+	Title   string
+	Model   string
+	Updated string
+}
+
+// RecentConversations lists the conversations most recently added to, newest
+// first
+func (sqlDB *ChatDB) RecentConversations(limit int) ([]ConversationSummary, error) {
+	rows, err := sqlDB.db.Query(`
+		SELECT c.conv_id, c.prompt, c.model_name, last.updated
+		FROM `+sqlDB.dbTable+` c
+		JOIN (
+			SELECT conv_id, MIN(id) AS first_id, MAX(id) AS last_id, MAX(timestamp) AS updated
+			FROM `+sqlDB.dbTable+`
+			WHERE conv_id IS NOT NULL
+			GROUP BY conv_id
+		) last ON c.id = last.first_id
+		ORDER BY last.last_id DESC
+		LIMIT ?;
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%v", err)
+	}
+	defer rows.Close()
+
+	var convs []ConversationSummary
+	for rows.Next() {
+		var conv ConversationSummary
+		var prompt string
+		if err := rows.Scan(&conv.ConvID, &prompt, &conv.Model, &conv.Updated); err != nil {
+			return nil, fmt.Errorf("%v", err)
+		}
+		conv.Title = title(prompt)
+		convs = append(convs, conv)
+	}
+
+	return convs, rows.Err()
+}
+
+func title(prompt string) string {
+	const maxLen = 60
+
+	line, _, _ := strings.Cut(strings.TrimSpace(prompt), "\n")
+	line = strings.TrimSpace(line)
+	if runes := []rune(line); len(runes) > maxLen {
+		line = strings.TrimSpace(string(runes[:maxLen-1])) + "…"
+	}
+	return line
+}
+
+// LoadSummary returns the rolling summary kept for a conversation, which is
+// empty if there isn't one
+func (sqlDB *ChatDB) LoadSummary(convID int) (LLM.Summary, error) {
+	var summary LLM.Summary
+	err := sqlDB.db.QueryRow(`
+		SELECT summary, turns, model_name FROM `+summaryTable(sqlDB.dbTable)+` WHERE conv_id = ?;
+	`, convID).Scan(&summary.Text, &summary.Turns, &summary.Model)
+	if err == sql.ErrNoRows {
+		return LLM.Summary{}, nil
+	}
+	if err != nil {
+		return LLM.Summary{}, fmt.Errorf("error loading summary: %v", err)
+	}
+	return summary, nil
+}
+
+// SaveSummary keeps summary for a conversation, replacing the one before
+func (sqlDB *ChatDB) SaveSummary(convID int, summary LLM.Summary) error {
+	_, err := sqlDB.db.Exec(`
+		INSERT OR REPLACE INTO `+summaryTable(sqlDB.dbTable)+` (conv_id, summary, turns, model_name)
+		VALUES (?, ?, ?, ?);
+	`, convID, summary.Text, summary.Turns, summary.Model)
+	if err != nil {
+		return fmt.Errorf("error saving summary: %v", err)
+	}
+	return nil
+}
+
 func (sqlDB *ChatDB) GetModel(convID int) (string, error) {
 	rows, err := sqlDB.db.Query(`
 		SELECT model_name FROM `+sqlDB.dbTable+` WHERE conv_id = ?;
@@ -171,17 +419,27 @@ func (sqlDB *ChatDB) GetModel(convID int) (string, error) {
 	return model, nil
 }
 
-func (sqlDB *ChatDB) ShowConversation(convID int) {
+func (sqlDB *ChatDB) ShowConversation(w io.Writer, convID int) error {
+	toolCalls, err := sqlDB.loadToolCalls(convID)
+	if err != nil {
+		return fmt.Errorf("error showing conversation: %v", err)
+	}
+	images, err := sqlDB.loadImages(convID)
+	if err != nil {
+		return fmt.Errorf("error showing conversation: %v", err)
+	}
+
 	rows, err := sqlDB.db.Query(`
-		SELECT prompt, response, model_name, temperature, input_tokens, output_tokens, conv_id
+		SELECT id, prompt, response, model_name, temperature, input_tokens, output_tokens, conv_id, attachments
 		FROM `+sqlDB.dbTable+` WHERE conv_id = ?;
 	`, convID)
 	if err != nil {
-		log.Fatalf("error showing conversation: %v", err)
+		return fmt.Errorf("error showing conversation: %v", err)
 	}
 	defer rows.Close()
 
 	var row struct {
+		id           int
 		prompt       string
 		response     string
 		modelName    string
@@ -189,18 +447,45 @@ func (sqlDB *ChatDB) ShowConversation(convID int) {
 		inputTokens  int32
 		outputTokens int32
 		convID       int
+		attachments  sql.NullString
 	}
+	found := false
 	for rows.Next() {
-		err := rows.Scan(&row.prompt, &row.response, &row.modelName, &row.temperature, &row.inputTokens, &row.outputTokens, &row.convID)
+		found = true
+		err := rows.Scan(&row.id, &row.prompt, &row.response, &row.modelName, &row.temperature, &row.inputTokens, &row.outputTokens, &row.convID, &row.attachments)
 		if err != nil {
-			log.Fatalf("error showing conversation: %v", err)
+			return fmt.Errorf("error showing conversation: %v", err)
+		}
+		attachments, err := decodeAttachments(row.attachments)
+		if err != nil {
+			return fmt.Errorf("error showing conversation: %v", err)
+		}
+		fmt.Fprintf(w, "Prompt: %s\n", row.prompt)
+		fmt.Fprintf(w, "Response: %s\n", row.response)
+		fmt.Fprintf(w, "Model: %s\n", row.modelName)
+		fmt.Fprintf(w, "Temperature: %f\n", row.temperature)
+		fmt.Fprintf(w, "Input tokens: %d\n", row.inputTokens)
+		fmt.Fprintf(w, "Output tokens: %d\n", row.outputTokens)
+		fmt.Fprintf(w, "Conversation ID: %d\n", row.convID)
+		if len(attachments) > 0 {
+			fmt.Fprintf(w, "Attachments: %s\n", strings.Join(attachments, ", "))
 		}
-		fmt.Printf("Prompt: %s\n", row.prompt)
-		fmt.Printf("Response: %s\n", row.response)
-		fmt.Printf("Model: %s\n", row.modelName)
-		fmt.Printf("Temperature: %f\n", row.temperature)
-		fmt.Printf("Input tokens: %d\n", row.inputTokens)
-		fmt.Printf("Output tokens: %d\n", row.outputTokens)
-		fmt.Printf("Conversation ID: %d\n", row.convID)
+		if len(images[row.id]) > 0 {
+			fmt.Fprintf(w, "Images: %s\n", imagePaths(images[row.id]))
+		}
+		for _, call := range toolCalls[row.id] {
+			fmt.Fprintf(w, "Tool call: %s\n", call)
+			if call.Error != "" {
+				fmt.Fprintf(w, "Tool error: %s\n", call.Error)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error showing conversation: %v", err)
 	}
+	if !found {
+		return fmt.Errorf("no conversation with ID %d", convID)
+	}
+
+	return nil
 }
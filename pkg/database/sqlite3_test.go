@@ -1,9 +1,13 @@
 package database
 
 import (
+	"bytes"
+	"database/sql"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/duluk/ask-ollama/pkg/LLM"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
 )
@@ -86,6 +90,26 @@ func TestLoadConversations(t *testing.T) {
 	RemoveDB()
 }
 
+func TestInsertConversationWithAttachments(t *testing.T) {
+	db, err := NewDB(dbPath, dbTable)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	err = db.InsertConversation("prompt", "response", "model_name", 0.5, 10, 20, 1, "main.go", "go.mod")
+	assert.Nil(t, err)
+	err = db.InsertConversation("prompt2", "response2", "model_name", 0.5, 10, 20, 1)
+	assert.Nil(t, err)
+
+	conversations, err := db.LoadConversationFromDB(1)
+	assert.Nil(t, err)
+	assert.Len(t, conversations, 4)
+	assert.Equal(t, []string{"main.go", "go.mod"}, conversations[0].Attachments)
+	assert.Nil(t, conversations[2].Attachments)
+
+	db.Close()
+	RemoveDB()
+}
+
 func TestSearchForConversation(t *testing.T) {
 	db, err := NewDB(dbPath, dbTable)
 	assert.Nil(t, err)
@@ -113,3 +137,117 @@ func TestSearchForConversation(t *testing.T) {
 func RemoveDB() {
 	os.Remove(dbPath)
 }
+
+func TestRecentConversations(t *testing.T) {
+	db, err := NewDB(dbPath, dbTable)
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.InsertConversation("First question\nwith more lines", "response", "llama", 0.5, 10, 20, 1))
+	assert.Nil(t, db.InsertConversation("Another question", "response", "qwen", 0.5, 10, 20, 2))
+	assert.Nil(t, db.InsertConversation("Follow-up to the first", "response", "llama", 0.5, 10, 20, 1))
+	assert.Nil(t, db.InsertConversation("A very long question that goes on and on and on, well past where it'd fit in a menu", "response", "llama", 0.5, 10, 20, 3))
+
+	convs, err := db.RecentConversations(2)
+	assert.Nil(t, err)
+	assert.Len(t, convs, 2)
+	assert.Equal(t, 3, convs[0].ConvID)
+	assert.Equal(t, "A very long question that goes on and on and on, well past…", convs[0].Title)
+	// Conversation 1 was added to after 2 was started
+	assert.Equal(t, 1, convs[1].ConvID)
+	assert.Equal(t, "First question", convs[1].Title)
+	assert.Equal(t, "llama", convs[1].Model)
+
+	db.Close()
+	RemoveDB()
+}
+
+func TestSummary(t *testing.T) {
+	db, err := NewDB(dbPath, dbTable)
+	assert.Nil(t, err)
+
+	summary, err := db.LoadSummary(1)
+	assert.Nil(t, err)
+	assert.Equal(t, LLM.Summary{}, summary)
+
+	assert.Nil(t, db.SaveSummary(1, LLM.Summary{Text: "They talked about chess.", Turns: 3, Model: "llama3.2:1b"}))
+	assert.Nil(t, db.SaveSummary(1, LLM.Summary{Text: "They talked about chess, then checkers.", Turns: 5, Model: "llama3.2:1b"}))
+	assert.Nil(t, db.SaveSummary(2, LLM.Summary{Text: "Go.", Turns: 1, Model: "qwen"}))
+
+	summary, err = db.LoadSummary(1)
+	assert.Nil(t, err)
+	assert.Equal(t, LLM.Summary{Text: "They talked about chess, then checkers.", Turns: 5, Model: "llama3.2:1b"}, summary)
+
+	db.Close()
+	RemoveDB()
+}
+
+func TestUpgradeAddsSummaries(t *testing.T) {
+	// A database from before there were summaries
+	path := filepath.Join(t.TempDir(), "old.db")
+	old, err := sql.Open("sqlite3", path)
+	assert.Nil(t, err)
+	_, err = old.Exec(SchemaQueryV1(dbTable) + SchemaQueryV2(dbTable) + SchemaQueryV3(dbTable) + SchemaQueryV4(dbTable))
+	assert.Nil(t, err)
+	old.Close()
+
+	db, err := InitializeDB(path, dbTable)
+	assert.Nil(t, err)
+	version, err := db.Version()
+	assert.Nil(t, err)
+	assert.Equal(t, SchemaVersion, version)
+	assert.Nil(t, db.SaveSummary(1, LLM.Summary{Text: "Chess.", Turns: 1, Model: "llama"}))
+	db.Close()
+}
+
+func TestToolCalls(t *testing.T) {
+	db, err := NewDB(dbPath, dbTable)
+	assert.Nil(t, err)
+
+	calls := []LLM.ToolCall{
+		{Name: "read_file", Arguments: map[string]any{"path": "main.go"}, Result: "package main"},
+		{Name: "run_command", Arguments: map[string]any{"command": "rm -rf /"}, Error: "rm isn't allowed"},
+	}
+	assert.Nil(t, db.InsertConversation("What's in main.go?", "Not much.", "llama", 0.5, 10, 20, 1))
+	assert.Nil(t, db.SaveToolCalls(1, calls))
+	assert.Nil(t, db.InsertConversation("Anything else?", "No.", "llama", 0.5, 10, 20, 1))
+	assert.Nil(t, db.SaveToolCalls(1, nil))
+
+	conv, err := db.LoadConversationFromDB(1)
+	assert.Nil(t, err)
+	assert.Len(t, conv, 4)
+	assert.Nil(t, conv[0].ToolCalls)
+	assert.Equal(t, calls, conv[1].ToolCalls)
+	assert.Nil(t, conv[3].ToolCalls)
+
+	var buffer bytes.Buffer
+	assert.Nil(t, db.ShowConversation(&buffer, 1))
+	assert.Contains(t, buffer.String(), "Tool call: read_file(path=\"main.go\")\nTool call: run_command(command=\"rm -rf /\")\nTool error: rm isn't allowed\n")
+
+	db.Close()
+	RemoveDB()
+}
+
+func TestSearchTurns(t *testing.T) {
+	db, err := NewDB(dbPath, dbTable)
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.InsertConversation("Tell me about chess", "It's a game.", "llama", 0.5, 10, 20, 1))
+	assert.Nil(t, db.InsertConversation("And go?", "Also a game, older than chess.", "qwen", 0.5, 10, 20, 1))
+	assert.Nil(t, db.InsertConversation("What's for dinner?", "Soup.", "llama", 0.5, 10, 20, 2))
+
+	turns, err := db.SearchTurns("chess", 5)
+	assert.Nil(t, err)
+	assert.Len(t, turns, 2)
+	// Newest first
+	assert.Equal(t, "And go?", turns[0].Prompt)
+	assert.Equal(t, "qwen", turns[0].Model)
+	assert.Equal(t, "It's a game.", turns[1].Response)
+	assert.Equal(t, 1, turns[1].ConvID)
+
+	turns, err = db.SearchTurns("chess", 1)
+	assert.Nil(t, err)
+	assert.Len(t, turns, 1)
+
+	db.Close()
+	RemoveDB()
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"fmt"
+)
+
+type ModelStats struct {
+	Model         string `json:"model"`
+	Conversations int    `json:"conversations"`
+	Turns         int    `json:"turns"`
+	InputTokens   int64  `json:"input_tokens"`
+	OutputTokens  int64  `json:"output_tokens"`
+}
+
+// Stats sums up everything in the table. A turn is one prompt and its
+// response; a conversation is all the turns with the same conv_id.
+type Stats struct {
+	Conversations int          `json:"conversations"`
+	Turns         int          `json:"turns"`
+	InputTokens   int64        `json:"input_tokens"`
+	OutputTokens  int64        `json:"output_tokens"`
+	First         string       `json:"first"`
+	Last          string       `json:"last"`
+	Models        []ModelStats `json:"models"`
+}
+
+func (sqlDB *ChatDB) Stats() (*Stats, error) {
+	var stats Stats
+	err := sqlDB.db.QueryRow(`
+		SELECT COUNT(DISTINCT conv_id), COUNT(*), COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0),
+			COALESCE(MIN(timestamp), ''), COALESCE(MAX(timestamp), '')
+		FROM `+sqlDB.dbTable+`;
+	`).Scan(&stats.Conversations, &stats.Turns, &stats.InputTokens, &stats.OutputTokens, &stats.First, &stats.Last)
+	if err != nil {
+		return nil, fmt.Errorf("%v", err)
+	}
+
+	rows, err := sqlDB.db.Query(`
+		SELECT model_name, COUNT(DISTINCT conv_id), COUNT(*), COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0)
+		FROM ` + sqlDB.dbTable + `
+		GROUP BY model_name
+		ORDER BY COUNT(*) DESC, model_name;
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("%v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ms ModelStats
+		if err := rows.Scan(&ms.Model, &ms.Conversations, &ms.Turns, &ms.InputTokens, &ms.OutputTokens); err != nil {
+			return nil, fmt.Errorf("%v", err)
+		}
+		stats.Models = append(stats.Models, ms)
+	}
+
+	return &stats, rows.Err()
+}
+
+// Version is the schema version the database is at
+func (sqlDB *ChatDB) Version() (int, error) {
+	var version int
+	err := sqlDB.db.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+// Vacuum rebuilds the database file, giving back the space from deleted rows
+func (sqlDB *ChatDB) Vacuum() error {
+	_, err := sqlDB.db.Exec("VACUUM")
+	return err
+}
+
+// Backup writes a copy of the database to path, which mustn't already exist.
+// It's safe to do while the database is in use, unlike copying the file.
+func (sqlDB *ChatDB) Backup(path string) error {
+	_, err := sqlDB.db.Exec("VACUUM INTO ?", path)
+	if err != nil {
+		return fmt.Errorf("error backing up database to %s: %v", path, err)
+	}
+	return nil
+}
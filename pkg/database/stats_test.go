@@ -0,0 +1,77 @@
+package database
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	db, err := NewDB(dbPath, dbTable)
+	assert.Nil(t, err)
+
+	stats, err := db.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.Turns)
+	assert.Len(t, stats.Models, 0)
+
+	assert.Nil(t, db.InsertConversation("prompt", "response", "llama", 0.5, 10, 20, 1))
+	assert.Nil(t, db.InsertConversation("prompt2", "response2", "llama", 0.5, 30, 40, 1))
+	assert.Nil(t, db.InsertConversation("prompt3", "response3", "qwen", 0.5, 5, 6, 2))
+
+	stats, err = db.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, stats.Conversations)
+	assert.Equal(t, 3, stats.Turns)
+	assert.Equal(t, int64(45), stats.InputTokens)
+	assert.Equal(t, int64(66), stats.OutputTokens)
+	assert.Equal(t, []ModelStats{
+		{Model: "llama", Conversations: 1, Turns: 2, InputTokens: 40, OutputTokens: 60},
+		{Model: "qwen", Conversations: 1, Turns: 1, InputTokens: 5, OutputTokens: 6},
+	}, stats.Models)
+
+	db.Close()
+	RemoveDB()
+}
+
+func TestShowConversation(t *testing.T) {
+	db, err := NewDB(dbPath, dbTable)
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.InsertConversation("prompt", "response", "llama", 0.5, 10, 20, 1))
+
+	var out bytes.Buffer
+	assert.Nil(t, db.ShowConversation(&out, 1))
+	assert.Contains(t, out.String(), "Prompt: prompt\n")
+	assert.Contains(t, out.String(), "Conversation ID: 1\n")
+
+	assert.NotNil(t, db.ShowConversation(&out, 2))
+
+	db.Close()
+	RemoveDB()
+}
+
+func TestBackup(t *testing.T) {
+	db, err := InitializeDB(dbPath, dbTable)
+	assert.Nil(t, err)
+	assert.Nil(t, db.InsertConversation("prompt", "response", "llama", 0.5, 10, 20, 1))
+
+	backupPath := filepath.Join(t.TempDir(), "backup.db")
+	assert.Nil(t, db.Backup(backupPath))
+	// Won't overwrite
+	assert.NotNil(t, db.Backup(backupPath))
+	db.Close()
+	RemoveDB()
+
+	backup, err := InitializeDB(backupPath, dbTable)
+	assert.Nil(t, err)
+	version, err := backup.Version()
+	assert.Nil(t, err)
+	assert.Equal(t, SchemaVersion, version)
+	conversations, err := backup.LoadConversationFromDB(1)
+	assert.Nil(t, err)
+	assert.Len(t, conversations, 2)
+	backup.Close()
+}
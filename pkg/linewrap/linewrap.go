@@ -4,22 +4,54 @@ import (
 	"bytes"
 	// "fmt"
 	"io"
-	"strings"
+	"sync/atomic"
+	"unicode/utf8"
 )
 
+// LineWrapper word-wraps text written to it in chunks, as a streamed response
+// arrives. The word currently being received (and the spaces before it) are
+// held back until we know whether it fits on the line, so the last word
+// isn't written until Flush is called.
 type LineWrapper struct {
-	maxWidth  int
+	// Atomic so the terminal can be resized while an answer is streaming in
+	maxWidth  atomic.Int64
 	currWidth int
 	tabWidth  int
 	writer    io.Writer
+
+	// The start of a multi-byte rune or an escape sequence that was cut off
+	// at the end of the last Write. It's held until the rest arrives.
+	pending []byte
+
+	// The word being built up and how many columns it takes
+	word      []byte
+	wordWidth int
+	// Columns of whitespace between the last word written and this one
+	spaces int
+	// Nothing but indentation has been written since the last newline in the
+	// input. Leading whitespace is kept then (think code), but not at the
+	// start of a line we wrapped ourselves.
+	lineStart bool
 }
 
 func NewLineWrapper(maxWidth, tabWidth int, lwWriter io.Writer) *LineWrapper {
-	return &LineWrapper{
-		maxWidth: maxWidth,
-		tabWidth: tabWidth,
-		writer:   lwWriter,
+	lw := &LineWrapper{
+		tabWidth:  tabWidth,
+		writer:    lwWriter,
+		lineStart: true,
 	}
+	lw.maxWidth.Store(int64(maxWidth))
+	return lw
+}
+
+// SetWidth changes the width lines are wrapped at. It's safe to call from
+// another goroutine, and takes effect from the next word.
+func (lw *LineWrapper) SetWidth(maxWidth int) {
+	lw.maxWidth.Store(int64(maxWidth))
+}
+
+func (lw *LineWrapper) width() int {
+	return int(lw.maxWidth.Load())
 }
 
 // Allow wrapping for input that comes in chunks, versus building the line and
@@ -27,7 +59,14 @@ func NewLineWrapper(maxWidth, tabWidth int, lwWriter io.Writer) *LineWrapper {
 func (lw *LineWrapper) Write(data []byte) (n int, err error) {
 	var buffer bytes.Buffer
 
-	for i, b := range data {
+	input := data
+	if len(lw.pending) > 0 {
+		input = append(lw.pending, data...)
+		lw.pending = nil
+	}
+
+	for i := 0; i < len(input); {
+		b := input[i]
 		// Debug stuff I want to leave for future usage
 		// if b < 32 || b > 126 {
 		// 	fmt.Printf("Special character: %q (ASCII: %d)\n", b, b)
@@ -35,46 +74,130 @@ func (lw *LineWrapper) Write(data []byte) (n int, err error) {
 		// 	fmt.Printf("Character: %q (ASCII: %d)\n", b, b)
 		// }
 
+		// Escape sequences go along with the word they're next to but take
+		// up no room
+		if b == 0x1b {
+			seqLen, complete := escapeLen(input[i:])
+			if !complete {
+				lw.pending = append([]byte(nil), input[i:]...)
+				break
+			}
+			lw.word = append(lw.word, input[i:i+seqLen]...)
+			i += seqLen
+			continue
+		}
+
+		if b >= utf8.RuneSelf {
+			if !utf8.FullRune(input[i:]) {
+				lw.pending = append([]byte(nil), input[i:]...)
+				break
+			}
+			r, size := utf8.DecodeRune(input[i:])
+			lw.addRune(&buffer, input[i:i+size], RuneWidth(r))
+			i += size
+			continue
+		}
+
 		switch b {
 		case '\n':
+			lw.endWord(&buffer)
+			// Trailing whitespace is dropped
+			lw.spaces = 0
 			buffer.WriteByte('\n')
 			lw.currWidth = 0
+			lw.lineStart = true
 		case '\t':
-			spaces := strings.Repeat(" ", lw.tabWidth)
-			lw.currWidth += lw.tabWidth
-			buffer.WriteString(spaces)
+			lw.addSpace(&buffer, lw.tabWidth)
 		case ' ':
-			// Don't write a space if we're at the beginning of a line...
-			if lw.currWidth != 0 {
-				buffer.WriteByte(' ')
-			}
-			// ...unless the next character is a space (and is within bounds),
-			// then we want to write it. This is for code indentation. However,
-			// there is the possibility that we are reading a line that ends on
-			// exactly maxWidth, followed by two spaces on the beginning of the
-			// next line, both of which would be printed even though we
-			// wouldn't want that. I'm not sure how to account for that.
-			if lw.currWidth == 0 && i+1 < len(data) {
-				if data[i+1] == ' ' {
-					buffer.WriteByte(' ')
-				}
-			}
-
-			// We still need to count the width; otherwise, all initial spaces
-			// will likely be ignored
-			lw.currWidth++
-
-			if lw.currWidth >= lw.maxWidth {
-				buffer.WriteByte('\n')
-				lw.currWidth = 0
-			}
+			lw.addSpace(&buffer, 1)
 		default:
-			buffer.WriteByte(b)
-			lw.currWidth++
+			lw.addRune(&buffer, input[i:i+1], RuneWidth(rune(b)))
 		}
+		i++
 	}
 
 	lw.writer.Write(buffer.Bytes())
 
 	return len(data), nil
 }
+
+func (lw *LineWrapper) addSpace(buffer *bytes.Buffer, width int) {
+	lw.endWord(buffer)
+
+	// Indentation at the start of a line is written straight away
+	if lw.lineStart {
+		for i := 0; i < width; i++ {
+			buffer.WriteByte(' ')
+		}
+		lw.currWidth += width
+		return
+	}
+
+	lw.spaces += width
+}
+
+func (lw *LineWrapper) addRune(buffer *bytes.Buffer, r []byte, width int) {
+	// CJK text doesn't put spaces between words, but a line can be broken
+	// between any two wide characters, so each one is treated as a word
+	if width == 2 {
+		lw.endWord(buffer)
+		lw.word = append(lw.word, r...)
+		lw.wordWidth = width
+		lw.endWord(buffer)
+		return
+	}
+
+	// A word that's longer than a whole line has to be broken somewhere.
+	// Put what we have on a line of its own and carry on with the rest.
+	if maxWidth := lw.width(); maxWidth > 0 && lw.wordWidth+width > maxWidth {
+		lw.endWord(buffer)
+		buffer.WriteByte('\n')
+		lw.currWidth = 0
+	}
+
+	lw.word = append(lw.word, r...)
+	lw.wordWidth += width
+}
+
+// endWord writes out the word that's been building up, along with the
+// spaces in front of it, wrapping first if it won't fit on this line. The
+// spaces are dropped if it wraps.
+func (lw *LineWrapper) endWord(buffer *bytes.Buffer) {
+	if len(lw.word) == 0 {
+		return
+	}
+
+	if maxWidth := lw.width(); maxWidth > 0 && lw.currWidth > 0 && lw.currWidth+lw.spaces+lw.wordWidth > maxWidth {
+		buffer.WriteByte('\n')
+		lw.currWidth = 0
+		lw.spaces = 0
+	}
+
+	for i := 0; i < lw.spaces; i++ {
+		buffer.WriteByte(' ')
+	}
+	buffer.Write(lw.word)
+	lw.currWidth += lw.spaces + lw.wordWidth
+
+	lw.word = lw.word[:0]
+	lw.wordWidth = 0
+	lw.spaces = 0
+	lw.lineStart = false
+}
+
+// Flush writes out the last word, and anything held back waiting for the rest
+// of a rune or escape sequence. Call it when there's no more input coming.
+func (lw *LineWrapper) Flush() error {
+	var buffer bytes.Buffer
+
+	lw.endWord(&buffer)
+	buffer.Write(lw.pending)
+	lw.pending = nil
+	lw.spaces = 0
+
+	if buffer.Len() == 0 {
+		return nil
+	}
+	_, err := lw.writer.Write(buffer.Bytes())
+	return err
+}
@@ -14,6 +14,7 @@ func TestLineWrapper_Write(t *testing.T) {
 		if n != len(expectedOutput) || err != nil {
 			t.Errorf("expected output: %q, got error: %v", expectedOutput, err)
 		}
+		lw.Flush()
 		got := buffer.String()
 		if got != expectedOutput {
 			t.Errorf("got: %q, want: %q", got, expectedOutput)
@@ -25,12 +26,13 @@ func TestLineWrapper_Write(t *testing.T) {
 		lw := NewLineWrapper(20, 4, &buffer)
 
 		input := "This\tis a very long test string."
-		expectedOutput := "This    is a very long \ntest string."
+		expectedOutput := "This    is a very\nlong test string."
 
 		n, err := lw.Write([]byte(input))
 		if n != len(input) || err != nil {
 			t.Errorf("expected output: %q, got error: %v", expectedOutput, err)
 		}
+		lw.Flush()
 		got := buffer.String()
 		if got != expectedOutput {
 			t.Errorf("got: %q, want: %q", got, expectedOutput)
@@ -41,11 +43,12 @@ func TestLineWrapper_Write(t *testing.T) {
 		var buffer bytes.Buffer
 		lw := NewLineWrapper(10, 4, &buffer)
 		input := "This is a very long test string that should be broken into\nmultiple lines."
-		expectedOutput := "This is a \nvery long \ntest string \nthat should \nbe broken \ninto\nmultiple lines."
+		expectedOutput := "This is a\nvery long\ntest\nstring\nthat\nshould be\nbroken\ninto\nmultiple\nlines."
 		n, err := lw.Write([]byte(input))
 		if n != len(input) || err != nil {
 			t.Errorf("expected output: %q, got error: %v", expectedOutput, err)
 		}
+		lw.Flush()
 		got := buffer.String()
 		if got != expectedOutput {
 			t.Errorf("got: %q, want: %q", got, expectedOutput)
@@ -57,12 +60,13 @@ func TestLineWrapper_Write(t *testing.T) {
 		lw := NewLineWrapper(20, 4, &buffer)
 
 		input := "This is a\tvery long   test string with multiple spaces\tand tabs."
-		expectedOutput := "This is a    very long \n  test string with multiple \nspaces    and tabs."
+		expectedOutput := "This is a    very\nlong   test string\nwith multiple spaces\nand tabs."
 
 		n, err := lw.Write([]byte(input))
 		if n != len(input) || err != nil {
 			t.Errorf("expected output: %q, got error: %v", expectedOutput, err)
 		}
+		lw.Flush()
 		got := buffer.String()
 		if got != expectedOutput {
 			t.Errorf("got: %q, want: %q", got, expectedOutput)
@@ -73,11 +77,12 @@ func TestLineWrapper_Write(t *testing.T) {
 		var buffer bytes.Buffer
 		lw := NewLineWrapper(20, 4, &buffer)
 		input := "This is a very long test string with multiple\nspaces and\ttabs."
-		expectedOutput := "This is a very long \ntest string with multiple\nspaces and    tabs."
+		expectedOutput := "This is a very long\ntest string with\nmultiple\nspaces and    tabs."
 		n, err := lw.Write([]byte(input))
 		if n != len(input) || err != nil {
 			t.Errorf("expected output: %q, got error: %v", expectedOutput, err)
 		}
+		lw.Flush()
 		got := buffer.String()
 		if got != expectedOutput {
 			t.Errorf("got: %q, want: %q", got, expectedOutput)
@@ -114,3 +119,173 @@ func TestLineWrapper_WriteBuffer(t *testing.T) {
 		t.Errorf("expected output: %v, got error: %v", len(data), err)
 	}
 }
+
+func TestLineWrapper_Unicode(t *testing.T) {
+	t.Run("multi-byte runes count as one column", func(t *testing.T) {
+		var buffer bytes.Buffer
+		lw := NewLineWrapper(10, 4, &buffer)
+		input := "café naïve façade"
+		lw.Write([]byte(input))
+		lw.Flush()
+		expected := "café naïve\nfaçade"
+		if got := buffer.String(); got != expected {
+			t.Errorf("got: %q, want: %q", got, expected)
+		}
+	})
+
+	t.Run("wide runes count as two columns", func(t *testing.T) {
+		var buffer bytes.Buffer
+		lw := NewLineWrapper(10, 4, &buffer)
+		input := "日本語 です 🎉 ok"
+		lw.Write([]byte(input))
+		lw.Flush()
+		// Lines can be broken between any two wide characters
+		expected := "日本語 で\nす 🎉 ok"
+		if got := buffer.String(); got != expected {
+			t.Errorf("got: %q, want: %q", got, expected)
+		}
+	})
+
+	t.Run("runes split across writes are not broken", func(t *testing.T) {
+		var buffer bytes.Buffer
+		lw := NewLineWrapper(20, 4, &buffer)
+		input := []byte("héllo 世界")
+		// Feed it one byte at a time, as a stream might
+		for i := range input {
+			lw.Write(input[i : i+1])
+		}
+		lw.Flush()
+		if got := buffer.String(); got != string(input) {
+			t.Errorf("got: %q, want: %q", got, string(input))
+		}
+		if lw.currWidth != 10 {
+			t.Errorf("expected width 10, got %d", lw.currWidth)
+		}
+	})
+
+	t.Run("escape sequences take no room", func(t *testing.T) {
+		var buffer bytes.Buffer
+		lw := NewLineWrapper(10, 4, &buffer)
+		input := "\x1b[1mbold\x1b[22m text \x1b[36mmore\x1b[39m"
+		// Split in the middle of an escape sequence
+		lw.Write([]byte(input[:13]))
+		lw.Write([]byte(input[13:]))
+		lw.Flush()
+		expected := "\x1b[1mbold\x1b[22m text\n\x1b[36mmore\x1b[39m"
+		if got := buffer.String(); got != expected {
+			t.Errorf("got: %q, want: %q", got, expected)
+		}
+	})
+}
+
+func TestLineWrapper_WordWrap(t *testing.T) {
+	tests := []struct {
+		name     string
+		width    int
+		input    string
+		expected string
+	}{
+		{
+			name:     "breaks before the word that would overflow",
+			width:    12,
+			input:    "one two three four five",
+			expected: "one two\nthree four\nfive",
+		},
+		{
+			name:     "words longer than a line are broken",
+			width:    5,
+			input:    "a abcdefghijkl b",
+			expected: "a\nabcde\nfghij\nkl b",
+		},
+		{
+			name:     "indentation after a newline is kept",
+			width:    20,
+			input:    "func main() {\n    fmt.Println()\n}",
+			expected: "func main() {\n    fmt.Println()\n}",
+		},
+		{
+			name:     "no leading spaces after a wrap",
+			width:    10,
+			input:    "abcdefghi   jkl",
+			expected: "abcdefghi\njkl",
+		},
+		{
+			name:     "line ending exactly at the width",
+			width:    9,
+			input:    "abcd efgh  ijk",
+			expected: "abcd efgh\nijk",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			lw := NewLineWrapper(tt.width, 4, &buffer)
+			lw.Write([]byte(tt.input))
+			lw.Flush()
+			if got := buffer.String(); got != tt.expected {
+				t.Errorf("got: %q, want: %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLineWrapper_Chunked(t *testing.T) {
+	input := "The quick brown fox jumps over the lazy dog and keeps on running"
+	var whole bytes.Buffer
+	lw := NewLineWrapper(16, 4, &whole)
+	lw.Write([]byte(input))
+	lw.Flush()
+
+	// A word split across writes should wrap the same as if it came in one
+	// piece
+	for _, size := range []int{1, 2, 5} {
+		var buffer bytes.Buffer
+		lw := NewLineWrapper(16, 4, &buffer)
+		for i := 0; i < len(input); i += size {
+			lw.Write([]byte(input[i:min(i+size, len(input))]))
+		}
+		lw.Flush()
+		if buffer.String() != whole.String() {
+			t.Errorf("chunk size %d: got: %q, want: %q", size, buffer.String(), whole.String())
+		}
+	}
+}
+
+func TestLineWrapper_SetWidth(t *testing.T) {
+	var buffer bytes.Buffer
+	lw := NewLineWrapper(10, 4, &buffer)
+	lw.Write([]byte("one two three "))
+
+	// As if the terminal were resized partway through an answer
+	lw.SetWidth(20)
+	lw.Write([]byte("four five six seven"))
+	lw.Flush()
+
+	expected := "one two\nthree four five six\nseven"
+	if got := buffer.String(); got != expected {
+		t.Errorf("got: %q, want: %q", got, expected)
+	}
+}
+
+func TestStringWidth(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"hello", 5},
+		{"héllo", 5},
+		{"é", 1}, // e + combining acute accent
+		{"日本", 4},
+		{"👍", 2},
+		{"\x1b[1;31mred\x1b[0m", 3},
+		{"\x1b]8;;https://example.com\x07link\x1b]8;;\x07", 4},
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		if got := StringWidth(tt.input); got != tt.expected {
+			t.Errorf("StringWidth(%q): got %d, want %d", tt.input, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package linewrap
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/width"
+)
+
+// RuneWidth is the number of terminal columns r takes up: 2 for East Asian
+// wide and fullwidth characters (which includes most emoji), 0 for combining
+// marks, zero-width joiners and control characters, and 1 for everything
+// else.
+func RuneWidth(r rune) int {
+	switch {
+	case r == utf8.RuneError:
+		return 1
+	case r < 0x20 || r == 0x7f:
+		return 0
+	case r < utf8.RuneSelf:
+		return 1
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	}
+
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// StringWidth is the number of columns s takes up in the terminal. Escape
+// sequences (colors and the like) don't count.
+func StringWidth(s string) int {
+	w := 0
+	for i := 0; i < len(s); {
+		if s[i] == 0x1b {
+			n, _ := escapeLen([]byte(s[i:]))
+			i += n
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		w += RuneWidth(r)
+		i += size
+	}
+	return w
+}
+
+// escapeLen returns the length of the escape sequence at the start of data
+// and whether it's complete. An incomplete one is most likely split across
+// two chunks of a streamed response.
+//
+// Handles CSI sequences (ESC [ ... final byte), which covers colors and
+// cursor movement; OSC sequences (ESC ] ... BEL or ESC \), used for
+// hyperlinks and titles; and two-byte escapes.
+func escapeLen(data []byte) (int, bool) {
+	if len(data) < 2 {
+		return len(data), false
+	}
+
+	switch data[1] {
+	case '[':
+		for i := 2; i < len(data); i++ {
+			b := data[i]
+			if b >= 0x40 && b <= 0x7e {
+				return i + 1, true
+			}
+			// Anything that isn't a parameter or intermediate byte means
+			// this wasn't really an escape sequence; stop here
+			if b < 0x20 || b > 0x3f {
+				return i, true
+			}
+		}
+		return len(data), false
+	case ']':
+		for i := 2; i < len(data); i++ {
+			if data[i] == 0x07 {
+				return i + 1, true
+			}
+			if data[i] == 0x1b && i+1 < len(data) && data[i+1] == '\\' {
+				return i + 2, true
+			}
+		}
+		return len(data), false
+	}
+
+	return 2, true
+}
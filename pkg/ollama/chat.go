@@ -0,0 +1,189 @@
+package ollama
+
+// Ollama's native chat API (/api/chat). Unlike the OpenAI-compatible
+// endpoint, it reports timings and why generation stopped, and it streams
+// newline-delimited JSON objects rather than server-sent events.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+type ChatRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	// Always sent, as the server streams unless told otherwise
+	Stream  bool           `json:"stream"`
+	Options map[string]any `json:"options,omitempty"`
+	// Tools the model may call, for models that can (see the "tools"
+	// capability in ShowResponse)
+	Tools []Tool `json:"tools,omitempty"`
+	// What the answer has to look like: "json" for any JSON, or a JSON
+	// schema it has to match
+	Format json.RawMessage `json:"format,omitempty"`
+}
+
+// Tool describes a function the model can ask to have called
+type Tool struct {
+	// Always "function"
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+type ToolFunction struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// A JSON schema for the arguments, which is always an object
+	Parameters map[string]any `json:"parameters"`
+}
+
+// ToolCall is a model asking for a tool to be called. Unlike OpenAI's API,
+// the arguments are an object, not a string of JSON.
+type ToolCall struct {
+	Function struct {
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	} `json:"function"`
+}
+
+type ChatResponse struct {
+	Model      string  `json:"model"`
+	CreatedAt  string  `json:"created_at"`
+	Message    Message `json:"message"`
+	Done       bool    `json:"done"`
+	DoneReason string  `json:"done_reason,omitempty"`
+	// Durations are in nanoseconds
+	TotalDuration      int64  `json:"total_duration,omitempty"`
+	LoadDuration       int64  `json:"load_duration,omitempty"`
+	PromptEvalCount    int32  `json:"prompt_eval_count,omitempty"`
+	PromptEvalDuration int64  `json:"prompt_eval_duration,omitempty"`
+	EvalCount          int32  `json:"eval_count,omitempty"`
+	EvalDuration       int64  `json:"eval_duration,omitempty"`
+	Error              string `json:"error,omitempty"`
+}
+
+// Chat sends a request to /api/chat. When req.Stream is set, fn is called
+// with each piece of the response as it arrives (fn may be nil otherwise).
+// Either way, the returned response has the complete message along with the
+// token counts and timings from the final piece.
+func (c *Client) Chat(req ChatRequest, fn func(ChatResponse) error) (*ChatResponse, error) {
+	body, err := c.post("/api/chat", req)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	if !req.Stream {
+		var resp ChatResponse
+		if err := json.NewDecoder(body).Decode(&resp); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %v", err)
+		}
+		if resp.Error != "" {
+			return nil, fmt.Errorf("API error: %s", resp.Error)
+		}
+		return &resp, nil
+	}
+
+	var final ChatResponse
+	var content, thinking bytes.Buffer
+	var toolCalls []ToolCall
+	done := false
+
+	scanner := bufio.NewScanner(body)
+	// A single chunk is normally tiny, but allow for big ones anyway
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var chunk ChatResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %v", err)
+		}
+		if chunk.Error != "" {
+			return nil, fmt.Errorf("API error: %s", chunk.Error)
+		}
+
+		content.WriteString(chunk.Message.Content)
+		thinking.WriteString(chunk.Message.Thinking)
+		// Tool calls come whole, but not necessarily in the last chunk
+		toolCalls = append(toolCalls, chunk.Message.ToolCalls...)
+		if fn != nil {
+			if err := fn(chunk); err != nil {
+				return nil, err
+			}
+		}
+
+		if chunk.Done {
+			final = chunk
+			done = true
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	// Otherwise what there is of the answer would pass for all of it
+	if !done {
+		return nil, fmt.Errorf("stream ended before the response was done")
+	}
+
+	final.Message.Role = "assistant"
+	final.Message.Content = content.String()
+	final.Message.Thinking = thinking.String()
+	final.Message.ToolCalls = toolCalls
+
+	return &final, nil
+}
+
+// post sends a JSON request to the native API and returns the response body
+// if the status is OK. The caller needs to close it.
+func (c *Client) post(path string, payload any) (io.ReadCloser, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	return c.request("POST", path, bytes.NewBuffer(jsonData))
+}
+
+// get is post for the endpoints that don't take a request body
+func (c *Client) get(path string) (io.ReadCloser, error) {
+	return c.request("GET", path, nil)
+}
+
+func (c *Client) request(method, path string, body io.Reader) (io.ReadCloser, error) {
+	httpReq, err := http.NewRequest(method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	httpReq.Header.Set("User-Agent", userAgent)
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make client request: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var errorResp struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(resp.Body)
+		if err := json.Unmarshal(data, &errorResp); err != nil || errorResp.Error == "" {
+			return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, bytes.TrimSpace(data))
+		}
+		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, errorResp.Error)
+	}
+
+	return resp.Body, nil
+}
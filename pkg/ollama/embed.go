@@ -0,0 +1,39 @@
+package ollama
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// EmbedRequest is for /api/embed, which turns text into vectors that are
+// close together when the texts mean much the same thing
+type EmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type EmbedResponse struct {
+	Model string `json:"model"`
+	// One for each input, in the same order
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// Embed returns an embedding for each of input, made by model (an embedding
+// model, like nomic-embed-text)
+func (c *Client) Embed(model string, input []string) ([][]float32, error) {
+	body, err := c.post("/api/embed", EmbedRequest{Model: model, Input: input})
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var resp EmbedResponse
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+	if len(resp.Embeddings) != len(input) {
+		return nil, fmt.Errorf("asked for %d embeddings, but got %d", len(input), len(resp.Embeddings))
+	}
+
+	return resp.Embeddings, nil
+}
@@ -0,0 +1,87 @@
+package ollama
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ModelInfo is a model that's been pulled to the server
+type ModelInfo struct {
+	Name       string    `json:"name"`
+	Model      string    `json:"model"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Size       int64     `json:"size"`
+	Digest     string    `json:"digest"`
+	Details    struct {
+		Family            string `json:"family"`
+		ParameterSize     string `json:"parameter_size"`
+		QuantizationLevel string `json:"quantization_level"`
+	} `json:"details"`
+}
+
+// ListModels returns the models installed on the server (`ollama list`)
+func (c *Client) ListModels() ([]ModelInfo, error) {
+	body, err := c.get("/api/tags")
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var resp struct {
+		Models []ModelInfo `json:"models"`
+	}
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return resp.Models, nil
+}
+
+// ShowResponse is what the server knows about a model (`ollama show`)
+type ShowResponse struct {
+	Parameters string `json:"parameters"`
+	Template   string `json:"template"`
+	Details    struct {
+		Family            string `json:"family"`
+		ParameterSize     string `json:"parameter_size"`
+		QuantizationLevel string `json:"quantization_level"`
+	} `json:"details"`
+	// Keys are prefixed with the architecture, eg "llama.context_length"
+	ModelInfo    map[string]any `json:"model_info"`
+	Capabilities []string       `json:"capabilities"`
+}
+
+// ShowModel returns the details of an installed model
+func (c *Client) ShowModel(name string) (*ShowResponse, error) {
+	body, err := c.post("/api/show", map[string]string{"model": name})
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var resp ShowResponse
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return &resp, nil
+}
+
+// Can reports whether the model has a capability, like "tools" or "vision".
+// Servers from before capabilities were reported don't say, in which case
+// it's assumed the model can.
+func (r *ShowResponse) Can(capability string) bool {
+	return len(r.Capabilities) == 0 || slices.Contains(r.Capabilities, capability)
+}
+
+// ContextLength is the longest context the model was trained for, or 0 if
+// the server didn't say
+func (r *ShowResponse) ContextLength() int {
+	arch, _ := r.ModelInfo["general.architecture"].(string)
+	if n, ok := r.ModelInfo[arch+".context_length"].(float64); ok {
+		return int(n)
+	}
+	return 0
+}
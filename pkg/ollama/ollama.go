@@ -6,13 +6,28 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"strings"
 )
 
+const userAgent = "ask-ollama/0.0.1"
+
+// DefaultPort is the port Ollama listens on unless it's told otherwise
+const DefaultPort = "11434"
+
 type Message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// Reasoning from thinking models, when the server separates it out
+	Thinking string `json:"thinking,omitempty"`
+	// The tools the model wants called, in an assistant message
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// Which tool a "tool" message is the result of
+	ToolName string `json:"tool_name,omitempty"`
+	// Base64-encoded images, for models that can see (/api/chat only)
+	Images []string `json:"images,omitempty"`
 }
 
 type ChatCompletionRequest struct {
@@ -45,6 +60,17 @@ type Client struct {
 }
 
 func NewClient(baseURL, apiKey string) *Client {
+	// Ollama's own OLLAMA_HOST is often just host:port, or even just the
+	// host, so allow that here too, with the same defaults it has
+	if baseURL != "" && !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+		if u, err := url.Parse(baseURL); err == nil && u.Port() == "" && u.Hostname() != "" {
+			u.Host = net.JoinHostPort(u.Hostname(), DefaultPort)
+			baseURL = u.String()
+		}
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+
 	return &Client{
 		BaseURL:    baseURL,
 		APIKey:     apiKey,
@@ -65,7 +91,7 @@ func (c *Client) ChatCompletion(req ChatCompletionRequest) (*ChatCompletionRespo
 		return nil, fmt.Errorf("failed to marshal request: %v", err)
 	}
 
-	baseURL := c.BaseURL + "/v1/chat/completion"
+	baseURL := c.BaseURL + "/v1/chat/completions"
 	url, err := url.Parse(baseURL)
 	if err != nil {
 		log.Fatal(err)
@@ -80,7 +106,7 @@ func (c *Client) ChatCompletion(req ChatCompletionRequest) (*ChatCompletionRespo
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
 
-	httpReq.Header.Set("User-Agent", "ask-ai/0.0.3")
+	httpReq.Header.Set("User-Agent", userAgent)
 	httpReq.Header.Set("Content-Type", "application/json")
 	// If this is empty, it's fine (and probably the default)
 	httpReq.Header.Set("Authorization", "Bearer "+c.APIKey)
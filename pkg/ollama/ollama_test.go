@@ -2,7 +2,10 @@ package ollama
 
 import (
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -91,3 +94,257 @@ func TestMarshalUnmarshal(t *testing.T) {
 		t.Fatalf("Failed to unmarshal response: %v", err)
 	}
 }
+
+func TestChatCompletionEndpoint(t *testing.T) {
+	var path, agent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, agent = r.URL.Path, r.Header.Get("User-Agent")
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"content":"3"}}]}`))
+	}))
+	defer server.Close()
+
+	resp, err := NewClient(server.URL, "").ChatCompletion(ChatCompletionRequest{
+		Model:    TestModel,
+		Messages: []Message{{Role: "user", Content: "Respond with the number 3"}},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion failed (path %s): %v", path, err)
+	}
+	if len(resp.Choices) != 1 || resp.Choices[0].Message.Content != "3" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if agent != userAgent {
+		t.Errorf("User-Agent: got %q, want %q", agent, userAgent)
+	}
+}
+
+func TestNewClientBaseURL(t *testing.T) {
+	tests := map[string]string{
+		"localhost:11434":         "http://localhost:11434",
+		"http://localhost:11434/": "http://localhost:11434",
+		"https://ollama.example":  "https://ollama.example",
+		"0.0.0.0":                 "http://0.0.0.0:11434",
+		"[::1]":                   "http://[::1]:11434",
+		"ollama.lan/api-proxy":    "http://ollama.lan:11434/api-proxy",
+		"":                        "",
+	}
+	for in, expected := range tests {
+		if got := NewClient(in, "").BaseURL; got != expected {
+			t.Errorf("NewClient(%q).BaseURL: got %q, want %q", in, got, expected)
+		}
+	}
+}
+
+func TestChat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			http.NotFound(w, r)
+			return
+		}
+		var req ChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Model == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"model \"missing\" not found"}`))
+			return
+		}
+		if len(req.Tools) > 0 {
+			if req.Tools[0].Function.Name != "add" || req.Tools[0].Function.Parameters["type"] != "object" {
+				http.Error(w, "bad tools", http.StatusBadRequest)
+				return
+			}
+			lines := []string{
+				`{"model":"test","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"add","arguments":{"a":1,"b":2}}}]},"done":false}`,
+				`{"model":"test","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop"}`,
+			}
+			if !req.Stream {
+				lines = []string{`{"model":"test","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"add","arguments":{"a":1,"b":2}}}]},"done":true}`}
+			}
+			for _, line := range lines {
+				w.Write([]byte(line + "\n"))
+			}
+			return
+		}
+		if !req.Stream {
+			w.Write([]byte(`{"model":"test","message":{"role":"assistant","content":"3"},"done":true,"done_reason":"stop","prompt_eval_count":5,"eval_count":1,"total_duration":1000}`))
+			return
+		}
+		for _, line := range []string{
+			`{"model":"test","message":{"role":"assistant","content":"Th"},"done":false}`,
+			`{"model":"test","message":{"role":"assistant","content":"ree"},"done":false}`,
+			`{"model":"test","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":5,"eval_count":2}`,
+		} {
+			w.Write([]byte(line + "\n"))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "")
+	req := ChatRequest{
+		Model:    TestModel,
+		Messages: []Message{{Role: "user", Content: "Respond with the number 3"}},
+	}
+
+	resp, err := client.Chat(req, nil)
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	if resp.Message.Content != "3" || resp.DoneReason != "stop" || resp.PromptEvalCount != 5 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	req.Stream = true
+	var chunks []string
+	resp, err = client.Chat(req, func(chunk ChatResponse) error {
+		chunks = append(chunks, chunk.Message.Content)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("streaming Chat failed: %v", err)
+	}
+	if resp.Message.Content != "Three" || resp.EvalCount != 2 || len(chunks) != 3 {
+		t.Errorf("unexpected streamed response: %+v (chunks: %q)", resp, chunks)
+	}
+
+	// Tool calls, streamed or not
+	req.Tools = []Tool{{Type: "function", Function: ToolFunction{
+		Name:        "add",
+		Description: "Add two numbers",
+		Parameters:  map[string]any{"type": "object", "properties": map[string]any{"a": map[string]any{"type": "number"}}},
+	}}}
+	for _, stream := range []bool{false, true} {
+		req.Stream = stream
+		resp, err = client.Chat(req, nil)
+		if err != nil {
+			t.Fatalf("Chat with tools failed: %v", err)
+		}
+		if calls := resp.Message.ToolCalls; len(calls) != 1 || calls[0].Function.Name != "add" || calls[0].Function.Arguments["b"] != 2.0 {
+			t.Errorf("unexpected tool calls (stream: %v): %+v", stream, calls)
+		}
+	}
+	req.Tools = nil
+
+	req.Model = "missing"
+	if _, err := client.Chat(req, nil); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected a model not found error, got: %v", err)
+	}
+}
+
+func TestChatStreamCutShort(t *testing.T) {
+	// The server goes away part way through the answer
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"model":"test","message":{"role":"assistant","content":"Th"},"done":false}` + "\n"))
+		w.Write([]byte(`{"model":"test","message":{"role":"assistant","content":"ree"},"done":false}` + "\n"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "")
+	req := ChatRequest{
+		Model:    TestModel,
+		Messages: []Message{{Role: "user", Content: "Respond with the number 3"}},
+		Stream:   true,
+	}
+	var chunks int
+	resp, err := client.Chat(req, func(ChatResponse) error {
+		chunks++
+		return nil
+	})
+	if err == nil || err.Error() != "stream ended before the response was done" {
+		t.Errorf("expected the stream ending early to be an error, got: %v (response: %+v)", err, resp)
+	}
+	if chunks != 2 {
+		t.Errorf("expected the chunks before it ended to be passed on, got %d", chunks)
+	}
+}
+
+func TestListModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/api/tags" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"models":[{"name":"llama3.1:latest","model":"llama3.1:latest","size":4920753328,"details":{"parameter_size":"8.0B"}},{"name":"deepseek-r1:14b","model":"deepseek-r1:14b","size":8988112040}]}`))
+	}))
+	defer server.Close()
+
+	models, err := NewClient(server.URL, "").ListModels()
+	if err != nil {
+		t.Fatalf("ListModels failed: %v", err)
+	}
+	if len(models) != 2 || models[0].Name != "llama3.1:latest" || models[0].Details.ParameterSize != "8.0B" || models[1].Size != 8988112040 {
+		t.Errorf("unexpected models: %+v", models)
+	}
+}
+
+func TestShowModel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		if r.Method != "POST" || r.URL.Path != "/api/show" || json.NewDecoder(r.Body).Decode(&req) != nil || req.Model != "llama3.1" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"details":{"family":"llama","parameter_size":"8.0B"},"model_info":{"general.architecture":"llama","llama.context_length":131072},"capabilities":["completion","tools"]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "")
+	info, err := client.ShowModel("llama3.1")
+	if err != nil {
+		t.Fatalf("ShowModel failed: %v", err)
+	}
+	if got, want := info.ContextLength(), 131072; got != want {
+		t.Errorf("got: %d, want: %d", got, want)
+	}
+	if info.Details.ParameterSize != "8.0B" || len(info.Capabilities) != 2 {
+		t.Errorf("unexpected details: %+v", info)
+	}
+
+	if _, err := client.ShowModel("nope"); err == nil {
+		t.Errorf("expected an error for a model that isn't there")
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req EmbedRequest
+		if r.URL.Path != "/api/embed" || json.NewDecoder(r.Body).Decode(&req) != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if req.Model != "nomic-embed-text" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"model \"` + req.Model + `\" not found"}`))
+			return
+		}
+		// Short ones, but the same length for each
+		var embeddings []string
+		for i := range req.Input {
+			embeddings = append(embeddings, "["+strconv.Itoa(i)+",0.5]")
+		}
+		w.Write([]byte(`{"model":"nomic-embed-text","embeddings":[` + strings.Join(embeddings, ",") + `]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "")
+	embeddings, err := client.Embed("nomic-embed-text", []string{"chess", "go"})
+	if err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+	if len(embeddings) != 2 || embeddings[1][0] != 1 || embeddings[1][1] != 0.5 {
+		t.Errorf("unexpected embeddings: %v", embeddings)
+	}
+
+	_, err = client.Embed("llama3.1", []string{"chess"})
+	if err == nil || !strings.Contains(err.Error(), `model "llama3.1" not found`) {
+		t.Errorf("expected the server's error, got: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package output
+
+// Machine-readable output for scripts. With `--output json`, each answer is a
+// single JSON object. With `--output jsonl`, each answer is an object on a
+// line of its own and, when streaming, it's preceded by one event per chunk:
+//
+//	{"type":"reasoning","text":"Okay, the user wants..."}
+//	{"type":"chunk","text":"The Italian"}
+//	{"type":"chunk","text":" Game is"}
+//	{"type":"answer","text":"The Italian Game is...","model":"llama3.1",...}
+//
+// The fields of an answer are always present, even when empty, so scripts
+// don't need to check for them.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/duluk/ask-ollama/pkg/LLM"
+)
+
+type Format string
+
+const (
+	Text  Format = "text"
+	JSON  Format = "json"
+	JSONL Format = "jsonl"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case "", Text:
+		return Text, nil
+	case JSON, JSONL:
+		return Format(s), nil
+	}
+	return "", fmt.Errorf("unknown output format %q (expected text, json or jsonl)", s)
+}
+
+// Machine reports whether output is meant for a program rather than a person
+func (f Format) Machine() bool {
+	return f == JSON || f == JSONL
+}
+
+type Timings struct {
+	TotalMs      float64 `json:"total_ms"`
+	LoadMs       float64 `json:"load_ms"`
+	PromptEvalMs float64 `json:"prompt_eval_ms"`
+	EvalMs       float64 `json:"eval_ms"`
+}
+
+type Answer struct {
+	Text         string  `json:"text"`
+	Reasoning    string  `json:"reasoning"`
+	Model        string  `json:"model"`
+	ConvID       int     `json:"conv_id"`
+	InputTokens  int32   `json:"input_tokens"`
+	OutputTokens int32   `json:"output_tokens"`
+	Timings      Timings `json:"timings"`
+	FinishReason string  `json:"finish_reason"`
+	// Only there if the model called any
+	ToolCalls []LLM.ToolCall `json:"tool_calls,omitempty"`
+}
+
+type answerEvent struct {
+	Type string `json:"type"`
+	Answer
+}
+
+type chunkEvent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func NewAnswer(resp LLM.ClientResponse, convID int) Answer {
+	return Answer{
+		Text:         resp.Answer,
+		Reasoning:    resp.Reasoning,
+		Model:        resp.Model,
+		ConvID:       convID,
+		InputTokens:  resp.InputTokens,
+		OutputTokens: resp.OutputTokens,
+		Timings: Timings{
+			TotalMs:      ms(resp.Timings.Total),
+			LoadMs:       ms(resp.Timings.Load),
+			PromptEvalMs: ms(resp.Timings.PromptEval),
+			EvalMs:       ms(resp.Timings.Eval),
+		},
+		FinishReason: resp.FinishReason,
+		ToolCalls:    resp.ToolCalls,
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// WriteAnswer writes the answer in the given format; text isn't handled here
+func WriteAnswer(w io.Writer, format Format, answer Answer) error {
+	switch format {
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(answer)
+	case JSONL:
+		return json.NewEncoder(w).Encode(answerEvent{Type: "answer", Answer: answer})
+	}
+	return fmt.Errorf("can't write an answer as %q", format)
+}
+
+// ChunkWriter returns a function that writes each streamed chunk as a JSONL
+// event. Only jsonl has chunk events, so it returns nil for other formats.
+func ChunkWriter(w io.Writer, format Format) func(LLM.Chunk) error {
+	if format != JSONL {
+		return nil
+	}
+
+	enc := json.NewEncoder(w)
+	return func(chunk LLM.Chunk) error {
+		if chunk.Text == "" {
+			return nil
+		}
+		event := chunkEvent{Type: "chunk", Text: chunk.Text}
+		if chunk.Reasoning {
+			event.Type = "reasoning"
+		}
+		return enc.Encode(event)
+	}
+}
@@ -0,0 +1,71 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/duluk/ask-ollama/pkg/LLM"
+)
+
+func TestParseFormat(t *testing.T) {
+	for _, s := range []string{"", "text", "json", "jsonl"} {
+		_, err := ParseFormat(s)
+		assert.Nil(t, err)
+	}
+	_, err := ParseFormat("xml")
+	assert.NotNil(t, err)
+
+	assert.False(t, Text.Machine())
+	assert.True(t, JSON.Machine())
+	assert.True(t, JSONL.Machine())
+}
+
+func TestWriteAnswer(t *testing.T) {
+	resp := LLM.ClientResponse{
+		Text:         "<think>hmm</think>3",
+		Reasoning:    "hmm",
+		Answer:       "3",
+		Model:        "llama3.1",
+		FinishReason: "stop",
+		Timings:      LLM.Timings{Total: 1500 * time.Millisecond},
+		InputTokens:  12,
+		OutputTokens: 3,
+	}
+	answer := NewAnswer(resp, 42)
+
+	var buffer bytes.Buffer
+	assert.Nil(t, WriteAnswer(&buffer, JSON, answer))
+
+	var decoded map[string]any
+	assert.Nil(t, json.Unmarshal(buffer.Bytes(), &decoded))
+	assert.Equal(t, "3", decoded["text"])
+	assert.Equal(t, "hmm", decoded["reasoning"])
+	assert.Equal(t, float64(42), decoded["conv_id"])
+	assert.Equal(t, 1500.0, decoded["timings"].(map[string]any)["total_ms"])
+	for _, key := range []string{"model", "input_tokens", "output_tokens", "finish_reason"} {
+		assert.Contains(t, decoded, key)
+	}
+
+	buffer.Reset()
+	assert.Nil(t, WriteAnswer(&buffer, JSONL, answer))
+	assert.Equal(t, 1, strings.Count(buffer.String(), "\n"))
+	assert.True(t, strings.HasPrefix(buffer.String(), `{"type":"answer","text":"3",`))
+}
+
+func TestChunkWriter(t *testing.T) {
+	assert.Nil(t, ChunkWriter(nil, JSON))
+
+	var buffer bytes.Buffer
+	write := ChunkWriter(&buffer, JSONL)
+	write(LLM.Chunk{Text: "hmm", Reasoning: true})
+	write(LLM.Chunk{Text: ""})
+	write(LLM.Chunk{Text: "Three"})
+
+	expected := `{"type":"reasoning","text":"hmm"}` + "\n" + `{"type":"chunk","text":"Three"}` + "\n"
+	assert.Equal(t, expected, buffer.String())
+}
@@ -0,0 +1,125 @@
+package pager
+
+// Collects output that would otherwise scroll off the screen and, once it's
+// complete, shows it with a pager if it's taller than the terminal. Output
+// that fits, or that isn't going to a terminal, is written out as-is.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const DefaultCommand = "less -R"
+
+type Pager struct {
+	out     io.Writer
+	command string
+	height  int
+	enabled bool
+
+	buffer bytes.Buffer
+}
+
+// New returns a Pager writing to out. Paging only happens when enabled is set
+// and out is a terminal; the command is what's configured, falling back to
+// $PAGER and then `less -R` when it's empty.
+func New(out *os.File, command string, height int, enabled bool) *Pager {
+	return &Pager{
+		out:     out,
+		command: Command(command),
+		height:  height,
+		enabled: enabled && term.IsTerminal(int(out.Fd())),
+	}
+}
+
+func Command(configured string) string {
+	if configured != "" {
+		return configured
+	}
+	if env := os.Getenv("PAGER"); env != "" {
+		return env
+	}
+	return DefaultCommand
+}
+
+// Write buffers everything if we might page it, or passes it straight
+// through if we won't.
+func (p *Pager) Write(data []byte) (int, error) {
+	if !p.enabled {
+		return p.out.Write(data)
+	}
+	return p.buffer.Write(data)
+}
+
+// Close shows what was written, through the pager if it's too tall for the
+// screen. If the pager can't be run, the output is printed directly instead
+// so nothing is lost.
+func (p *Pager) Close() error {
+	if !p.enabled || p.buffer.Len() == 0 {
+		return nil
+	}
+	defer p.buffer.Reset()
+
+	if !NeedsPaging(p.buffer.Bytes(), p.height) {
+		_, err := p.out.Write(p.buffer.Bytes())
+		return err
+	}
+
+	if err := p.run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error running pager (%s): %v\n", p.command, err)
+		_, err = p.out.Write(p.buffer.Bytes())
+		return err
+	}
+	return nil
+}
+
+func (p *Pager) run() error {
+	cmd := exec.Command("sh", "-c", p.command)
+	cmd.Stdin = bytes.NewReader(p.buffer.Bytes())
+	cmd.Stdout = p.out
+	cmd.Stderr = os.Stderr
+	// Same as git: unless the user has their own preferences, have less
+	// pass colors through (R), quit if it all fits after all (F) and leave
+	// the text on the screen when it exits (X)
+	if os.Getenv("LESS") == "" {
+		cmd.Env = append(os.Environ(), "LESS=FRX")
+	}
+
+	// The pager needs the terminal, so a failure to start is the only error
+	// we can do anything about. Quitting before reading everything gives a
+	// broken pipe, which is fine.
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if err := cmd.Wait(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// NeedsPaging reports whether output is taller than the screen. The last
+// line of the screen is left for the prompt.
+func NeedsPaging(output []byte, height int) bool {
+	if height <= 0 {
+		return false
+	}
+	lines := bytes.Count(output, []byte("\n"))
+	if len(output) > 0 && !bytes.HasSuffix(output, []byte("\n")) {
+		lines++
+	}
+	return lines > height-1
+}
+
+// Enabled returns whether paging is wanted given the --no-pager flag and the
+// config; it's a separate question from whether output is a terminal.
+func Enabled(noPagerFlag, noPagerConfig bool, command string) bool {
+	return !noPagerFlag && !noPagerConfig && strings.TrimSpace(command) != "cat"
+}
@@ -0,0 +1,52 @@
+package pager
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNeedsPaging(t *testing.T) {
+	assert.False(t, NeedsPaging([]byte("one\ntwo\n"), 24))
+	assert.False(t, NeedsPaging([]byte(strings.Repeat("x\n", 23)), 24))
+	assert.True(t, NeedsPaging([]byte(strings.Repeat("x\n", 24)), 24))
+	// A last line without a newline still counts
+	assert.True(t, NeedsPaging([]byte(strings.Repeat("x\n", 23)+"x"), 24))
+	assert.False(t, NeedsPaging([]byte(strings.Repeat("x\n", 100)), 0))
+}
+
+func TestCommand(t *testing.T) {
+	t.Setenv("PAGER", "")
+	assert.Equal(t, DefaultCommand, Command(""))
+	assert.Equal(t, "more", Command("more"))
+
+	t.Setenv("PAGER", "most")
+	assert.Equal(t, "most", Command(""))
+	assert.Equal(t, "more", Command("more"))
+}
+
+func TestEnabled(t *testing.T) {
+	assert.True(t, Enabled(false, false, "less -R"))
+	assert.False(t, Enabled(true, false, "less -R"))
+	assert.False(t, Enabled(false, true, "less -R"))
+	assert.False(t, Enabled(false, false, "cat"))
+}
+
+func TestPagerNotATerminal(t *testing.T) {
+	out, err := os.CreateTemp("", "pager_out")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	// Output to a file is never paged, and it goes straight through
+	p := New(out, "false", 2, true)
+	p.Write([]byte(strings.Repeat("line\n", 10)))
+	assert.Nil(t, p.Close())
+
+	data, _ := os.ReadFile(out.Name())
+	assert.Equal(t, strings.Repeat("line\n", 10), string(data))
+}
@@ -0,0 +1,105 @@
+// Package rag answers questions about a directory of documents: its files
+// are split into chunks, each chunk is embedded, and the chunks closest to
+// a prompt are sent along with it, marked with where they came from so the
+// model can cite them.
+package rag
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultChunkSize is about how many bytes go in a chunk. Small enough that
+// a few of them fit in a prompt alongside the question; big enough that each
+// makes sense by itself.
+const DefaultChunkSize = 1500
+
+// Chunk is a run of lines from a file
+type Chunk struct {
+	Path string
+	// Lines are numbered from 1, and End is the last line in it
+	Start, End int
+	Text       string
+}
+
+// Cite is where a chunk came from, as path:start-end
+func (c Chunk) Cite() string {
+	if c.Start == c.End {
+		return fmt.Sprintf("%s:%d", c.Path, c.Start)
+	}
+	return fmt.Sprintf("%s:%d-%d", c.Path, c.Start, c.End)
+}
+
+// Split cuts a file into chunks of about size bytes, on line boundaries.
+// Where it can, a chunk ends before a markdown heading or after a blank
+// line, so paragraphs and functions stay together.
+func Split(path, content string, size int) []Chunk {
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var chunks []Chunk
+	add := func(start, end int) {
+		text := strings.Join(lines[start:end], "")
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		chunks = append(chunks, Chunk{Path: path, Start: start + 1, End: end, Text: text})
+	}
+
+	start, length := 0, 0
+	for i, line := range lines {
+		if length > 0 && length+len(line) > size {
+			end := breakPoint(lines, start, i)
+			add(start, end)
+			start = end
+			length = 0
+			for _, l := range lines[start:i] {
+				length += len(l)
+			}
+		}
+		length += len(line)
+	}
+	add(start, len(lines))
+	return chunks
+}
+
+// breakPoint is where to end a chunk that would otherwise end just before
+// line end: before the last heading or after the last blank line in its
+// second half, or right there if there isn't one
+func breakPoint(lines []string, start, end int) int {
+	for i := end - 1; i > start+(end-start)/2; i-- {
+		if strings.HasPrefix(lines[i], "#") {
+			return i
+		}
+		if strings.TrimSpace(lines[i]) == "" {
+			return i + 1
+		}
+	}
+	return end
+}
+
+// BuildPrompt appends the chunks found for a prompt to it, each headed by
+// where it came from, and asks the model to cite them
+func BuildPrompt(prompt string, results []Result) string {
+	if len(results) == 0 {
+		return prompt
+	}
+
+	var sb strings.Builder
+	sb.WriteString(prompt)
+	sb.WriteString("\n\nThese excerpts may help with that. When you use one, cite it by its path and lines (eg docs/setup.md:12-30).\n")
+	for _, r := range results {
+		fmt.Fprintf(&sb, "\n--- BEGIN EXCERPT: %s ---\n", r.Cite())
+		sb.WriteString(r.Text)
+		if !strings.HasSuffix(r.Text, "\n") {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "--- END EXCERPT: %s ---\n", r.Cite())
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
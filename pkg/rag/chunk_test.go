@@ -0,0 +1,82 @@
+package rag
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplit(t *testing.T) {
+	t.Run("small file is one chunk", func(t *testing.T) {
+		chunks := Split("notes.txt", "one\ntwo\n", 100)
+		assert.Equal(t, []Chunk{{Path: "notes.txt", Start: 1, End: 2, Text: "one\ntwo\n"}}, chunks)
+		assert.Equal(t, "notes.txt:1-2", chunks[0].Cite())
+	})
+
+	t.Run("empty file has none", func(t *testing.T) {
+		assert.Empty(t, Split("empty.txt", "", 100))
+		assert.Empty(t, Split("blank.txt", "\n\n  \n", 100))
+	})
+
+	t.Run("breaks before headings", func(t *testing.T) {
+		content := "# Setup\n" + strings.Repeat("install it\n", 4) + "## Usage\n" + strings.Repeat("run it\n", 3)
+		chunks := Split("README.md", content, 70)
+		assert.Len(t, chunks, 2)
+		assert.Equal(t, 1, chunks[0].Start)
+		assert.Equal(t, 5, chunks[0].End)
+		assert.True(t, strings.HasPrefix(chunks[1].Text, "## Usage\n"))
+		assert.Equal(t, "README.md:6-9", chunks[1].Cite())
+	})
+
+	t.Run("breaks after blank lines", func(t *testing.T) {
+		content := "func a() {\n\treturn\n}\n\nfunc b() {\n\treturn\n}\n"
+		chunks := Split("a.go", content, 30)
+		assert.Equal(t, "func a() {\n\treturn\n}\n\n", chunks[0].Text)
+		assert.Equal(t, "func b() {\n\treturn\n}\n", chunks[1].Text)
+	})
+
+	t.Run("covers every line", func(t *testing.T) {
+		var lines []string
+		for i := 0; i < 200; i++ {
+			lines = append(lines, strings.Repeat("word ", i%13))
+		}
+		content := strings.Join(lines, "\n") + "\n"
+		chunks := Split("long.txt", content, 100)
+		var joined strings.Builder
+		for i, chunk := range chunks {
+			if i > 0 {
+				assert.Equal(t, chunks[i-1].End+1, chunk.Start)
+			}
+			joined.WriteString(chunk.Text)
+		}
+		assert.Equal(t, content, joined.String())
+	})
+
+	t.Run("long line is a chunk by itself", func(t *testing.T) {
+		chunks := Split("min.js", "short\n"+strings.Repeat("x", 300)+"\nshort\n", 100)
+		assert.Len(t, chunks, 3)
+		assert.Equal(t, "min.js:2", chunks[1].Cite())
+	})
+}
+
+func TestBuildPrompt(t *testing.T) {
+	assert.Equal(t, "hi", BuildPrompt("hi", nil))
+
+	prompt := BuildPrompt("How do I install it?", []Result{
+		{Chunk: Chunk{Path: "docs/setup.md", Start: 3, End: 4, Text: "Run make.\nThen make install.\n"}},
+		{Chunk: Chunk{Path: "README.md", Start: 10, End: 10, Text: "See docs/setup.md"}},
+	})
+	assert.Equal(t, `How do I install it?
+
+These excerpts may help with that. When you use one, cite it by its path and lines (eg docs/setup.md:12-30).
+
+--- BEGIN EXCERPT: docs/setup.md:3-4 ---
+Run make.
+Then make install.
+--- END EXCERPT: docs/setup.md:3-4 ---
+
+--- BEGIN EXCERPT: README.md:10 ---
+See docs/setup.md
+--- END EXCERPT: README.md:10 ---`, prompt)
+}
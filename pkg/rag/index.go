@@ -0,0 +1,360 @@
+package rag
+
+// The index is a SQLite database of its own, next to the chat database:
+// the files that have been indexed (with what they were like then, so only
+// the ones that have changed are indexed again) and their chunks, each with
+// its embedding.
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/duluk/ask-ollama/pkg/attachments"
+	"github.com/duluk/ask-ollama/pkg/database"
+)
+
+const indexSchema = `
+	CREATE TABLE IF NOT EXISTS files (
+		path TEXT PRIMARY KEY,
+		mtime INTEGER NOT NULL,
+		size INTEGER NOT NULL,
+		hash TEXT NOT NULL,
+		model_name TEXT NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS chunks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		path TEXT NOT NULL,
+		start_line INTEGER NOT NULL,
+		end_line INTEGER NOT NULL,
+		text TEXT NOT NULL,
+		dimensions INTEGER NOT NULL,
+		vector BLOB NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS chunks_path ON chunks (path);
+`
+
+// Directories that are never worth indexing, besides hidden ones
+var skipDirs = map[string]bool{"node_modules": true, "vendor": true}
+
+// Embedder embeds texts, returning a vector for each
+type Embedder func(texts []string) ([][]float32, error)
+
+// Chunks sent to be embedded at a time
+const embedBatch = 32
+
+type Index struct {
+	db *sql.DB
+	// The embedding model, which has to be the same for indexing and
+	// searching
+	Model string
+	Embed Embedder
+	// About how big chunks are, and the biggest file that's indexed
+	ChunkSize   int
+	MaxFileSize int64
+}
+
+// Open opens the index at path, creating it if it isn't there
+func Open(path, model string, embed Embedder) (*Index, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("error creating index directory: %v", err)
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening index: %v", err)
+	}
+	if _, err := db.Exec(indexSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error opening index: %v", err)
+	}
+	return &Index{db: db, Model: model, Embed: embed, ChunkSize: DefaultChunkSize, MaxFileSize: attachments.DefaultMaxSize}, nil
+}
+
+func (idx *Index) Close() error {
+	return idx.db.Close()
+}
+
+// Stats is what Update did
+type Stats struct {
+	Added, Updated, Unchanged, Removed int
+	// Chunks embedded
+	Chunks int
+	// Text files that weren't indexed, and why
+	Skipped []attachments.Skipped
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%d added, %d updated, %d unchanged, %d removed (%d chunks embedded)",
+		s.Added, s.Updated, s.Unchanged, s.Removed, s.Chunks)
+}
+
+type fileState struct {
+	mtime int64
+	size  int64
+	hash  string
+	model string
+}
+
+// Update indexes the files under root that are new or have changed since
+// they were last indexed, and forgets the ones that have gone. A file is
+// only read if its modification time or size has changed, and only
+// embedded again if its contents (or the model) have.
+func (idx *Index) Update(root string) (Stats, error) {
+	var stats Stats
+	root, err := absRoot(root)
+	if err != nil {
+		return stats, err
+	}
+
+	known, err := idx.files(root)
+	if err != nil {
+		return stats, err
+	}
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(d.Name(), ".") || skipDirs[d.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+
+		old, indexed := known[path]
+		delete(known, path)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > idx.MaxFileSize {
+			stats.Skipped = append(stats.Skipped, attachments.Skipped{
+				Path:   path,
+				Reason: fmt.Sprintf("too large (%d bytes, limit is %d)", info.Size(), idx.MaxFileSize),
+			})
+			if indexed {
+				stats.Removed++
+				return idx.remove(path)
+			}
+			return nil
+		}
+		state := fileState{mtime: info.ModTime().UnixNano(), size: info.Size(), model: idx.Model}
+		if indexed && old.mtime == state.mtime && old.size == state.size && old.model == state.model {
+			stats.Unchanged++
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		state.hash = attachments.Hash(data)
+		if indexed && old.hash == state.hash && old.model == state.model {
+			// Touched, but not changed
+			stats.Unchanged++
+			return idx.saveFile(path, state)
+		}
+		if attachments.IsBinary(data) {
+			// Images and the like are expected in a docs directory, so
+			// they're left out quietly. They're kept as files with no
+			// chunks, so they aren't read again next time.
+			_, err := idx.indexFile(path, "", state)
+			return err
+		}
+
+		n, err := idx.indexFile(path, string(data), state)
+		if err != nil {
+			return err
+		}
+		stats.Chunks += n
+		if indexed {
+			stats.Updated++
+		} else {
+			stats.Added++
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("error indexing %s: %v", root, err)
+	}
+
+	// Whatever wasn't found this time has gone
+	for path := range known {
+		if err := idx.remove(path); err != nil {
+			return stats, err
+		}
+		stats.Removed++
+	}
+	return stats, nil
+}
+
+// Indexed says whether anything under root has been indexed
+func (idx *Index) Indexed(root string) (bool, error) {
+	root, err := absRoot(root)
+	if err != nil {
+		return false, err
+	}
+	files, err := idx.files(root)
+	return len(files) > 0, err
+}
+
+// Result is a chunk found by Search, and how close it is to what was
+// searched for (up to 1)
+type Result struct {
+	Chunk
+	Score float64
+}
+
+// Search returns the k chunks from under root closest to query (which has
+// to be embedded by the same model)
+func (idx *Index) Search(root string, query []float32, k int) ([]Result, error) {
+	root, err := absRoot(root)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := idx.db.Query(`
+		SELECT c.path, c.start_line, c.end_line, c.text, c.vector
+		FROM chunks c JOIN files f ON f.path = c.path
+		WHERE f.model_name = ? AND c.dimensions = ? AND (c.path = ? OR c.path LIKE ? ESCAPE '\');
+	`, idx.Model, len(query), root, underRoot(root))
+	if err != nil {
+		return nil, fmt.Errorf("error searching index: %v", err)
+	}
+	defer rows.Close()
+
+	var results []Result
+	for rows.Next() {
+		var r Result
+		var blob []byte
+		if err := rows.Scan(&r.Path, &r.Start, &r.End, &r.Text, &blob); err != nil {
+			return nil, fmt.Errorf("error searching index: %v", err)
+		}
+		r.Score = database.Cosine(query, database.DecodeVector(blob))
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error searching index: %v", err)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if k > 0 && len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// files is what's known about the files indexed under root
+func (idx *Index) files(root string) (map[string]fileState, error) {
+	rows, err := idx.db.Query(`
+		SELECT path, mtime, size, hash, model_name FROM files WHERE path = ? OR path LIKE ? ESCAPE '\';
+	`, root, underRoot(root))
+	if err != nil {
+		return nil, fmt.Errorf("error reading index: %v", err)
+	}
+	defer rows.Close()
+
+	files := make(map[string]fileState)
+	for rows.Next() {
+		var path string
+		var state fileState
+		if err := rows.Scan(&path, &state.mtime, &state.size, &state.hash, &state.model); err != nil {
+			return nil, fmt.Errorf("error reading index: %v", err)
+		}
+		files[path] = state
+	}
+	return files, rows.Err()
+}
+
+// indexFile chunks and embeds a file, replacing whatever was indexed for it
+// before, and says how many chunks it has
+func (idx *Index) indexFile(path, content string, state fileState) (int, error) {
+	chunks := Split(path, content, idx.ChunkSize)
+	vectors := make([][]float32, 0, len(chunks))
+	for start := 0; start < len(chunks); start += embedBatch {
+		end := min(start+embedBatch, len(chunks))
+		texts := make([]string, 0, end-start)
+		for _, chunk := range chunks[start:end] {
+			// The path helps place it
+			texts = append(texts, chunk.Cite()+"\n"+chunk.Text)
+		}
+		batch, err := idx.Embed(texts)
+		if err != nil {
+			return 0, err
+		}
+		vectors = append(vectors, batch...)
+	}
+
+	tx, err := idx.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM chunks WHERE path = ?;`, path); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	for i, chunk := range chunks {
+		_, err := tx.Exec(`
+			INSERT INTO chunks (path, start_line, end_line, text, dimensions, vector)
+			VALUES (?, ?, ?, ?, ?, ?);
+		`, path, chunk.Start, chunk.End, chunk.Text, len(vectors[i]), database.EncodeVector(vectors[i]))
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	if err := saveFile(tx, path, state); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return len(chunks), tx.Commit()
+}
+
+func (idx *Index) saveFile(path string, state fileState) error {
+	return saveFile(idx.db, path, state)
+}
+
+func saveFile(db interface {
+	Exec(string, ...any) (sql.Result, error)
+}, path string, state fileState) error {
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO files (path, mtime, size, hash, model_name) VALUES (?, ?, ?, ?, ?);
+	`, path, state.mtime, state.size, state.hash, state.model)
+	return err
+}
+
+func (idx *Index) remove(path string) error {
+	if _, err := idx.db.Exec(`DELETE FROM chunks WHERE path = ?; DELETE FROM files WHERE path = ?;`, path, path); err != nil {
+		return fmt.Errorf("error removing %s from index: %v", path, err)
+	}
+	return nil
+}
+
+// absRoot is root as it's kept in the index: absolute, with no symlinks
+func absRoot(root string) (string, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	abs, err = filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", fmt.Errorf("can't index %s: %v", root, err)
+	}
+	return abs, nil
+}
+
+// underRoot is a LIKE pattern for the paths under root
+func underRoot(root string) string {
+	root = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(root)
+	return strings.TrimSuffix(root, string(filepath.Separator)) + string(filepath.Separator) + "%"
+}
@@ -0,0 +1,180 @@
+package rag
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeEmbedder embeds a text as how often it uses each of a few words, and
+// remembers how many texts it was asked to embed
+type fakeEmbedder struct {
+	texts int
+}
+
+var vocabulary = []string{"install", "usage", "license", "config"}
+
+func (f *fakeEmbedder) embed(texts []string) ([][]float32, error) {
+	f.texts += len(texts)
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = vector(text)
+	}
+	return vectors, nil
+}
+
+func vector(text string) []float32 {
+	v := make([]float32, len(vocabulary))
+	for i, word := range vocabulary {
+		v[i] = float32(strings.Count(strings.ToLower(text), word))
+	}
+	return v
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	dir := t.TempDir()
+	docs := filepath.Join(dir, "docs")
+	writeFile(t, filepath.Join(docs, "install.md"), "# Install\n\nTo install it, run make install.\n")
+	writeFile(t, filepath.Join(docs, "usage.md"), "# Usage\n\nUsage is simple: see the config.\n")
+	writeFile(t, filepath.Join(docs, "guide", "license.txt"), "MIT license\n")
+	writeFile(t, filepath.Join(docs, "logo.png"), "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	writeFile(t, filepath.Join(docs, ".git", "config"), "[core]\n")
+	writeFile(t, filepath.Join(docs, "node_modules", "x", "README.md"), "install me\n")
+	writeFile(t, filepath.Join(docs, "big.txt"), strings.Repeat("install\n", 100))
+	writeFile(t, filepath.Join(dir, "other", "config.md"), "config config\n")
+
+	embedder := &fakeEmbedder{}
+	idx, err := Open(filepath.Join(dir, "data", "index.db"), "embedder", embedder.embed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	idx.MaxFileSize = 500
+
+	indexed, err := idx.Indexed(docs)
+	assert.Nil(t, err)
+	assert.False(t, indexed)
+
+	stats, err := idx.Update(docs)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, stats.Added)
+	assert.Equal(t, 3, stats.Chunks)
+	assert.Equal(t, 3, embedder.texts)
+	assert.Len(t, stats.Skipped, 1)
+	assert.Equal(t, filepath.Join(docs, "big.txt"), stats.Skipped[0].Path)
+
+	indexed, err = idx.Indexed(docs)
+	assert.Nil(t, err)
+	assert.True(t, indexed)
+
+	results, err := idx.Search(docs, vector("how do I install it"), 2)
+	assert.Nil(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, filepath.Join(docs, "install.md")+":1-3", results[0].Cite())
+	assert.InDelta(t, 1, results[0].Score, 0.0001)
+
+	// Only what's under the root is searched
+	_, err = idx.Update(filepath.Join(dir, "other"))
+	assert.Nil(t, err)
+	results, err = idx.Search(docs, vector("config"), 5)
+	assert.Nil(t, err)
+	for _, r := range results {
+		assert.True(t, strings.HasPrefix(r.Path, docs+string(filepath.Separator)), r.Path)
+	}
+	results, err = idx.Search(filepath.Join(docs, "guide"), vector("license"), 5)
+	assert.Nil(t, err)
+	assert.Len(t, results, 1)
+
+	t.Run("nothing changed", func(t *testing.T) {
+		embedder.texts = 0
+		stats, err := idx.Update(docs)
+		assert.Nil(t, err)
+		assert.Equal(t, 4, stats.Unchanged)
+		assert.Equal(t, 0, stats.Added+stats.Updated+stats.Removed)
+		assert.Equal(t, 0, embedder.texts)
+	})
+
+	t.Run("touched but not changed", func(t *testing.T) {
+		later := time.Now().Add(time.Hour)
+		assert.Nil(t, os.Chtimes(filepath.Join(docs, "usage.md"), later, later))
+		embedder.texts = 0
+		stats, err := idx.Update(docs)
+		assert.Nil(t, err)
+		assert.Equal(t, 4, stats.Unchanged)
+		assert.Equal(t, 0, embedder.texts)
+	})
+
+	t.Run("changed and removed", func(t *testing.T) {
+		writeFile(t, filepath.Join(docs, "usage.md"), "# Usage\n\nSee the license.\n")
+		assert.Nil(t, os.Remove(filepath.Join(docs, "install.md")))
+		embedder.texts = 0
+		stats, err := idx.Update(docs)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, stats.Updated)
+		assert.Equal(t, 1, stats.Removed)
+		assert.Equal(t, 1, embedder.texts)
+
+		results, err := idx.Search(docs, vector("install"), 5)
+		assert.Nil(t, err)
+		for _, r := range results {
+			assert.NotContains(t, r.Path, "install.md")
+		}
+	})
+
+	t.Run("another model embeds everything again", func(t *testing.T) {
+		idx.Model = "other-embedder"
+		results, err := idx.Search(docs, vector("license"), 5)
+		assert.Nil(t, err)
+		assert.Empty(t, results)
+
+		embedder.texts = 0
+		stats, err := idx.Update(docs)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, stats.Updated)
+		assert.Equal(t, 2, embedder.texts)
+	})
+}
+
+func TestIndexRootWithWildcards(t *testing.T) {
+	// "_" and "%" are LIKE wildcards, and have to match only themselves
+	dir := t.TempDir()
+	docs := filepath.Join(dir, "my_docs%")
+	writeFile(t, filepath.Join(docs, "install.md"), "To install it, run make install.\n")
+	writeFile(t, filepath.Join(dir, "myxdocsx", "license.txt"), "MIT license\n")
+
+	embedder := &fakeEmbedder{}
+	idx, err := Open(filepath.Join(dir, "index.db"), "embedder", embedder.embed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	for _, root := range []string{docs, filepath.Join(dir, "myxdocsx")} {
+		stats, err := idx.Update(root)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, stats.Added)
+	}
+
+	stats, err := idx.Update(docs)
+	assert.Nil(t, err)
+	assert.Equal(t, Stats{Unchanged: 1}, stats)
+
+	results, err := idx.Search(docs, vector("install"), 5)
+	assert.Nil(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, filepath.Join(docs, "install.md"), results[0].Path)
+}
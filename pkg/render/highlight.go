@@ -0,0 +1,420 @@
+package render
+
+// Syntax highlighting for fenced code blocks. This isn't a real parser for any
+// of these languages; it's a simple lexer that knows enough about comments,
+// strings, numbers and keywords to make code easier to read in the terminal.
+// Lines are highlighted one at a time (the renderer gets them that way), so
+// the only state carried between lines is whether we're in the middle of a
+// block comment or a multi-line string.
+
+import (
+	"strings"
+)
+
+type tokenType int
+
+const (
+	tokenPlain tokenType = iota
+	tokenKeyword
+	tokenTypeName
+	tokenConstant
+	tokenString
+	tokenNumber
+	tokenComment
+	tokenKey
+	tokenVariable
+)
+
+type language struct {
+	keywords  []string
+	types     []string
+	constants []string
+	// Comment markers; "#" in shell only counts at the start of a word
+	lineComments []string
+	blockComment [2]string
+	// Characters that open a single-line string
+	quotes string
+	// Delimiters of strings that may span lines (Go raw strings, Python
+	// triple quotes)
+	multilineStrings []string
+	// Quote characters where a backslash doesn't escape anything
+	rawQuotes string
+	// SQL keywords are case-insensitive
+	ignoreCase bool
+	// JSON and YAML mapping keys get their own color
+	keys bool
+	// $VAR and ${VAR} in shell
+	variables bool
+	// Characters (besides letters, digits and _) allowed in identifiers
+	identChars string
+
+	lookup map[string]tokenType
+}
+
+var languages = map[string]*language{}
+
+func init() {
+	golang := &language{
+		keywords: strings.Fields(`break case chan const continue default defer else fallthrough
+			for func go goto if import interface map package range return select struct switch type var`),
+		types: strings.Fields(`any bool byte comparable complex64 complex128 error float32 float64
+			int int8 int16 int32 int64 rune string uint uint8 uint16 uint32 uint64 uintptr`),
+		constants: strings.Fields(`true false nil iota append cap clear close complex copy delete imag
+			len make max min new panic print println real recover`),
+		lineComments:     []string{"//"},
+		blockComment:     [2]string{"/*", "*/"},
+		quotes:           `"'`,
+		multilineStrings: []string{"`"},
+		rawQuotes:        "`",
+	}
+	python := &language{
+		keywords: strings.Fields(`and as assert async await break class continue def del elif else
+			except finally for from global if import in is lambda nonlocal not or pass raise return
+			try while with yield match case`),
+		types:            strings.Fields(`bool bytes dict float frozenset int list object set str tuple type`),
+		constants:        strings.Fields(`True False None self cls print len range isinstance super`),
+		lineComments:     []string{"#"},
+		quotes:           `"'`,
+		multilineStrings: []string{`"""`, `'''`},
+	}
+	shell := &language{
+		keywords: strings.Fields(`if then else elif fi for while until do done case esac in function
+			return local export readonly declare select time`),
+		constants: strings.Fields(`echo cd exit set unset source alias eval exec printf read shift
+			test trap true false`),
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		rawQuotes:    `'`,
+		variables:    true,
+		identChars:   "-",
+	}
+	yaml := &language{
+		constants:    strings.Fields(`true false yes no on off null ~`),
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		rawQuotes:    `'`,
+		keys:         true,
+		identChars:   "-.",
+	}
+	json := &language{
+		constants: strings.Fields(`true false null`),
+		quotes:    `"`,
+		keys:      true,
+	}
+	sql := &language{
+		keywords: strings.Fields(`add all alter and as asc begin between by case check column commit
+			constraint create cross default delete desc distinct drop else end exists foreign from
+			full group having if in index inner insert intersect into is join key left like limit
+			not null offset on or order outer pragma primary references replace returning right
+			rollback select set table then transaction trigger union unique update using values
+			view when where with`),
+		types: strings.Fields(`bigint blob boolean char date datetime decimal double float integer
+			int numeric real smallint text timestamp varchar`),
+		constants:    strings.Fields(`true false current_timestamp count sum avg min max coalesce`),
+		lineComments: []string{"--"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `'"`,
+		rawQuotes:    `'"`,
+		ignoreCase:   true,
+	}
+
+	register(golang, "go", "golang")
+	register(python, "python", "py", "python3")
+	register(shell, "sh", "bash", "shell", "zsh", "console", "shell-session")
+	register(yaml, "yaml", "yml")
+	register(json, "json", "jsonc")
+	register(sql, "sql", "sqlite", "postgresql", "postgres", "mysql")
+}
+
+func register(lang *language, names ...string) {
+	lang.lookup = make(map[string]tokenType)
+	for _, words := range []struct {
+		list []string
+		tt   tokenType
+	}{{lang.keywords, tokenKeyword}, {lang.types, tokenTypeName}, {lang.constants, tokenConstant}} {
+		for _, word := range words.list {
+			lang.lookup[word] = words.tt
+		}
+	}
+	for _, name := range names {
+		languages[name] = lang
+	}
+}
+
+type highlighter struct {
+	lang  *language
+	theme Theme
+
+	inComment bool
+	// The delimiter of the multi-line string we're in, if any
+	inString string
+}
+
+// newHighlighter returns nil if the language isn't one we know about
+func newHighlighter(lang string, theme Theme) *highlighter {
+	l, ok := languages[strings.ToLower(lang)]
+	if !ok {
+		return nil
+	}
+	return &highlighter{lang: l, theme: theme}
+}
+
+func (h *highlighter) line(line string) string {
+	var sb strings.Builder
+	lang := h.lang
+	i := 0
+
+	emit := func(tt tokenType, text string) {
+		sb.WriteString(h.theme.paint(tt, text))
+	}
+
+	// Pick up where the previous line left off
+	if h.inComment {
+		end := strings.Index(line, lang.blockComment[1])
+		if end < 0 {
+			emit(tokenComment, line)
+			return sb.String()
+		}
+		i = end + len(lang.blockComment[1])
+		emit(tokenComment, line[:i])
+		h.inComment = false
+	} else if h.inString != "" {
+		end := strings.Index(line, h.inString)
+		if end < 0 {
+			emit(tokenString, line)
+			return sb.String()
+		}
+		i = end + len(h.inString)
+		emit(tokenString, line[:i])
+		h.inString = ""
+	}
+
+	if lang.keys && i == 0 {
+		i = h.yamlKey(line, emit)
+	}
+
+	plainStart := i
+	flushPlain := func(end int) {
+		if end > plainStart {
+			sb.WriteString(line[plainStart:end])
+		}
+	}
+
+	for i < len(line) {
+		rest := line[i:]
+		c := line[i]
+
+		if lang.lineCommentAt(line, i) {
+			flushPlain(i)
+			emit(tokenComment, rest)
+			return sb.String()
+		}
+
+		if lang.blockComment[0] != "" && strings.HasPrefix(rest, lang.blockComment[0]) {
+			flushPlain(i)
+			open := len(lang.blockComment[0])
+			end := strings.Index(rest[open:], lang.blockComment[1])
+			if end < 0 {
+				emit(tokenComment, rest)
+				h.inComment = true
+				return sb.String()
+			}
+			n := open + end + len(lang.blockComment[1])
+			emit(tokenComment, rest[:n])
+			i += n
+			plainStart = i
+			continue
+		}
+
+		if delim := lang.multilineAt(rest); delim != "" {
+			flushPlain(i)
+			end := strings.Index(rest[len(delim):], delim)
+			if end < 0 {
+				emit(tokenString, rest)
+				h.inString = delim
+				return sb.String()
+			}
+			n := len(delim) + end + len(delim)
+			emit(tokenString, rest[:n])
+			i += n
+			plainStart = i
+			continue
+		}
+
+		if strings.IndexByte(lang.quotes, c) >= 0 {
+			flushPlain(i)
+			n := lang.scanString(rest)
+			tt := tokenString
+			if lang.keys && strings.HasPrefix(strings.TrimLeft(rest[n:], " \t"), ":") {
+				tt = tokenKey
+			}
+			emit(tt, rest[:n])
+			i += n
+			plainStart = i
+			continue
+		}
+
+		if lang.variables && c == '$' && i+1 < len(line) {
+			if n := scanVariable(rest); n > 1 {
+				flushPlain(i)
+				emit(tokenVariable, rest[:n])
+				i += n
+				plainStart = i
+				continue
+			}
+		}
+
+		wordStart := i == 0 || !lang.isIdent(line[i-1])
+		if wordStart && (isDigit(c) || c == '-' && i+1 < len(line) && isDigit(line[i+1]) && !lang.keys) {
+			n := scanNumber(rest)
+			if n < len(rest) && lang.isIdent(rest[n]) {
+				// Something like 3d6 or 1password; not a number
+				i += n
+				continue
+			}
+			flushPlain(i)
+			emit(tokenNumber, rest[:n])
+			i += n
+			plainStart = i
+			continue
+		}
+
+		if wordStart && lang.isIdentStart(c) {
+			n := 1
+			for n < len(rest) && lang.isIdent(rest[n]) {
+				n++
+			}
+			word := rest[:n]
+			lookup := word
+			if lang.ignoreCase {
+				lookup = strings.ToLower(word)
+			}
+			if tt, ok := lang.lookup[lookup]; ok {
+				flushPlain(i)
+				emit(tt, word)
+				plainStart = i + n
+			}
+			i += n
+			continue
+		}
+
+		i++
+	}
+	flushPlain(len(line))
+
+	return sb.String()
+}
+
+// yamlKey colors a leading `key:` (or `- key:`) and returns where the rest of
+// the line starts. JSON keys are quoted, so those are handled with strings.
+func (h *highlighter) yamlKey(line string, emit func(tokenType, string)) int {
+	i := 0
+	for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+		i++
+	}
+	if strings.HasPrefix(line[i:], "- ") {
+		i += 2
+	}
+
+	start := i
+	for i < len(line) && h.lang.isIdent(line[i]) {
+		i++
+	}
+	if i == start || i >= len(line) || line[i] != ':' || (i+1 < len(line) && line[i+1] != ' ') {
+		return 0
+	}
+
+	emit(tokenPlain, line[:start])
+	emit(tokenKey, line[start:i])
+	return i
+}
+
+func (l *language) lineCommentAt(line string, i int) bool {
+	for _, prefix := range l.lineComments {
+		if !strings.HasPrefix(line[i:], prefix) {
+			continue
+		}
+		// `#` only starts a comment at the start of a word in shell/YAML
+		// (think `${#array[@]}` or `url#anchor`)
+		if prefix == "#" && i > 0 && line[i-1] != ' ' && line[i-1] != '\t' {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func (l *language) multilineAt(s string) string {
+	for _, delim := range l.multilineStrings {
+		if strings.HasPrefix(s, delim) {
+			return delim
+		}
+	}
+	return ""
+}
+
+// scanString returns the length of the quoted string at the start of s,
+// which runs to the end of the line if it isn't closed.
+func (l *language) scanString(s string) int {
+	quote := s[0]
+	raw := strings.IndexByte(l.rawQuotes, quote) >= 0
+	for i := 1; i < len(s); i++ {
+		if s[i] == '\\' && !raw {
+			i++
+			continue
+		}
+		if s[i] == quote {
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+func scanVariable(s string) int {
+	if s[1] == '{' {
+		if end := strings.IndexByte(s, '}'); end > 0 {
+			return end + 1
+		}
+		return 1
+	}
+	// Special parameters: $?, $#, $@, $1, ...
+	if strings.IndexByte("?#@*!$-0123456789", s[1]) >= 0 {
+		return 2
+	}
+	n := 1
+	for n < len(s) && (isAlnum(s[n]) || s[n] == '_') {
+		n++
+	}
+	return n
+}
+
+func scanNumber(s string) int {
+	n := 0
+	if s[0] == '-' {
+		n++
+	}
+	for n < len(s) && (isAlnum(s[n]) || s[n] == '.' || s[n] == '_') {
+		// Only hex digits, exponents and base prefixes are allowed in the
+		// alpha range; anything else ends the number
+		if isAlpha(s[n]) && strings.IndexByte("xXoObBeEabcdefABCDEFjJ", s[n]) < 0 {
+			break
+		}
+		if s[n] == '.' && (n+1 >= len(s) || !isDigit(s[n+1])) {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+func (l *language) isIdentStart(c byte) bool {
+	return isAlpha(c) || c == '_' || (c == '~' && l.keys)
+}
+
+func (l *language) isIdent(c byte) bool {
+	return isAlnum(c) || c == '_' || strings.IndexByte(l.identChars, c) >= 0
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+func isAlpha(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+func isAlnum(c byte) bool { return isAlpha(c) || isDigit(c) }
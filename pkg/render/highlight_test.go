@@ -0,0 +1,136 @@
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+// A theme where each token kind is easy to spot in the expected output
+var testTheme = Theme{
+	"keyword":  "K",
+	"type":     "T",
+	"constant": "C",
+	"string":   "S",
+	"number":   "N",
+	"comment":  "#",
+	"key":      "Y",
+	"variable": "V",
+}
+
+func paint(code, text string) string {
+	return "\x1b[" + code + "m" + text + "\x1b[0m"
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		lang     string
+		lines    []string
+		expected []string
+	}{
+		{
+			lang:  "go",
+			lines: []string{`func main() { x := 42 // answer`},
+			expected: []string{
+				paint("K", "func") + " main() { x := " + paint("N", "42") + " " + paint("#", "// answer"),
+			},
+		},
+		{
+			lang:  "go",
+			lines: []string{"s := `raw", "string` + \"a\\\"b\""},
+			expected: []string{
+				"s := " + paint("S", "`raw"),
+				paint("S", "string`") + " + " + paint("S", `"a\"b"`),
+			},
+		},
+		{
+			lang:  "go",
+			lines: []string{"/* start", "end */ var err error"},
+			expected: []string{
+				paint("#", "/* start"),
+				paint("#", "end */") + " " + paint("K", "var") + " err " + paint("T", "error"),
+			},
+		},
+		{
+			lang:     "python",
+			lines:    []string{`def f(x): return None  # nothing`},
+			expected: []string{paint("K", "def") + " f(x): " + paint("K", "return") + " " + paint("C", "None") + "  " + paint("#", "# nothing")},
+		},
+		{
+			lang:     "bash",
+			lines:    []string{`echo "$HOME" ${#arr[@]} $1 # done`},
+			expected: []string{paint("C", "echo") + " " + paint("S", `"$HOME"`) + " " + paint("V", "${#arr[@]}") + " " + paint("V", "$1") + " " + paint("#", "# done")},
+		},
+		{
+			lang:     "yaml",
+			lines:    []string{"  - base_url: 'localhost' # here", "enabled: true"},
+			expected: []string{"  - " + paint("Y", "base_url") + ": " + paint("S", "'localhost'") + " " + paint("#", "# here"), paint("Y", "enabled") + ": " + paint("C", "true")},
+		},
+		{
+			lang:     "json",
+			lines:    []string{`{"count": 3, "ok": false}`},
+			expected: []string{"{" + paint("Y", `"count"`) + ": " + paint("N", "3") + ", " + paint("Y", `"ok"`) + ": " + paint("C", "false") + "}"},
+		},
+		{
+			lang:     "sql",
+			lines:    []string{`SELECT id FROM t WHERE name = 'x' -- why`},
+			expected: []string{paint("K", "SELECT") + " id " + paint("K", "FROM") + " t " + paint("K", "WHERE") + " name = " + paint("S", "'x'") + " " + paint("#", "-- why")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.lang, func(t *testing.T) {
+			h := newHighlighter(tt.lang, testTheme)
+			if h == nil {
+				t.Fatalf("no highlighter for %s", tt.lang)
+			}
+			for i, line := range tt.lines {
+				if got := h.line(line); got != tt.expected[i] {
+					t.Errorf("line %d: got: %q, want: %q", i, got, tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHighlight_UnknownLanguage(t *testing.T) {
+	if h := newHighlighter("brainfuck", testTheme); h != nil {
+		t.Errorf("expected no highlighter for an unknown language")
+	}
+
+	got := renderString(t, "```brainfuck\n+++[>+<-]\n```\n", 40, true)
+	if !strings.Contains(got, "\n+++[>+<-]\n") {
+		t.Errorf("unknown language should be printed as is, got: %q", got)
+	}
+}
+
+func TestHighlight_NoColor(t *testing.T) {
+	input := "```go\nfunc main() {}\n```\n"
+	if got := renderString(t, input, 40, false); got != input {
+		t.Errorf("got: %q, want: %q", got, input)
+	}
+
+	t.Setenv("NO_COLOR", "1")
+	if !noColor() {
+		t.Errorf("NO_COLOR should disable color")
+	}
+}
+
+func TestLoadTheme(t *testing.T) {
+	theme, err := LoadTheme("", map[string]string{"keyword": "1;31"})
+	if err != nil {
+		t.Fatalf("LoadTheme failed: %v", err)
+	}
+	if theme["keyword"] != "1;31" || theme["string"] != Themes["default"]["string"] {
+		t.Errorf("override not applied correctly: %v", theme)
+	}
+	if Themes["default"]["keyword"] == "1;31" {
+		t.Errorf("override leaked into the built-in theme")
+	}
+
+	if _, err := LoadTheme("nope", nil); err == nil {
+		t.Errorf("expected an error for an unknown theme")
+	}
+	if _, err := LoadTheme("mono", map[string]string{"keywrod": "1"}); err == nil {
+		t.Errorf("expected an error for an unknown color")
+	}
+}
@@ -0,0 +1,292 @@
+package render
+
+// A small markdown renderer for answers in the terminal. It's an io.Writer so
+// it can be handed chunks of a response as they arrive: complete lines are
+// rendered as soon as their newline shows up, and a partial line is held until
+// the rest of it (or Flush) comes along. Tables are the exception, since the
+// column widths aren't known until the last row has been seen.
+//
+// What it does with each kind of line:
+//   - fenced code is passed through verbatim (no wrapping, indentation kept)
+//   - headings and inline emphasis/code are styled with ANSI codes if color
+//     is enabled, and left as-is otherwise
+//   - list items and block quotes are wrapped with a hanging indent
+//   - tables are aligned into columns
+//   - everything else is word-wrapped, keeping any leading indentation
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/term"
+
+	"github.com/duluk/ask-ollama/pkg/linewrap"
+)
+
+// Below this, wrapping does more harm than good
+const minWrapWidth = 20
+
+var (
+	fenceRe    = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})\\s*([^`\\s]*)")
+	headingRe  = regexp.MustCompile(`^ {0,3}(#{1,6})\s+(.*?)\s*#*\s*$`)
+	ruleRe     = regexp.MustCompile(`^ {0,3}((\*\s*){3,}|(-\s*){3,}|(_\s*){3,})$`)
+	listRe     = regexp.MustCompile(`^(\s*)([-*+]|\d{1,9}[.)])(\s+)(.*)$`)
+	quoteRe    = regexp.MustCompile(`^ {0,3}>\s?(.*)$`)
+	tableSepRe = regexp.MustCompile(`^\s*:?-+:?\s*$`)
+)
+
+type Renderer struct {
+	writer io.Writer
+	// Atomic so the terminal can be resized while an answer is streaming in
+	width    atomic.Int64
+	tabWidth int
+	color    bool
+	theme    Theme
+
+	partial []byte
+
+	// Fenced code block state
+	inFence     bool
+	fence       string
+	highlighter *highlighter
+
+	// Rows of a table that's still being received
+	table []string
+}
+
+func NewRenderer(writer io.Writer, width, tabWidth int, color bool) *Renderer {
+	r := &Renderer{
+		writer:   writer,
+		tabWidth: tabWidth,
+		color:    color,
+		theme:    Themes["default"],
+	}
+	r.width.Store(int64(width))
+	return r
+}
+
+// SetWidth changes the width text is wrapped at. It's safe to call from
+// another goroutine, and takes effect from the next line rendered.
+func (r *Renderer) SetWidth(width int) {
+	r.width.Store(int64(width))
+}
+
+// SetTheme changes the colors used to highlight code blocks
+func (r *Renderer) SetTheme(theme Theme) {
+	r.theme = theme
+}
+
+// ColorEnabled reports whether ANSI styling should be used when writing to f:
+// only when it's a terminal and NO_COLOR isn't set.
+func ColorEnabled(f *os.File) bool {
+	return !noColor() && term.IsTerminal(int(f.Fd()))
+}
+
+func (r *Renderer) Write(data []byte) (int, error) {
+	r.partial = append(r.partial, data...)
+
+	var out bytes.Buffer
+	for {
+		i := bytes.IndexByte(r.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimSuffix(string(r.partial[:i]), "\r")
+		r.partial = r.partial[i+1:]
+		r.renderLine(&out, line, true)
+	}
+
+	if out.Len() > 0 {
+		if _, err := r.writer.Write(out.Bytes()); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Flush renders whatever is left over: a line without a trailing newline and
+// any table that's still being collected. Call it once the answer is done.
+func (r *Renderer) Flush() error {
+	var out bytes.Buffer
+
+	if len(r.partial) > 0 {
+		line := string(r.partial)
+		r.partial = nil
+		r.renderLine(&out, line, false)
+	}
+	// A partial table row flushes the table itself, so anything left here
+	// ended with a newline
+	r.flushTable(&out, true)
+
+	if out.Len() == 0 {
+		return nil
+	}
+	_, err := r.writer.Write(out.Bytes())
+	return err
+}
+
+func (r *Renderer) renderLine(out *bytes.Buffer, line string, newline bool) {
+	nl := ""
+	if newline {
+		nl = "\n"
+	}
+
+	if r.inFence {
+		if isClosingFence(line, r.fence) {
+			r.inFence = false
+			r.highlighter = nil
+			out.WriteString(r.style(line, styleDim) + nl)
+			return
+		}
+		out.WriteString(r.codeLine(line) + nl)
+		return
+	}
+
+	if isTableRow(line) {
+		r.table = append(r.table, line)
+		if !newline {
+			r.flushTable(out, false)
+		}
+		return
+	}
+	r.flushTable(out, true)
+
+	if m := fenceRe.FindStringSubmatch(line); m != nil {
+		r.inFence = true
+		r.fence = m[1]
+		if r.color {
+			r.highlighter = newHighlighter(m[2], r.theme)
+		}
+		out.WriteString(r.style(line, styleDim) + nl)
+		return
+	}
+
+	if strings.TrimSpace(line) == "" {
+		out.WriteString(nl)
+		return
+	}
+
+	if m := headingRe.FindStringSubmatch(line); m != nil {
+		out.WriteString(r.heading(line, len(m[1]), m[2]) + nl)
+		return
+	}
+
+	if ruleRe.MatchString(line) {
+		if r.color {
+			out.WriteString(r.style(strings.Repeat("─", r.wrapWidth()), styleDim) + nl)
+		} else {
+			out.WriteString(line + nl)
+		}
+		return
+	}
+
+	if m := quoteRe.FindStringSubmatch(line); m != nil {
+		bar := "> "
+		if r.color {
+			bar = r.style("│", styleDim) + " "
+		}
+		out.WriteString(r.wrap(r.inline(m[1]), bar, bar) + nl)
+		return
+	}
+
+	if m := listRe.FindStringSubmatch(line); m != nil {
+		indent := r.expandTabs(m[1])
+		marker := m[2]
+		hanging := strings.Repeat(" ", displayWidth(indent)+len(marker)+1)
+		if r.color && len(marker) == 1 {
+			marker = "•"
+		}
+		out.WriteString(r.wrap(r.inline(m[4]), indent+marker+" ", hanging) + nl)
+		return
+	}
+
+	// Plain paragraph text. Keep its indentation for the wrapped lines too.
+	expanded := r.expandTabs(line)
+	text := strings.TrimLeft(expanded, " ")
+	indent := expanded[:len(expanded)-len(text)]
+	out.WriteString(r.wrap(r.inline(text), indent, indent) + nl)
+}
+
+func (r *Renderer) heading(line string, level int, text string) string {
+	if !r.color {
+		return line
+	}
+	if level == 1 {
+		return r.style(r.inline(text), styleBold, styleUnderline)
+	}
+	return r.style(r.inline(text), styleBold)
+}
+
+// Code is never wrapped or reindented, but it is highlighted if we know the
+// language
+func (r *Renderer) codeLine(line string) string {
+	if r.highlighter == nil {
+		return line
+	}
+	return r.highlighter.line(line)
+}
+
+func isClosingFence(line, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	if len(trimmed) < len(fence) {
+		return false
+	}
+	return strings.Trim(trimmed, fence[:1]) == "" && len(line)-len(strings.TrimLeft(line, " ")) <= 3
+}
+
+func (r *Renderer) wrapWidth() int {
+	return max(int(r.width.Load()), minWrapWidth)
+}
+
+// wrap word-wraps text so no line is wider than the renderer's width. The
+// first line starts with first and the rest with rest, which is how lists
+// and quotes get their hanging indent. Words longer than a line are left to
+// overflow rather than being broken, as they're usually URLs or paths.
+func (r *Renderer) wrap(text, first, rest string) string {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return strings.TrimRight(first, " ")
+	}
+
+	var sb strings.Builder
+	width := r.wrapWidth()
+
+	sb.WriteString(first)
+	lineWidth := displayWidth(first)
+	lineStart := true
+
+	for _, word := range words {
+		wordWidth := displayWidth(word)
+		if !lineStart && lineWidth+1+wordWidth > width {
+			sb.WriteString("\n")
+			sb.WriteString(rest)
+			lineWidth = displayWidth(rest)
+			lineStart = true
+		}
+		if !lineStart {
+			sb.WriteString(" ")
+			lineWidth++
+		}
+		sb.WriteString(word)
+		lineWidth += wordWidth
+		lineStart = false
+	}
+
+	return sb.String()
+}
+
+func (r *Renderer) expandTabs(s string) string {
+	if !strings.Contains(s, "\t") {
+		return s
+	}
+	return strings.ReplaceAll(s, "\t", strings.Repeat(" ", r.tabWidth))
+}
+
+func displayWidth(s string) int {
+	return linewrap.StringWidth(s)
+}
@@ -0,0 +1,139 @@
+package render
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func renderString(t *testing.T, input string, width int, color bool) string {
+	t.Helper()
+	var buffer bytes.Buffer
+	r := NewRenderer(&buffer, width, 4, color)
+	if _, err := r.Write([]byte(input)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := r.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	return buffer.String()
+}
+
+func TestRenderer_Plain(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "paragraph is word wrapped",
+			input:    "The quick brown fox jumps over the lazy dog\n",
+			expected: "The quick brown fox\njumps over the lazy\ndog\n",
+		},
+		{
+			name:     "fenced code is verbatim",
+			input:    "```go\nfunc main() { fmt.Println(\"this line is much longer than twenty\") }\n\tindented\n```\n",
+			expected: "```go\nfunc main() { fmt.Println(\"this line is much longer than twenty\") }\n\tindented\n```\n",
+		},
+		{
+			name:     "list items get a hanging indent",
+			input:    "- one two three four five six\n  1. alpha beta gamma delta\n",
+			expected: "- one two three four\n  five six\n  1. alpha beta\n     gamma delta\n",
+		},
+		{
+			name:     "headings and emphasis are untouched without color",
+			input:    "## Title\nsome **bold** text\n",
+			expected: "## Title\nsome **bold** text\n",
+		},
+		{
+			name:     "quotes keep their marker",
+			input:    "> quoted text that goes on for a while\n",
+			expected: "> quoted text that\n> goes on for a\n> while\n",
+		},
+		{
+			name:     "tables are aligned",
+			input:    "| a | long header |\n|:-|--:|\n| wide cell | 1 |\nafter\n",
+			expected: "| a         | long header |\n|-----------|-------------|\n| wide cell |           1 |\nafter\n",
+		},
+		{
+			name:     "no trailing newline is kept",
+			input:    "last line",
+			expected: "last line",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderString(t, tt.input, 20, false)
+			if got != tt.expected {
+				t.Errorf("got: %q, want: %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRenderer_Chunked(t *testing.T) {
+	input := "# Heading\n\nSome text with `code` in it.\n\n```sh\nls   -la\n```\n| x | y |\n|---|---|\n| 1 | 2 |\n- item"
+	expected := renderString(t, input, 30, true)
+
+	// Feeding the same input a few bytes at a time should give the same
+	// result, as that's how a streamed answer arrives
+	for _, size := range []int{1, 3, 7} {
+		var buffer bytes.Buffer
+		r := NewRenderer(&buffer, 30, 4, true)
+		for i := 0; i < len(input); i += size {
+			end := min(i+size, len(input))
+			r.Write([]byte(input[i:end]))
+		}
+		r.Flush()
+		if buffer.String() != expected {
+			t.Errorf("chunk size %d: got: %q, want: %q", size, buffer.String(), expected)
+		}
+	}
+}
+
+func TestRenderer_Color(t *testing.T) {
+	got := renderString(t, "# Title\n## Sub\n- a **b** *c* `d`\n", 40, true)
+
+	expected := "\x1b[1;4mTitle\x1b[24;22m\n" +
+		"\x1b[1mSub\x1b[22m\n" +
+		"• a \x1b[1mb\x1b[22m \x1b[3mc\x1b[23m \x1b[36md\x1b[39m\n"
+	if got != expected {
+		t.Errorf("got: %q, want: %q", got, expected)
+	}
+}
+
+func TestRenderer_ColorWrapIgnoresEscapes(t *testing.T) {
+	got := renderString(t, "**aaaa** **bbbb** **cccc** **dddd** **eeee**\n", 20, true)
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %q", len(lines), got)
+	}
+	for _, line := range lines {
+		if w := displayWidth(line); w > 20 {
+			t.Errorf("line too wide (%d): %q", w, line)
+		}
+	}
+}
+
+func TestInline(t *testing.T) {
+	r := NewRenderer(nil, 80, 4, true)
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2 * 3 * 4", "2 * 3 * 4"},
+		{"snake_case_name", "snake_case_name"},
+		{"a _b_ c", "a \x1b[3mb\x1b[23m c"},
+		{"__bold__", "\x1b[1mbold\x1b[22m"},
+		{"``a`b``", "\x1b[36ma`b\x1b[39m"},
+		{`\*not italic\*`, "*not italic*"},
+		{"unclosed **bold", "unclosed **bold"},
+	}
+
+	for _, tt := range tests {
+		if got := r.inline(tt.input); got != tt.expected {
+			t.Errorf("inline(%q): got: %q, want: %q", tt.input, got, tt.expected)
+		}
+	}
+}
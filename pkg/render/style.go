@@ -0,0 +1,126 @@
+package render
+
+import (
+	"strings"
+)
+
+// Each style is a pair of SGR codes: one to turn it on and one to turn only
+// that attribute back off, so styles can be nested (eg, code in a heading).
+type style struct {
+	on, off string
+}
+
+var (
+	styleBold      = style{"1", "22"}
+	styleDim       = style{"2", "22"}
+	styleItalic    = style{"3", "23"}
+	styleUnderline = style{"4", "24"}
+	styleCode      = style{"36", "39"}
+)
+
+func (r *Renderer) style(s string, styles ...style) string {
+	if !r.color || s == "" {
+		return s
+	}
+
+	var on, off []string
+	for _, st := range styles {
+		on = append(on, st.on)
+		off = append([]string{st.off}, off...)
+	}
+	return "\x1b[" + strings.Join(on, ";") + "m" + s + "\x1b[" + strings.Join(off, ";") + "m"
+}
+
+// inline styles `code`, **bold** and *italic* (or __bold__ and _italic_).
+// Without color the markers are left alone, so the text reads as the
+// markdown it is.
+func (r *Renderer) inline(s string) string {
+	if !r.color {
+		return s
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_", s[i+1]) >= 0:
+			sb.WriteByte(s[i+1])
+			i += 2
+			continue
+
+		case c == '`':
+			ticks := countRun(s[i:], '`')
+			end := strings.Index(s[i+ticks:], strings.Repeat("`", ticks))
+			if end >= 0 {
+				code := s[i+ticks : i+ticks+end]
+				sb.WriteString(r.style(code, styleCode))
+				i += 2*ticks + end
+				continue
+			}
+
+		case c == '*' || c == '_':
+			n := min(countRun(s[i:], c), 2)
+			if end := findClosing(s, i, c, n); end >= 0 {
+				inner := r.inline(s[i+n : end])
+				if n == 2 {
+					sb.WriteString(r.style(inner, styleBold))
+				} else {
+					sb.WriteString(r.style(inner, styleItalic))
+				}
+				i = end + n
+				continue
+			}
+		}
+
+		sb.WriteByte(c)
+		i++
+	}
+
+	return sb.String()
+}
+
+func countRun(s string, c byte) int {
+	n := 0
+	for n < len(s) && s[n] == c {
+		n++
+	}
+	return n
+}
+
+// findClosing looks for the delimiter (n of c) that closes the one at start,
+// returning its index or -1. Like CommonMark, an opening delimiter must be
+// followed by a non-space and a closing one preceded by one, which keeps
+// things like `2 * 3 * 4` from turning italic. Underscores must also sit on
+// a word boundary so snake_case_names are left alone.
+func findClosing(s string, start int, c byte, n int) int {
+	open := start + n
+	if open >= len(s) || s[open] == ' ' || s[open] == c {
+		return -1
+	}
+	if c == '_' && start > 0 && isWordByte(s[start-1]) {
+		return -1
+	}
+
+	delim := strings.Repeat(string(c), n)
+	for i := open + 1; i+n <= len(s); i++ {
+		if s[i:i+n] != delim || s[i-1] == ' ' {
+			continue
+		}
+		// For single delimiters, skip over doubled ones (`*a **b** c*`)
+		if n == 1 && i+1 < len(s) && s[i+1] == c {
+			i++
+			continue
+		}
+		if c == '_' && i+n < len(s) && isWordByte(s[i+n]) {
+			continue
+		}
+		return i
+	}
+
+	return -1
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= 0x80
+}
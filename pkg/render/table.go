@@ -0,0 +1,148 @@
+package render
+
+import (
+	"bytes"
+	"strings"
+)
+
+type align int
+
+const (
+	alignLeft align = iota
+	alignCenter
+	alignRight
+)
+
+func isTableRow(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return len(trimmed) > 1 && trimmed[0] == '|' && strings.Count(trimmed, "|") >= 2
+}
+
+// splitRow splits `| a | b |` into its cells, allowing for escaped pipes
+func splitRow(line string) []string {
+	trimmed := strings.TrimSpace(line)
+	trimmed = strings.TrimPrefix(trimmed, "|")
+	if strings.HasSuffix(trimmed, "|") && !strings.HasSuffix(trimmed, "\\|") {
+		trimmed = trimmed[:len(trimmed)-1]
+	}
+
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(trimmed); i++ {
+		switch {
+		case trimmed[i] == '\\' && i+1 < len(trimmed) && trimmed[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case trimmed[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(trimmed[i])
+		}
+	}
+	cells = append(cells, strings.TrimSpace(cell.String()))
+
+	return cells
+}
+
+func isSeparatorRow(cells []string) bool {
+	for _, cell := range cells {
+		if !tableSepRe.MatchString(cell) {
+			return false
+		}
+	}
+	return len(cells) > 0
+}
+
+// flushTable writes out any buffered table rows with the columns lined up.
+// Rows are kept as markdown (pipes and a dashed separator) so the output is
+// still a valid table if it's copied somewhere else.
+func (r *Renderer) flushTable(out *bytes.Buffer, newline bool) {
+	if len(r.table) == 0 {
+		return
+	}
+	rows := make([][]string, 0, len(r.table))
+	for _, line := range r.table {
+		rows = append(rows, splitRow(line))
+	}
+	r.table = nil
+
+	ncols := 0
+	for _, row := range rows {
+		ncols = max(ncols, len(row))
+	}
+
+	// Alignment comes from the separator row (`:--`, `:-:`, `--:`)
+	aligns := make([]align, ncols)
+	sepRow := -1
+	if len(rows) > 1 && isSeparatorRow(rows[1]) {
+		sepRow = 1
+		for i, cell := range rows[1] {
+			left := strings.HasPrefix(cell, ":")
+			right := strings.HasSuffix(cell, ":")
+			switch {
+			case left && right:
+				aligns[i] = alignCenter
+			case right:
+				aligns[i] = alignRight
+			}
+		}
+	}
+
+	styled := make([][]string, len(rows))
+	widths := make([]int, ncols)
+	for i, row := range rows {
+		if i == sepRow {
+			continue
+		}
+		styled[i] = make([]string, ncols)
+		for j := 0; j < ncols; j++ {
+			cell := ""
+			if j < len(row) {
+				cell = r.inline(row[j])
+			}
+			if i == 0 && sepRow == 1 {
+				cell = r.style(cell, styleBold)
+			}
+			styled[i][j] = cell
+			widths[j] = max(widths[j], displayWidth(cell))
+		}
+	}
+
+	for i := range rows {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		if i == sepRow {
+			var sb strings.Builder
+			sb.WriteString("|")
+			for j := 0; j < ncols; j++ {
+				sb.WriteString(strings.Repeat("-", widths[j]+2) + "|")
+			}
+			out.WriteString(r.style(sb.String(), styleDim))
+			continue
+		}
+
+		out.WriteString("|")
+		for j, cell := range styled[i] {
+			out.WriteString(" " + pad(cell, widths[j], aligns[j]) + " |")
+		}
+	}
+	if newline {
+		out.WriteString("\n")
+	}
+}
+
+func pad(s string, width int, a align) string {
+	gap := width - displayWidth(s)
+	if gap <= 0 {
+		return s
+	}
+	switch a {
+	case alignRight:
+		return strings.Repeat(" ", gap) + s
+	case alignCenter:
+		return strings.Repeat(" ", gap/2) + s + strings.Repeat(" ", gap-gap/2)
+	}
+	return s + strings.Repeat(" ", gap)
+}
@@ -0,0 +1,113 @@
+package render
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// A Theme maps each kind of token to the SGR parameters used to color it
+// (eg, "1;34" for bold blue). Token kinds with no entry are left plain.
+type Theme map[string]string
+
+var tokenNames = map[tokenType]string{
+	tokenKeyword:  "keyword",
+	tokenTypeName: "type",
+	tokenConstant: "constant",
+	tokenString:   "string",
+	tokenNumber:   "number",
+	tokenComment:  "comment",
+	tokenKey:      "key",
+	tokenVariable: "variable",
+}
+
+var Themes = map[string]Theme{
+	"default": {
+		"keyword":  "35",
+		"type":     "36",
+		"constant": "33",
+		"string":   "32",
+		"number":   "33",
+		"comment":  "90",
+		"key":      "34",
+		"variable": "36",
+	},
+	// Darker colors that are still readable on a white background
+	"light": {
+		"keyword":  "1;35",
+		"type":     "34",
+		"constant": "31",
+		"string":   "32",
+		"number":   "31",
+		"comment":  "2;3",
+		"key":      "1;34",
+		"variable": "34",
+	},
+	// No colors at all, just weight and slant
+	"mono": {
+		"keyword":  "1",
+		"type":     "1",
+		"comment":  "2;3",
+		"key":      "1",
+		"string":   "3",
+		"variable": "4",
+	},
+}
+
+// LoadTheme returns the named built-in theme with any colors from the config
+// applied on top. An empty name means the default theme.
+func LoadTheme(name string, colors map[string]string) (Theme, error) {
+	if name == "" {
+		name = "default"
+	}
+
+	base, ok := Themes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown theme %q (available: %s)", name, strings.Join(ThemeNames(), ", "))
+	}
+
+	theme := make(Theme, len(base)+len(colors))
+	for k, v := range base {
+		theme[k] = v
+	}
+	for k, v := range colors {
+		if !isTokenName(k) {
+			return nil, fmt.Errorf("unknown theme color %q", k)
+		}
+		theme[k] = v
+	}
+
+	return theme, nil
+}
+
+func ThemeNames() []string {
+	names := make([]string, 0, len(Themes))
+	for name := range Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isTokenName(name string) bool {
+	for _, n := range tokenNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t Theme) paint(tt tokenType, text string) string {
+	code := t[tokenNames[tt]]
+	if code == "" || text == "" {
+		return text
+	}
+	return "\x1b[" + code + "m" + text + "\x1b[0m"
+}
+
+// noColor is https://no-color.org: any non-empty value turns color off
+func noColor() bool {
+	return os.Getenv("NO_COLOR") != ""
+}
@@ -0,0 +1,481 @@
+// Package schema checks JSON against a JSON schema. It covers the parts of
+// JSON Schema that structured output is written with: types, properties and
+// required ones, items, enums, consts, the numeric and length limits,
+// patterns, anyOf/oneOf/allOf/not and $ref within the same schema. Anything
+// else (format, if/then, dependencies...) is ignored, which is what the
+// spec says to do with keywords a validator doesn't know.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The most problems reported for one value; past that, it's clearly not
+// what was asked for
+const maxProblems = 10
+
+type Schema struct {
+	raw  json.RawMessage
+	root any
+	// Compiled patterns, by pattern
+	patterns map[string]*regexp.Regexp
+}
+
+// Load reads a schema from a file
+func Load(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema: %v", err)
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("error in schema %s: %v", path, err)
+	}
+	return s, nil
+}
+
+// Parse reads a schema, checking that it's one (as far as this goes)
+func Parse(data []byte) (*Schema, error) {
+	var root any
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	switch root.(type) {
+	case map[string]any, bool:
+	default:
+		return nil, fmt.Errorf("a schema should be an object")
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, data); err != nil {
+		return nil, err
+	}
+	s := &Schema{raw: compact.Bytes(), root: root, patterns: make(map[string]*regexp.Regexp)}
+	if err := s.check(root, "#"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// JSON is the schema, as it was given
+func (s *Schema) JSON() json.RawMessage {
+	return s.raw
+}
+
+// Error lists what's wrong with a value. Each problem starts with where it
+// is, as a path like $.items[2].name.
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// Validate checks that data is JSON that matches the schema
+func (s *Schema) Validate(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return &Error{Problems: []string{fmt.Sprintf("not valid JSON: %v", err)}}
+	}
+
+	var problems []string
+	s.validate(s.root, v, "$", &problems)
+	if len(problems) > 0 {
+		return &Error{Problems: problems}
+	}
+	return nil
+}
+
+// check makes sure the keywords that are used have values that make sense,
+// so a mistake in the schema is reported as one, not as every answer
+// failing to match it
+func (s *Schema) check(node any, where string) error {
+	schema, ok := node.(map[string]any)
+	if !ok {
+		if _, ok := node.(bool); ok {
+			return nil
+		}
+		return fmt.Errorf("%s: a schema should be an object", where)
+	}
+
+	if t, ok := schema["type"]; ok {
+		types, err := typeNames(t)
+		if err != nil {
+			return fmt.Errorf("%s/type: %v", where, err)
+		}
+		for _, name := range types {
+			if !knownTypes[name] {
+				return fmt.Errorf("%s/type: unknown type %q", where, name)
+			}
+		}
+	}
+	if r, ok := schema["required"]; ok {
+		if _, err := stringList(r); err != nil {
+			return fmt.Errorf("%s/required: %v", where, err)
+		}
+	}
+	if p, ok := schema["pattern"]; ok {
+		pattern, ok := p.(string)
+		if !ok {
+			return fmt.Errorf("%s/pattern: should be a string", where)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("%s/pattern: %v", where, err)
+		}
+		s.patterns[pattern] = re
+	}
+	for _, key := range []string{"minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum", "minLength", "maxLength", "minItems", "maxItems", "minProperties", "maxProperties"} {
+		if n, ok := schema[key]; ok {
+			if _, ok := n.(float64); !ok {
+				return fmt.Errorf("%s/%s: should be a number", where, key)
+			}
+		}
+	}
+	if e, ok := schema["enum"]; ok {
+		if _, ok := e.([]any); !ok {
+			return fmt.Errorf("%s/enum: should be a list", where)
+		}
+	}
+	if ref, ok := schema["$ref"]; ok {
+		r, ok := ref.(string)
+		if !ok {
+			return fmt.Errorf("%s/$ref: should be a string", where)
+		}
+		if _, err := s.resolve(r); err != nil {
+			return fmt.Errorf("%s/$ref: %v", where, err)
+		}
+	}
+
+	// And the schemas inside this one
+	for _, key := range []string{"items", "additionalProperties", "not"} {
+		if sub, ok := schema[key]; ok {
+			if err := s.check(sub, where+"/"+key); err != nil {
+				return err
+			}
+		}
+	}
+	for _, key := range []string{"properties", "$defs", "definitions"} {
+		if subs, ok := schema[key]; ok {
+			m, ok := subs.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s/%s: should be an object", where, key)
+			}
+			for _, name := range sortedKeys(m) {
+				if err := s.check(m[name], where+"/"+key+"/"+name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, key := range []string{"anyOf", "oneOf", "allOf"} {
+		if subs, ok := schema[key]; ok {
+			list, ok := subs.([]any)
+			if !ok || len(list) == 0 {
+				return fmt.Errorf("%s/%s: should be a list of schemas", where, key)
+			}
+			for i, sub := range list {
+				if err := s.check(sub, fmt.Sprintf("%s/%s/%d", where, key, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+var knownTypes = map[string]bool{
+	"string": true, "number": true, "integer": true, "boolean": true,
+	"object": true, "array": true, "null": true,
+}
+
+// resolve finds what a $ref refers to, which has to be in this schema
+func (s *Schema) resolve(ref string) (any, error) {
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("only references within the schema (#/...) are supported, not %q", ref)
+	}
+
+	node := s.root
+	for _, part := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(ref, "#"), "/"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s doesn't exist", ref)
+		}
+		if node, ok = m[part]; !ok {
+			return nil, fmt.Errorf("%s doesn't exist", ref)
+		}
+	}
+	return node, nil
+}
+
+func (s *Schema) validate(node, v any, path string, problems *[]string) {
+	if len(*problems) >= maxProblems {
+		return
+	}
+	add := func(format string, args ...any) {
+		if len(*problems) < maxProblems {
+			*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+		}
+	}
+
+	schema, ok := node.(map[string]any)
+	if !ok {
+		// true allows anything, and false nothing
+		if allowed, ok := node.(bool); ok && !allowed {
+			add("isn't allowed")
+		}
+		return
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		// Checked when the schema was parsed
+		target, _ := s.resolve(ref)
+		s.validate(target, v, path, problems)
+	}
+
+	if t, ok := schema["type"]; ok {
+		types, _ := typeNames(t)
+		if !matchesType(types, v) {
+			add("expected %s, got %s", strings.Join(types, " or "), typeOf(v))
+			// Nothing else about it will make sense
+			return
+		}
+	}
+	if enum, ok := schema["enum"].([]any); ok && !contains(enum, v) {
+		add("%s isn't one of %s", brief(v), briefList(enum))
+	}
+	if c, ok := schema["const"]; ok && !equal(c, v) {
+		add("should be %s", brief(c))
+	}
+
+	switch v := v.(type) {
+	case float64:
+		s.validateNumber(schema, v, add)
+	case string:
+		s.validateString(schema, v, add)
+	case []any:
+		if items, ok := schema["items"]; ok {
+			for i, item := range v {
+				s.validate(items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+		if n, ok := schema["minItems"].(float64); ok && float64(len(v)) < n {
+			add("should have at least %g items, not %d", n, len(v))
+		}
+		if n, ok := schema["maxItems"].(float64); ok && float64(len(v)) > n {
+			add("should have at most %g items, not %d", n, len(v))
+		}
+	case map[string]any:
+		s.validateObject(schema, v, path, problems, add)
+	}
+
+	if all, ok := schema["allOf"].([]any); ok {
+		for _, sub := range all {
+			s.validate(sub, v, path, problems)
+		}
+	}
+	if some, ok := schema["anyOf"].([]any); ok && s.matching(some, v) == 0 {
+		add("doesn't match any of the allowed schemas")
+	}
+	if one, ok := schema["oneOf"].([]any); ok {
+		if n := s.matching(one, v); n != 1 {
+			add("should match exactly one of the allowed schemas, but matches %d", n)
+		}
+	}
+	if not, ok := schema["not"]; ok && s.matches(not, v) {
+		add("matches a schema it shouldn't")
+	}
+}
+
+func (s *Schema) validateNumber(schema map[string]any, v float64, add func(string, ...any)) {
+	if n, ok := schema["minimum"].(float64); ok && v < n {
+		add("%g is less than the minimum of %g", v, n)
+	}
+	if n, ok := schema["maximum"].(float64); ok && v > n {
+		add("%g is more than the maximum of %g", v, n)
+	}
+	if n, ok := schema["exclusiveMinimum"].(float64); ok && v <= n {
+		add("%g should be more than %g", v, n)
+	}
+	if n, ok := schema["exclusiveMaximum"].(float64); ok && v >= n {
+		add("%g should be less than %g", v, n)
+	}
+}
+
+func (s *Schema) validateString(schema map[string]any, v string, add func(string, ...any)) {
+	length := len([]rune(v))
+	if n, ok := schema["minLength"].(float64); ok && float64(length) < n {
+		add("should be at least %g characters, not %d", n, length)
+	}
+	if n, ok := schema["maxLength"].(float64); ok && float64(length) > n {
+		add("should be at most %g characters, not %d", n, length)
+	}
+	if p, ok := schema["pattern"].(string); ok && !s.patterns[p].MatchString(v) {
+		add("%q doesn't match the pattern %s", v, p)
+	}
+}
+
+func (s *Schema) validateObject(schema map[string]any, v map[string]any, path string, problems *[]string, add func(string, ...any)) {
+	required, _ := stringList(schema["required"])
+	for _, name := range required {
+		if _, ok := v[name]; !ok {
+			add("%s is required", name)
+		}
+	}
+
+	props, _ := schema["properties"].(map[string]any)
+	additional, hasAdditional := schema["additionalProperties"]
+	for _, name := range sortedKeys(v) {
+		sub := path + "." + name
+		if prop, ok := props[name]; ok {
+			s.validate(prop, v[name], sub, problems)
+		} else if hasAdditional {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				add("%s isn't allowed", name)
+			} else {
+				s.validate(additional, v[name], sub, problems)
+			}
+		}
+	}
+
+	if n, ok := schema["minProperties"].(float64); ok && float64(len(v)) < n {
+		add("should have at least %g properties, not %d", n, len(v))
+	}
+	if n, ok := schema["maxProperties"].(float64); ok && float64(len(v)) > n {
+		add("should have at most %g properties, not %d", n, len(v))
+	}
+}
+
+func (s *Schema) matches(node, v any) bool {
+	var problems []string
+	s.validate(node, v, "$", &problems)
+	return len(problems) == 0
+}
+
+func (s *Schema) matching(nodes []any, v any) int {
+	n := 0
+	for _, node := range nodes {
+		if s.matches(node, v) {
+			n++
+		}
+	}
+	return n
+}
+
+func typeNames(t any) ([]string, error) {
+	if name, ok := t.(string); ok {
+		return []string{name}, nil
+	}
+	names, err := stringList(t)
+	if err != nil || len(names) == 0 {
+		return nil, fmt.Errorf("should be a type or a list of them")
+	}
+	return names, nil
+}
+
+func stringList(v any) ([]string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("should be a list of strings")
+	}
+	var strs []string
+	for _, item := range list {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("should be a list of strings")
+		}
+		strs = append(strs, s)
+	}
+	return strs, nil
+}
+
+func matchesType(types []string, v any) bool {
+	actual := typeOf(v)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf is the JSON type of a decoded value, with whole numbers counting
+// as integers
+func typeOf(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func equal(a, b any) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return bytes.Equal(ja, jb)
+}
+
+func contains(list []any, v any) bool {
+	for _, item := range list {
+		if equal(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// brief shows a value the way it'd be written in JSON, cut short if it's
+// long
+func brief(v any) string {
+	data, _ := json.Marshal(v)
+	s := string(data)
+	if len(s) > 40 {
+		s = s[:37] + "..."
+	}
+	return s
+}
+
+func briefList(list []any) string {
+	var items []string
+	for _, item := range list {
+		items = append(items, brief(item))
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,114 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const person = `{
+  "type": "object",
+  "properties": {
+    "name": {"type": "string", "minLength": 1},
+    "age": {"type": "integer", "minimum": 0, "maximum": 150},
+    "email": {"type": "string", "pattern": "^[^@]+@[^@]+$"},
+    "role": {"enum": ["admin", "user"]},
+    "tags": {"type": "array", "items": {"type": "string"}, "maxItems": 3},
+    "address": {"$ref": "#/$defs/address"}
+  },
+  "required": ["name", "age"],
+  "additionalProperties": false,
+  "$defs": {
+    "address": {
+      "type": "object",
+      "properties": {"city": {"type": "string"}},
+      "required": ["city"]
+    }
+  }
+}`
+
+func problems(err error) []string {
+	if err == nil {
+		return nil
+	}
+	return err.(*Error).Problems
+}
+
+func TestValidate(t *testing.T) {
+	s, err := Parse([]byte(person))
+	assert.Nil(t, err)
+
+	for _, test := range []struct {
+		value    string
+		expected []string
+	}{
+		{`{"name": "Ann", "age": 30}`, nil},
+		{`{"name": "Ann", "age": 30, "email": "ann@example.com", "role": "admin", "tags": ["a"], "address": {"city": "Oslo"}}`, nil},
+		{`{"name": "Ann"}`, []string{"$: age is required"}},
+		{`{"name": "", "age": 30.5}`, []string{"$.age: expected integer, got number", "$.name: should be at least 1 characters, not 0"}},
+		{`{"name": "Ann", "age": -1, "role": "root"}`, []string{"$.age: -1 is less than the minimum of 0", `$.role: "root" isn't one of ["admin", "user"]`}},
+		{`{"name": "Ann", "age": 30, "email": "nope"}`, []string{`$.email: "nope" doesn't match the pattern ^[^@]+@[^@]+$`}},
+		{`{"name": "Ann", "age": 30, "tags": ["a", 2, "c", "d"]}`, []string{"$.tags[1]: expected string, got integer", "$.tags: should have at most 3 items, not 4"}},
+		{`{"name": "Ann", "age": 30, "address": {}}`, []string{"$.address: city is required"}},
+		{`{"name": "Ann", "age": 30, "nickname": "A"}`, []string{"$: nickname isn't allowed"}},
+		{`["Ann", 30]`, []string{"$: expected object, got array"}},
+		{`{"name": "Ann",`, []string{"not valid JSON: unexpected end of JSON input"}},
+	} {
+		assert.Equal(t, test.expected, problems(s.Validate([]byte(test.value))), test.value)
+	}
+}
+
+func TestCombinations(t *testing.T) {
+	s, err := Parse([]byte(`{
+	  "type": ["string", "number", "null"],
+	  "anyOf": [{"type": "string"}, {"type": "number", "exclusiveMinimum": 0}, {"type": "null"}],
+	  "oneOf": [{"type": "number"}, {"type": "integer"}, {"type": "string"}, {"type": "null"}],
+	  "not": {"const": "secret"}
+	}`))
+	assert.Nil(t, err)
+
+	assert.Nil(t, s.Validate([]byte(`"hello"`)))
+	assert.Nil(t, s.Validate([]byte(`null`)))
+	assert.Nil(t, s.Validate([]byte(`0.5`)))
+	assert.Equal(t, []string{
+		"$: doesn't match any of the allowed schemas",
+		"$: should match exactly one of the allowed schemas, but matches 2",
+	}, problems(s.Validate([]byte(`-1`))))
+	assert.Equal(t, []string{"$: matches a schema it shouldn't"}, problems(s.Validate([]byte(`"secret"`))))
+	assert.Equal(t, []string{"$: expected string or number or null, got boolean"}, problems(s.Validate([]byte(`true`))))
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, test := range []struct {
+		schema string
+		err    string
+	}{
+		{`[]`, "a schema should be an object"},
+		{`{"type": "text"}`, `#/type: unknown type "text"`},
+		{`{"properties": {"a": {"type": 1}}}`, "#/properties/a/type: should be a type or a list of them"},
+		{`{"required": "a"}`, "#/required: should be a list of strings"},
+		{`{"pattern": "("}`, "#/pattern: error parsing regexp: missing closing ): `(`"},
+		{`{"minLength": "1"}`, "#/minLength: should be a number"},
+		{`{"$ref": "#/$defs/missing"}`, "#/$ref: #/$defs/missing doesn't exist"},
+		{`{"$ref": "other.json"}`, `#/$ref: only references within the schema (#/...) are supported, not "other.json"`},
+		{`{"anyOf": []}`, "#/anyOf: should be a list of schemas"},
+	} {
+		_, err := Parse([]byte(test.schema))
+		assert.EqualError(t, err, test.err, test.schema)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	assert.Nil(t, os.WriteFile(path, []byte("{\n  \"type\": \"string\"\n}\n"), 0644))
+
+	s, err := Load(path)
+	assert.Nil(t, err)
+	// Sent to Ollama as it is, less the whitespace
+	assert.Equal(t, `{"type":"string"}`, string(s.JSON()))
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.json"))
+	assert.ErrorContains(t, err, "error reading schema")
+}
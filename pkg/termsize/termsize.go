@@ -0,0 +1,45 @@
+package termsize
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+const (
+	DefaultWidth  = 80
+	DefaultHeight = 24
+)
+
+// Size returns the terminal's width and height. Any one of stdout, stderr or
+// stdin may be redirected (`git diff | ask-ollama ...`, `ask-ollama > out`),
+// so each is tried in turn, followed by the controlling terminal itself.
+func Size() (int, int, error) {
+	for _, f := range []*os.File{os.Stdout, os.Stderr, os.Stdin} {
+		if width, height, err := term.GetSize(int(f.Fd())); err == nil && width > 0 {
+			return width, height, nil
+		}
+	}
+
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return 0, 0, fmt.Errorf("no terminal found: %v", err)
+	}
+	defer tty.Close()
+
+	width, height, err := term.GetSize(int(tty.Fd()))
+	if err != nil {
+		return 0, 0, fmt.Errorf("no terminal found: %v", err)
+	}
+	return width, height, nil
+}
+
+// SizeOrDefault is Size, falling back to 80x24 when there's no terminal
+func SizeOrDefault() (int, int) {
+	width, height, err := Size()
+	if err != nil {
+		return DefaultWidth, DefaultHeight
+	}
+	return width, height
+}
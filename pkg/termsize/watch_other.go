@@ -0,0 +1,8 @@
+//go:build !unix
+
+package termsize
+
+// There's no SIGWINCH here, so the size found at startup is used throughout
+func Watch(fn func(width, height int)) (stop func()) {
+	return func() {}
+}
@@ -0,0 +1,36 @@
+//go:build unix
+
+package termsize
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Watch calls fn with the new size each time the terminal is resized
+// (SIGWINCH), until the returned function is called. fn runs on its own
+// goroutine.
+func Watch(fn func(width, height int)) (stop func()) {
+	sig := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sig, syscall.SIGWINCH)
+
+	go func() {
+		for {
+			select {
+			case <-sig:
+				if width, height, err := Size(); err == nil {
+					fn(width, height)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sig)
+		close(done)
+	}
+}
@@ -0,0 +1,322 @@
+package tokenizer
+
+// A byte-pair encoding tokenizer, read from the tokenizer.json that comes
+// with a model on Hugging Face. That covers both kinds in common use:
+//
+//   - Byte-level BPE (llama 3, qwen2, GPT-2), where the text is split into
+//     words first and each byte of a word is a symbol to start with
+//   - SentencePiece-style BPE (llama 2, mistral, gemma), where spaces are
+//     "▁" and characters that aren't in the vocabulary fall back to bytes
+//
+// Only counting is needed, so there's no decoding, and special tokens are
+// left to the caller (they're part of the chat template, not the text).
+// Splitting into words follows GPT-2's pattern, which isn't quite what every
+// byte-level model uses, so counts can be off by a token here and there.
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+type BPE struct {
+	name  string
+	vocab map[string]int
+	// The order merges are tried in, lowest first
+	ranks map[[2]string]int
+	// Byte-level (GPT-2 style) rather than SentencePiece style
+	byteLevel    bool
+	byteFallback bool
+
+	mu sync.Mutex
+	// Words come up again and again, so their counts are kept
+	cache map[string]int
+}
+
+// The parts of tokenizer.json that matter for counting
+type tokenizerFile struct {
+	Model struct {
+		Type         string          `json:"type"`
+		Vocab        map[string]int  `json:"vocab"`
+		Merges       json.RawMessage `json:"merges"`
+		ByteFallback bool            `json:"byte_fallback"`
+	} `json:"model"`
+	PreTokenizer json.RawMessage `json:"pre_tokenizer"`
+}
+
+// Load reads a tokenizer from a tokenizer.json file
+func Load(path string) (*BPE, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tokenizer: %v", err)
+	}
+
+	var file tokenizerFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error reading tokenizer %s: %v", path, err)
+	}
+	if file.Model.Type != "BPE" {
+		return nil, fmt.Errorf("tokenizer %s is %q, but only BPE is supported", path, file.Model.Type)
+	}
+	if len(file.Model.Vocab) == 0 {
+		return nil, fmt.Errorf("tokenizer %s has no vocabulary", path)
+	}
+
+	merges, err := parseMerges(file.Model.Merges)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tokenizer %s: %v", path, err)
+	}
+
+	t := &BPE{
+		name:         strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		vocab:        file.Model.Vocab,
+		ranks:        make(map[[2]string]int, len(merges)),
+		byteLevel:    hasType(file.PreTokenizer, "ByteLevel"),
+		byteFallback: file.Model.ByteFallback,
+		cache:        make(map[string]int),
+	}
+	for i, pair := range merges {
+		if _, ok := t.ranks[pair]; !ok {
+			t.ranks[pair] = i
+		}
+	}
+	return t, nil
+}
+
+// Merges are "a b" in older files and ["a", "b"] in newer ones
+func parseMerges(raw json.RawMessage) ([][2]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var pairs [][2]string
+	if err := json.Unmarshal(raw, &pairs); err == nil {
+		return pairs, nil
+	}
+
+	var lines []string
+	if err := json.Unmarshal(raw, &lines); err != nil {
+		return nil, fmt.Errorf("merges should be a list of pairs")
+	}
+	for _, line := range lines {
+		a, b, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("bad merge %q", line)
+		}
+		pairs = append(pairs, [2]string{a, b})
+	}
+	return pairs, nil
+}
+
+// hasType reports whether there's a part of type name anywhere in raw,
+// which may be a Sequence of them
+func hasType(raw json.RawMessage, name string) bool {
+	var v any
+	if len(raw) == 0 || json.Unmarshal(raw, &v) != nil {
+		return false
+	}
+
+	var walk func(any) bool
+	walk = func(v any) bool {
+		switch v := v.(type) {
+		case map[string]any:
+			if v["type"] == name {
+				return true
+			}
+			for _, child := range v {
+				if walk(child) {
+					return true
+				}
+			}
+		case []any:
+			for _, child := range v {
+				if walk(child) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return walk(v)
+}
+
+func (t *BPE) Name() string {
+	return t.name
+}
+
+func (t *BPE) Count(text string) int {
+	var words []string
+	if t.byteLevel {
+		words = splitWords(text)
+	} else {
+		words = splitPieces(text)
+	}
+
+	n := 0
+	for _, word := range words {
+		n += t.countWord(word)
+	}
+	return n
+}
+
+func (t *BPE) countWord(word string) int {
+	t.mu.Lock()
+	n, ok := t.cache[word]
+	t.mu.Unlock()
+	if ok {
+		return n
+	}
+
+	var symbols []string
+	if t.byteLevel {
+		for i := 0; i < len(word); i++ {
+			symbols = append(symbols, byteSymbols[word[i]])
+		}
+	} else {
+		for _, r := range word {
+			symbols = append(symbols, string(r))
+		}
+	}
+
+	for _, symbol := range t.merge(symbols) {
+		if _, ok := t.vocab[symbol]; !ok && t.byteFallback {
+			// <0xE2><0x96>... one token for each byte
+			n += len(symbol)
+		} else {
+			n++
+		}
+	}
+
+	t.mu.Lock()
+	t.cache[word] = n
+	t.mu.Unlock()
+	return n
+}
+
+// merge applies the merges to symbols, the lowest ranked pair first, until
+// none of them apply
+func (t *BPE) merge(symbols []string) []string {
+	for len(symbols) > 1 {
+		best, bestRank := -1, 0
+		for i := 0; i < len(symbols)-1; i++ {
+			rank, ok := t.ranks[[2]string{symbols[i], symbols[i+1]}]
+			if ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		// Every occurrence of the pair, left to right
+		pair := [2]string{symbols[best], symbols[best+1]}
+		merged := symbols[:0:0]
+		for i := 0; i < len(symbols); i++ {
+			if i < len(symbols)-1 && symbols[i] == pair[0] && symbols[i+1] == pair[1] {
+				merged = append(merged, pair[0]+pair[1])
+				i++
+			} else {
+				merged = append(merged, symbols[i])
+			}
+		}
+		symbols = merged
+	}
+	return symbols
+}
+
+// splitWords splits text the way GPT-2's pattern does:
+//
+//	's|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+
+//
+// Go's regexp has no lookahead, hence doing it by hand.
+func splitWords(text string) []string {
+	var words []string
+	rs := []rune(text)
+	for i := 0; i < len(rs); {
+		j := i
+		if c := contraction(rs[i:]); c > 0 {
+			j += c
+		} else {
+			if rs[j] == ' ' && j+1 < len(rs) && !unicode.IsSpace(rs[j+1]) {
+				j++
+			}
+			switch r := rs[j]; {
+			case unicode.IsLetter(r):
+				for j < len(rs) && unicode.IsLetter(rs[j]) {
+					j++
+				}
+			case unicode.IsNumber(r):
+				for j < len(rs) && unicode.IsNumber(rs[j]) {
+					j++
+				}
+			case !unicode.IsSpace(r):
+				for j < len(rs) && !unicode.IsSpace(rs[j]) && !unicode.IsLetter(rs[j]) && !unicode.IsNumber(rs[j]) {
+					j++
+				}
+			default:
+				for j < len(rs) && unicode.IsSpace(rs[j]) {
+					j++
+				}
+				// The last space goes with the word after it
+				if j < len(rs) && j-i > 1 {
+					j--
+				}
+			}
+		}
+		words = append(words, string(rs[i:j]))
+		i = j
+	}
+	return words
+}
+
+var contractions = []string{"'s", "'t", "'re", "'ve", "'m", "'ll", "'d"}
+
+func contraction(rs []rune) int {
+	for _, c := range contractions {
+		if strings.HasPrefix(string(rs[:min(len(rs), 3)]), c) {
+			return utf8.RuneCountInString(c)
+		}
+	}
+	return 0
+}
+
+// splitPieces splits text SentencePiece style: spaces become "▁", there's
+// one at the start, and each piece starts at one
+func splitPieces(text string) []string {
+	if text == "" {
+		return nil
+	}
+	text = "▁" + strings.ReplaceAll(text, " ", "▁")
+
+	var pieces []string
+	start := 0
+	for i, r := range text {
+		if r == '▁' && i > start {
+			pieces = append(pieces, text[start:i])
+			start = i
+		}
+	}
+	return append(pieces, text[start:])
+}
+
+// byteSymbols are the characters byte-level BPE uses for each byte: the
+// printable ones stand for themselves, and the rest are moved up past 255
+// so none of them is whitespace or a control character
+var byteSymbols = func() [256]string {
+	var symbols [256]string
+	n := 0
+	for b := 0; b < 256; b++ {
+		if ('!' <= b && b <= '~') || ('¡' <= b && b <= '¬') || ('®' <= b && b <= 'ÿ') {
+			symbols[b] = string(rune(b))
+		} else {
+			symbols[b] = string(rune(256 + n))
+			n++
+		}
+	}
+	return symbols
+}()
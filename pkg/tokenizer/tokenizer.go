@@ -0,0 +1,28 @@
+// Package tokenizer counts tokens the way a model does, or as near as it can,
+// for deciding how much of a conversation will fit in a model's context
+// before it's sent. After it's sent, Ollama says how many there really were.
+package tokenizer
+
+import (
+	"github.com/duluk/ask-ollama/pkg/LLM"
+)
+
+// A Tokenizer counts the tokens in some text
+type Tokenizer interface {
+	Count(text string) int
+	// Name says which it is, for showing to the user
+	Name() string
+}
+
+// Heuristic is the estimate to use when there's nothing better: it splits
+// on spaces and punctuation, which is close enough for English prose, less
+// so for code and other languages
+type Heuristic struct{}
+
+func (Heuristic) Count(text string) int {
+	return int(LLM.EstimateTokens(text))
+}
+
+func (Heuristic) Name() string {
+	return "estimate"
+}
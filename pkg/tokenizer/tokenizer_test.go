@@ -0,0 +1,76 @@
+package tokenizer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The fixtures are small vocabularies in the tokenizer.json format, one of
+// each kind, with counts worked out by hand from their merges
+func TestCounts(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "counts.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fixtures []struct {
+		Tokenizer string `json:"tokenizer"`
+		Text      string `json:"text"`
+		Tokens    int    `json:"tokens"`
+	}
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		t.Fatal(err)
+	}
+
+	tokenizers := map[string]*BPE{}
+	for _, f := range fixtures {
+		tok, ok := tokenizers[f.Tokenizer]
+		if !ok {
+			tok, err = Load(filepath.Join("testdata", f.Tokenizer))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tokenizers[f.Tokenizer] = tok
+		}
+		assert.Equal(t, f.Tokens, tok.Count(f.Text), "%s: %q", f.Tokenizer, f.Text)
+		// Again, from the cache
+		assert.Equal(t, f.Tokens, tok.Count(f.Text), "%s: %q", f.Tokenizer, f.Text)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tok, err := Load(filepath.Join("testdata", "bytelevel.json"))
+	assert.Nil(t, err)
+	assert.Equal(t, "bytelevel", tok.Name())
+	assert.True(t, tok.byteLevel)
+
+	tok, err = Load(filepath.Join("testdata", "metaspace.json"))
+	assert.Nil(t, err)
+	assert.False(t, tok.byteLevel)
+	assert.True(t, tok.byteFallback)
+
+	_, err = Load(filepath.Join("testdata", "missing.json"))
+	assert.NotNil(t, err)
+
+	dir := t.TempDir()
+	wordPiece := filepath.Join(dir, "bert.json")
+	os.WriteFile(wordPiece, []byte(`{"model":{"type":"WordPiece","vocab":{"a":0}}}`), 0644)
+	_, err = Load(wordPiece)
+	assert.ErrorContains(t, err, `is "WordPiece", but only BPE is supported`)
+}
+
+func TestSplitWords(t *testing.T) {
+	assert.Equal(t, []string{"Hello", ",", " world", "!"}, splitWords("Hello, world!"))
+	assert.Equal(t, []string{"it", "'s", " 123"}, splitWords("it's 123"))
+	assert.Equal(t, []string{"a", "  ", " b", "  "}, splitWords("a   b  "))
+	assert.Equal(t, []string{"x", " :=", " f", "(", "y", ")", "\n"}, splitWords("x := f(y)\n"))
+}
+
+func TestHeuristic(t *testing.T) {
+	var tok Tokenizer = Heuristic{}
+	assert.Equal(t, 4, tok.Count("Hello, world!"))
+	assert.Equal(t, "estimate", tok.Name())
+}
@@ -0,0 +1,307 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/duluk/ask-ollama/pkg/attachments"
+	"github.com/duluk/ask-ollama/pkg/database"
+)
+
+// The built-in tools
+const (
+	ReadFile      = "read_file"
+	ListDirectory = "list_directory"
+	RunCommand    = "run_command"
+	QueryHistory  = "query_history"
+)
+
+var Builtins = []string{ReadFile, ListDirectory, RunCommand, QueryHistory}
+
+// How many past exchanges query_history returns unless asked for fewer
+const defaultHistoryLimit = 5
+
+type Options struct {
+	// Files larger than this aren't read, attachments.DefaultMaxSize if 0
+	MaxFileSize int64
+	// The directories read_file and list_directory can look in (and under),
+	// relative to the working directory. Without any, there's no read_file
+	// or list_directory.
+	Paths []string
+	// The commands run_command may run. Without any, there's no run_command.
+	Commands []string
+	// For query_history, which isn't offered without it
+	DB *database.ChatDB
+	// For the registry; the defaults if they're 0
+	Policies  map[string]Policy
+	Timeout   time.Duration
+	MaxOutput int
+}
+
+// Builtin makes a registry of the named built-in tools. Ones that can't work
+// with opts (run_command with no commands allowed, query_history with no
+// database) are left out rather than offered to the model only to fail.
+//
+// Looking at files is allowed unless the policies say otherwise, but running
+// commands needs the user's say-so.
+func Builtin(names []string, opts Options) (*Registry, error) {
+	if opts.MaxFileSize <= 0 {
+		opts.MaxFileSize = attachments.DefaultMaxSize
+	}
+	roots, err := resolveRoots(opts.Paths)
+	if err != nil {
+		return nil, err
+	}
+
+	r := NewRegistry()
+	r.Policies = opts.Policies
+	if opts.Timeout > 0 {
+		r.Timeout = opts.Timeout
+	}
+	if opts.MaxOutput > 0 {
+		r.MaxOutput = opts.MaxOutput
+	}
+	for _, name := range names {
+		switch name {
+		case ReadFile:
+			if len(roots) > 0 {
+				r.Add(readFile(roots, opts.MaxFileSize))
+			}
+		case ListDirectory:
+			if len(roots) > 0 {
+				r.Add(listDirectory(roots))
+			}
+		case RunCommand:
+			if len(opts.Commands) > 0 {
+				r.Add(runCommand(opts.Commands))
+			}
+		case QueryHistory:
+			if opts.DB != nil {
+				r.Add(queryHistory(opts.DB))
+			}
+		default:
+			return nil, fmt.Errorf("there's no built-in tool called %q", name)
+		}
+	}
+	return r, nil
+}
+
+// object is the schema for the arguments, which are always an object
+func object(required []string, props map[string]any) map[string]any {
+	return map[string]any{
+		"type":       "object",
+		"properties": props,
+		"required":   required,
+	}
+}
+
+func property(typ, description string) map[string]any {
+	return map[string]any{"type": typ, "description": description}
+}
+
+// resolveRoots makes paths absolute, with any symlinks followed, so a path
+// can be checked against them by what it really is. Ones that don't exist
+// are left out, as a relative one won't from everywhere.
+func resolveRoots(paths []string) ([]string, error) {
+	var roots []string
+	for _, path := range paths {
+		root, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		root, err = filepath.EvalSymlinks(root)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error with tool path: %v", err)
+		}
+		roots = append(roots, root)
+	}
+	return roots, nil
+}
+
+// checkPath returns an error if path isn't in (or under) one of roots. A
+// symlink counts as where it leads, so one can't be used to get out.
+func checkPath(roots []string, path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	// A path that doesn't exist is checked as it is, and fails later
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = real
+	}
+
+	for _, root := range roots {
+		if rel, err := filepath.Rel(root, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is outside the directories that can be looked at", path)
+}
+
+func readFile(roots []string, maxSize int64) Tool {
+	return Tool{
+		Name:        ReadFile,
+		Description: "Read a text file and return what's in it",
+		Parameters: object([]string{"path"}, map[string]any{
+			"path": property("string", "The path of the file"),
+		}),
+		Policy: Allow,
+		Run: func(ctx context.Context, args Args) (string, error) {
+			path, err := args.String("path")
+			if err != nil {
+				return "", err
+			}
+			if err := checkPath(roots, path); err != nil {
+				return "", err
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				return "", err
+			}
+			if info.IsDir() {
+				return "", fmt.Errorf("%s is a directory", path)
+			}
+			if info.Size() > maxSize {
+				return "", fmt.Errorf("%s is larger than the limit of %d bytes", path, maxSize)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", err
+			}
+			if attachments.IsBinary(data) {
+				return "", fmt.Errorf("%s looks like a binary file", path)
+			}
+			return string(data), nil
+		},
+	}
+}
+
+func listDirectory(roots []string) Tool {
+	return Tool{
+		Name:        ListDirectory,
+		Description: "List the files in a directory. Directories end in a slash.",
+		Parameters: object(nil, map[string]any{
+			"path": property("string", "The path of the directory, the current directory if not given"),
+		}),
+		Policy: Allow,
+		Run: func(ctx context.Context, args Args) (string, error) {
+			path, err := args.OptString("path", ".")
+			if err != nil {
+				return "", err
+			}
+			if err := checkPath(roots, path); err != nil {
+				return "", err
+			}
+
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				return "", err
+			}
+
+			var names []string
+			for _, entry := range entries {
+				name := entry.Name()
+				if entry.IsDir() {
+					name += "/"
+				}
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			if len(names) == 0 {
+				return "(empty)", nil
+			}
+			return strings.Join(names, "\n"), nil
+		},
+	}
+}
+
+func runCommand(allowed []string) Tool {
+	return Tool{
+		Name: RunCommand,
+		Description: "Run a command and return its output. The only commands allowed are: " +
+			strings.Join(allowed, ", ") + ". There's no shell, so no pipes, redirection or globs.",
+		Parameters: object([]string{"command"}, map[string]any{
+			"command": property("string", "The command and its arguments, e.g. \"git log -5\""),
+		}),
+		Policy: Ask,
+		Run: func(ctx context.Context, args Args) (string, error) {
+			command, err := args.String("command")
+			if err != nil {
+				return "", err
+			}
+
+			words := strings.Fields(command)
+			if len(words) == 0 {
+				return "", fmt.Errorf("command is empty")
+			}
+			// A path would get around the list, ./git being any program at all
+			if strings.ContainsRune(words[0], '/') || !slices.Contains(allowed, words[0]) {
+				return "", fmt.Errorf("%s isn't allowed (only %s)", words[0], strings.Join(allowed, ", "))
+			}
+
+			cmd := exec.CommandContext(ctx, words[0], words[1:]...)
+			// Don't wait forever on anything it started that's still going
+			cmd.WaitDelay = time.Second
+			out, err := cmd.CombinedOutput()
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				// Failing is still an answer, and the output says why
+				return fmt.Sprintf("%s(exit status %d)", out, exitErr.ExitCode()), nil
+			}
+			if err != nil {
+				return "", err
+			}
+			return string(out), nil
+		},
+	}
+}
+
+func queryHistory(db *database.ChatDB) Tool {
+	return Tool{
+		Name:        QueryHistory,
+		Description: "Search past conversations with the user for a word or phrase, returning the most recent exchanges that mention it",
+		Parameters: object([]string{"query"}, map[string]any{
+			"query": property("string", "What to search for"),
+			"limit": property("integer", fmt.Sprintf("The most exchanges to return, %d if not given", defaultHistoryLimit)),
+		}),
+		Policy: Allow,
+		Run: func(ctx context.Context, args Args) (string, error) {
+			query, err := args.String("query")
+			if err != nil {
+				return "", err
+			}
+			limit, err := args.OptInt("limit", defaultHistoryLimit)
+			if err != nil {
+				return "", err
+			}
+
+			turns, err := db.SearchTurns(query, limit)
+			if err != nil {
+				return "", err
+			}
+			if len(turns) == 0 {
+				return "Nothing found", nil
+			}
+
+			var b strings.Builder
+			for _, turn := range turns {
+				fmt.Fprintf(&b, "Conversation %d, %s, %s\n", turn.ConvID, turn.Timestamp, turn.Model)
+				fmt.Fprintf(&b, "User: %s\nAssistant: %s\n\n", turn.Prompt, turn.Response)
+			}
+			return strings.TrimSpace(b.String()), nil
+		},
+	}
+}
@@ -0,0 +1,125 @@
+package tools
+
+// What stands between a model asking for a tool and the tool being run:
+// each tool has a policy (allow, ask or deny), the user is asked about the
+// ones set to ask, and every call is recorded whether it went ahead or not.
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/duluk/ask-ollama/pkg/LLM"
+)
+
+type Policy string
+
+const (
+	Allow Policy = "allow"
+	Ask   Policy = "ask"
+	Deny  Policy = "deny"
+)
+
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case Allow, Ask, Deny:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown policy %q (expected allow, ask or deny)", s)
+}
+
+// Answer is the user's answer when asked about a call
+type Answer int
+
+const (
+	No Answer = iota
+	Yes
+	// Yes, and don't ask again about this tool
+	Always
+)
+
+// Decision is whether a call went ahead, and why, for the audit log
+type Decision string
+
+const (
+	// By policy
+	Allowed Decision = "allowed"
+	Denied  Decision = "denied"
+	// By the user
+	Approved Decision = "approved"
+	Declined Decision = "declined"
+	// The policy is ask, but there was no one to ask
+	Unconfirmed Decision = "unconfirmed"
+	// There's no such tool
+	Unknown Decision = "unknown"
+)
+
+// Record is a call and what came of it
+type Record struct {
+	LLM.ToolCall
+	Decision Decision
+	Duration time.Duration
+}
+
+// Defaults for Registry.Timeout and Registry.MaxOutput
+const (
+	DefaultTimeout   = 30 * time.Second
+	DefaultMaxOutput = 16 * 1024
+)
+
+// policy is how name may be called: what the config says, or else the
+// tool's own default
+func (r *Registry) policy(t Tool) Policy {
+	if p, ok := r.Policies[t.Name]; ok {
+		return p
+	}
+	if t.Policy != "" {
+		return t.Policy
+	}
+	return Ask
+}
+
+// decide says whether a call can go ahead, asking the user if need be
+func (r *Registry) decide(t Tool, args Args) (Decision, error) {
+	switch r.policy(t) {
+	case Allow:
+		return Allowed, nil
+	case Deny:
+		return Denied, fmt.Errorf("%s isn't allowed (its policy is deny)", t.Name)
+	}
+
+	if r.always[t.Name] {
+		return Approved, nil
+	}
+	if r.Confirm == nil {
+		return Unconfirmed, fmt.Errorf("%s needs the user's say-so, and there's no one to ask", t.Name)
+	}
+	answer, err := r.Confirm(LLM.ToolCall{Name: t.Name, Arguments: args})
+	if err != nil {
+		return Unconfirmed, fmt.Errorf("couldn't ask the user about %s: %v", t.Name, err)
+	}
+	switch answer {
+	case Always:
+		if r.always == nil {
+			r.always = make(map[string]bool)
+		}
+		r.always[t.Name] = true
+		return Approved, nil
+	case Yes:
+		return Approved, nil
+	}
+	return Declined, fmt.Errorf("the user said no to %s", t.Name)
+}
+
+// truncate cuts s down to max bytes (without splitting a character), saying
+// how much was left out
+func truncate(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + fmt.Sprintf("\n... (%d more bytes cut)", len(s)-cut)
+}
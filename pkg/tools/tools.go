@@ -0,0 +1,172 @@
+// Package tools is the tools a model can call (with --tools). A Registry
+// holds them by name; the model is sent their definitions, and asks for them
+// to be called with arguments that are meant to match the schema, though
+// there's no telling with a small model, so they're checked anyway.
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/duluk/ask-ollama/pkg/LLM"
+	"github.com/duluk/ask-ollama/pkg/ollama"
+)
+
+type Tool struct {
+	Name string
+	// What it does, and when to use it, for the model
+	Description string
+	// A JSON schema for the arguments
+	Parameters map[string]any
+	// The policy unless the registry has one for it, Ask if not set
+	Policy Policy
+	// ctx is done when the call has taken too long
+	Run func(ctx context.Context, args Args) (string, error)
+}
+
+// Registry is the tools on offer, which is an LLM.Toolbox
+type Registry struct {
+	tools map[string]Tool
+	// In the order they were added, which is the order the model sees them
+	names []string
+
+	// How each tool may be called, where it's not the tool's default
+	Policies map[string]Policy
+	// Asks the user whether a call can go ahead, for tools whose policy is
+	// ask. Without it, they're refused.
+	Confirm func(call LLM.ToolCall) (Answer, error)
+	// Called with every call, including the ones that were refused
+	Audit func(Record)
+	// How long a call can take, and how much of what it returns is passed
+	// on to the model
+	Timeout   time.Duration
+	MaxOutput int
+
+	// Tools the user has said to always allow
+	always map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		tools:     make(map[string]Tool),
+		Timeout:   DefaultTimeout,
+		MaxOutput: DefaultMaxOutput,
+	}
+}
+
+// Add adds a tool, replacing any with the same name
+func (r *Registry) Add(t Tool) {
+	if _, ok := r.tools[t.Name]; !ok {
+		r.names = append(r.names, t.Name)
+	}
+	r.tools[t.Name] = t
+}
+
+func (r *Registry) Names() []string {
+	return r.names
+}
+
+func (r *Registry) Definitions() []ollama.Tool {
+	var defs []ollama.Tool
+	for _, name := range r.names {
+		t := r.tools[name]
+		defs = append(defs, ollama.Tool{
+			Type: "function",
+			Function: ollama.ToolFunction{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Parameters,
+			},
+		})
+	}
+	return defs
+}
+
+// Call runs a tool if its policy (or the user) allows it
+func (r *Registry) Call(name string, args map[string]any) (string, error) {
+	record := Record{ToolCall: LLM.ToolCall{Name: name, Arguments: args}}
+	result, err := r.call(&record)
+	if err != nil {
+		record.Error = err.Error()
+	} else {
+		record.Result = result
+	}
+	if r.Audit != nil {
+		r.Audit(record)
+	}
+	return result, err
+}
+
+func (r *Registry) call(record *Record) (string, error) {
+	t, ok := r.tools[record.Name]
+	if !ok {
+		record.Decision = Unknown
+		return "", fmt.Errorf("there's no tool called %q (there's %s)", record.Name, strings.Join(r.names, ", "))
+	}
+
+	var err error
+	record.Decision, err = r.decide(t, record.Arguments)
+	if err != nil {
+		return "", err
+	}
+
+	ctx := context.Background()
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	result, err := t.Run(ctx, Args(record.Arguments))
+	record.Duration = time.Since(start)
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("%s timed out after %v", record.Name, r.Timeout)
+	}
+	return truncate(result, r.MaxOutput), err
+}
+
+// Args are the arguments to a call, as the model gave them
+type Args map[string]any
+
+// String is a required string argument
+func (a Args) String(name string) (string, error) {
+	v, ok := a[name]
+	if !ok {
+		return "", fmt.Errorf("%s is required", name)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s should be a string", name)
+	}
+	return s, nil
+}
+
+// OptString is an optional string argument, def if it isn't given
+func (a Args) OptString(name, def string) (string, error) {
+	if v, ok := a[name]; !ok || v == nil {
+		return def, nil
+	}
+	return a.String(name)
+}
+
+// OptInt is an optional whole number, def if it isn't given. JSON numbers
+// are float64, and models sometimes quote them.
+func (a Args) OptInt(name string, def int) (int, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return def, nil
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	case string:
+		var n int
+		if _, err := fmt.Sscan(v, &n); err == nil {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("%s should be a whole number", name)
+}
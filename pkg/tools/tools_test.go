@@ -0,0 +1,302 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/duluk/ask-ollama/pkg/LLM"
+	"github.com/duluk/ask-ollama/pkg/database"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.Add(Tool{Name: "b", Policy: Allow, Run: func(context.Context, Args) (string, error) { return "first b", nil }})
+	r.Add(Tool{Name: "a", Description: "A", Policy: Allow, Run: func(_ context.Context, args Args) (string, error) { return args.String("x") }})
+	r.Add(Tool{Name: "b", Policy: Allow, Run: func(context.Context, Args) (string, error) { return "second b", nil }})
+
+	assert.Equal(t, []string{"b", "a"}, r.Names())
+	defs := r.Definitions()
+	assert.Len(t, defs, 2)
+	assert.Equal(t, "function", defs[1].Type)
+	assert.Equal(t, "a", defs[1].Function.Name)
+	assert.Equal(t, "A", defs[1].Function.Description)
+
+	result, err := r.Call("b", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "second b", result)
+
+	result, err = r.Call("a", map[string]any{"x": "y"})
+	assert.Nil(t, err)
+	assert.Equal(t, "y", result)
+
+	_, err = r.Call("a", map[string]any{"x": 1.0})
+	assert.EqualError(t, err, "x should be a string")
+	_, err = r.Call("a", nil)
+	assert.EqualError(t, err, "x is required")
+	_, err = r.Call("c", nil)
+	assert.EqualError(t, err, `there's no tool called "c" (there's b, a)`)
+}
+
+func TestArgs(t *testing.T) {
+	args := Args{"n": 3.0, "s": "4", "f": 1.5, "text": "hi"}
+
+	for _, test := range []struct {
+		name     string
+		expected int
+		err      string
+	}{
+		{"n", 3, ""},
+		{"s", 4, ""},
+		{"missing", 7, ""},
+		{"f", 0, "f should be a whole number"},
+		{"text", 0, "text should be a whole number"},
+	} {
+		n, err := args.OptInt(test.name, 7)
+		if test.err != "" {
+			assert.EqualError(t, err, test.err, test.name)
+		} else {
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, test.expected, n, test.name)
+		}
+	}
+
+	s, err := args.OptString("missing", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, "default", s)
+	_, err = args.OptString("n", "default")
+	assert.EqualError(t, err, "n should be a string")
+}
+
+func TestBuiltin(t *testing.T) {
+	r, err := Builtin(Builtins, Options{})
+	assert.Nil(t, err)
+	// Nowhere to look, nothing to run, and no database to query
+	assert.Empty(t, r.Names())
+
+	r, err = Builtin(Builtins, Options{Paths: []string{"."}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ReadFile, ListDirectory}, r.Names())
+
+	r, err = Builtin([]string{QueryHistory, RunCommand}, Options{Commands: []string{"echo"}, DB: &database.ChatDB{}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{QueryHistory, RunCommand}, r.Names())
+
+	_, err = Builtin([]string{"rm_rf"}, Options{})
+	assert.EqualError(t, err, `there's no built-in tool called "rm_rf"`)
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("Some notes\n"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "big.txt"), []byte("0123456789abcdef"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "data.bin"), []byte{0, 1, 2}, 0644))
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+
+	r, err := Builtin([]string{ReadFile, ListDirectory}, Options{Paths: []string{dir}, MaxFileSize: 12})
+	assert.Nil(t, err)
+
+	result, err := r.Call(ListDirectory, map[string]any{"path": dir})
+	assert.Nil(t, err)
+	assert.Equal(t, "big.txt\ndata.bin\nnotes.txt\nsub/", result)
+
+	result, err = r.Call(ListDirectory, map[string]any{"path": filepath.Join(dir, "sub")})
+	assert.Nil(t, err)
+	assert.Equal(t, "(empty)", result)
+
+	result, err = r.Call(ReadFile, map[string]any{"path": filepath.Join(dir, "notes.txt")})
+	assert.Nil(t, err)
+	assert.Equal(t, "Some notes\n", result)
+
+	for name, expected := range map[string]string{
+		"big.txt":  "is larger than the limit of 12 bytes",
+		"data.bin": "looks like a binary file",
+		"sub":      "is a directory",
+		"nothing":  "no such file or directory",
+	} {
+		_, err := r.Call(ReadFile, map[string]any{"path": filepath.Join(dir, name)})
+		assert.ErrorContains(t, err, expected, name)
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	r, err := Builtin([]string{RunCommand}, Options{
+		Commands: []string{"echo", "false", "sleep"},
+		Policies: map[string]Policy{RunCommand: Allow},
+		Timeout:  100 * time.Millisecond,
+	})
+	assert.Nil(t, err)
+
+	result, err := r.Call(RunCommand, map[string]any{"command": "echo hello   there"})
+	assert.Nil(t, err)
+	assert.Equal(t, "hello there\n", result)
+
+	// No shell, so this is just more arguments
+	result, err = r.Call(RunCommand, map[string]any{"command": "echo hi; rm -rf /"})
+	assert.Nil(t, err)
+	assert.Equal(t, "hi; rm -rf /\n", result)
+
+	result, err = r.Call(RunCommand, map[string]any{"command": "false"})
+	assert.Nil(t, err)
+	assert.Equal(t, "(exit status 1)", result)
+
+	_, err = r.Call(RunCommand, map[string]any{"command": "sleep 5"})
+	assert.EqualError(t, err, "run_command timed out after 100ms")
+
+	_, err = r.Call(RunCommand, map[string]any{"command": "rm -rf /"})
+	assert.EqualError(t, err, "rm isn't allowed (only echo, false, sleep)")
+	_, err = r.Call(RunCommand, map[string]any{"command": "/bin/echo hi"})
+	assert.EqualError(t, err, "/bin/echo isn't allowed (only echo, false, sleep)")
+	_, err = r.Call(RunCommand, map[string]any{"command": "  "})
+	assert.EqualError(t, err, "command is empty")
+}
+
+func TestQueryHistory(t *testing.T) {
+	db, err := database.InitializeDB(filepath.Join(t.TempDir(), "test.db"), "conversations")
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, db.InsertConversation("What's a good chess opening?", "The Italian.", "llama3.1", 0.7, 10, 20, 1))
+	assert.Nil(t, db.InsertConversation("What about checkers?", "Anything, really.", "llama3.1", 0.7, 10, 20, 2))
+
+	r, err := Builtin([]string{QueryHistory}, Options{DB: db})
+	assert.Nil(t, err)
+
+	result, err := r.Call(QueryHistory, map[string]any{"query": "chess"})
+	assert.Nil(t, err)
+	assert.Contains(t, result, "Conversation 1, ")
+	assert.Contains(t, result, "User: What's a good chess opening?\nAssistant: The Italian.")
+	assert.NotContains(t, result, "checkers")
+
+	result, err = r.Call(QueryHistory, map[string]any{"query": "backgammon"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Nothing found", result)
+}
+
+func TestPaths(t *testing.T) {
+	dir := t.TempDir()
+	inside := filepath.Join(dir, "inside")
+	outside := filepath.Join(dir, "outside")
+	assert.Nil(t, os.Mkdir(inside, 0755))
+	assert.Nil(t, os.Mkdir(outside, 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(inside, "ok.txt"), []byte("ok"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644))
+	assert.Nil(t, os.Symlink(outside, filepath.Join(inside, "link")))
+
+	// Relative to the working directory
+	cwd, err := os.Getwd()
+	assert.Nil(t, err)
+	assert.Nil(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(cwd) })
+
+	r, err := Builtin([]string{ReadFile, ListDirectory}, Options{Paths: []string{"inside"}})
+	assert.Nil(t, err)
+
+	result, err := r.Call(ReadFile, map[string]any{"path": "inside/ok.txt"})
+	assert.Nil(t, err)
+	assert.Equal(t, "ok", result)
+	_, err = r.Call(ListDirectory, map[string]any{"path": filepath.Join(dir, "inside")})
+	assert.Nil(t, err)
+
+	for _, path := range []string{"outside/secret.txt", "inside/../outside/secret.txt", "inside/link/secret.txt", "/etc/passwd", "."} {
+		_, err := r.Call(ReadFile, map[string]any{"path": path})
+		assert.EqualError(t, err, path+" is outside the directories that can be looked at", path)
+	}
+	_, err = r.Call(ListDirectory, nil)
+	assert.EqualError(t, err, ". is outside the directories that can be looked at")
+
+	// Nowhere that exists, so nowhere to look
+	r, err = Builtin([]string{ReadFile}, Options{Paths: []string{"nowhere"}})
+	assert.Nil(t, err)
+	assert.Empty(t, r.Names())
+}
+
+func TestPolicies(t *testing.T) {
+	ran := 0
+	tool := func(name string, policy Policy) Tool {
+		return Tool{Name: name, Policy: policy, Run: func(context.Context, Args) (string, error) {
+			ran++
+			return "ran " + name, nil
+		}}
+	}
+
+	var asked []string
+	var answers []Answer
+	var records []Record
+	r := NewRegistry()
+	r.Add(tool("free", Allow))
+	r.Add(tool("risky", Ask))
+	r.Add(tool("unset", ""))
+	r.Add(tool("off", Allow))
+	r.Policies = map[string]Policy{"off": Deny}
+	r.Audit = func(record Record) { records = append(records, record) }
+
+	// No one to ask
+	_, err := r.Call("risky", nil)
+	assert.EqualError(t, err, "risky needs the user's say-so, and there's no one to ask")
+	_, err = r.Call("unset", nil)
+	assert.EqualError(t, err, "unset needs the user's say-so, and there's no one to ask")
+
+	r.Confirm = func(call LLM.ToolCall) (Answer, error) {
+		asked = append(asked, call.String())
+		answer := answers[0]
+		answers = answers[1:]
+		return answer, nil
+	}
+	answers = []Answer{No, Yes, Always}
+	_, err = r.Call("risky", map[string]any{"x": "1"})
+	assert.EqualError(t, err, "the user said no to risky")
+	result, err := r.Call("risky", map[string]any{"x": "2"})
+	assert.Nil(t, err)
+	assert.Equal(t, "ran risky", result)
+	_, err = r.Call("risky", map[string]any{"x": "3"})
+	assert.Nil(t, err)
+	// Not asked again
+	_, err = r.Call("risky", map[string]any{"x": "4"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{`risky(x="1")`, `risky(x="2")`, `risky(x="3")`}, asked)
+
+	_, err = r.Call("free", nil)
+	assert.Nil(t, err)
+	_, err = r.Call("off", nil)
+	assert.EqualError(t, err, "off isn't allowed (its policy is deny)")
+	_, err = r.Call("nothing", nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, 4, ran)
+
+	var decisions []Decision
+	for _, record := range records {
+		decisions = append(decisions, record.Decision)
+	}
+	assert.Equal(t, []Decision{Unconfirmed, Unconfirmed, Declined, Approved, Approved, Approved, Allowed, Denied, Unknown}, decisions)
+	assert.Equal(t, "the user said no to risky", records[2].Error)
+	assert.Equal(t, "ran risky", records[3].Result)
+	assert.Equal(t, map[string]any{"x": "2"}, records[3].Arguments)
+
+	for _, s := range []string{"allow", "ask", "deny"} {
+		p, err := ParsePolicy(s)
+		assert.Nil(t, err)
+		assert.Equal(t, Policy(s), p)
+	}
+	_, err = ParsePolicy("maybe")
+	assert.EqualError(t, err, `unknown policy "maybe" (expected allow, ask or deny)`)
+}
+
+func TestMaxOutput(t *testing.T) {
+	r := NewRegistry()
+	r.MaxOutput = 10
+	r.Add(Tool{Name: "long", Policy: Allow, Run: func(context.Context, Args) (string, error) {
+		return strings.Repeat("é", 10), nil
+	}})
+
+	result, err := r.Call("long", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "ééééé\n... (10 more bytes cut)", result)
+
+	assert.Equal(t, "short", truncate("short", 10))
+	assert.Equal(t, "éé\n... (2 more bytes cut)", truncate("ééé", 5))
+}